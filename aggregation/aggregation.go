@@ -0,0 +1,77 @@
+package aggregation
+
+import (
+	"sort"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+)
+
+type bucketKey struct {
+	productID uint64
+	start     time.Time
+}
+
+// Aggregate rolls finer candles up into candles of the given interval, with
+// day and longer buckets aligned to anchor.
+// Open comes from the first child, close from the last, high and low are the
+// extremes and volume is summed. Children of other intervals are ignored.
+func Aggregate(interval dbModels.IntervalType, children []dbModels.CandleModel, anchor dbModels.Anchor) []*dbModels.CandleModel {
+
+	source := interval.Source()
+	if source == dbModels.IntervalType_None {
+		return []*dbModels.CandleModel{}
+	}
+
+	sorted := make([]dbModels.CandleModel, 0, len(children))
+	for _, c := range children {
+		if c.IntervalType == source {
+			sorted = append(sorted, c)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].ProductID != sorted[j].ProductID {
+			return sorted[i].ProductID < sorted[j].ProductID
+		}
+		return sorted[i].Start.Before(sorted[j].Start)
+	})
+
+	buckets := map[bucketKey]*dbModels.CandleModel{}
+	models := []*dbModels.CandleModel{}
+
+	for _, c := range sorted {
+		start := anchor.Truncate(interval, c.Start)
+		key := bucketKey{
+			productID: c.ProductID,
+			start:     start.UTC(),
+		}
+
+		m, ok := buckets[key]
+		if !ok {
+			m = &dbModels.CandleModel{
+				ProductID:    c.ProductID,
+				IntervalType: interval,
+				Start:        start,
+				Open:         c.Open,
+				Close:        c.Close,
+				High:         c.High,
+				Low:          c.Low,
+				Volume:       c.Volume,
+			}
+			buckets[key] = m
+			models = append(models, m)
+			continue
+		}
+
+		m.Close = c.Close
+		if c.High.GreaterThan(m.High) {
+			m.High = c.High
+		}
+		if c.Low.LessThan(m.Low) {
+			m.Low = c.Low
+		}
+		m.Volume = m.Volume.Add(c.Volume)
+	}
+
+	return models
+}
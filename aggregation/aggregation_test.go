@@ -0,0 +1,145 @@
+package aggregation
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	"github.com/shopspring/decimal"
+)
+
+func child(productID uint64, interval dbModels.IntervalType, start time.Time, open, close, high, low, volume int64) dbModels.CandleModel {
+	return dbModels.CandleModel{
+		ProductID:    productID,
+		IntervalType: interval,
+		Start:        start,
+		Open:         decimal.NewFromInt(open),
+		Close:        decimal.NewFromInt(close),
+		High:         decimal.NewFromInt(high),
+		Low:          decimal.NewFromInt(low),
+		Volume:       decimal.NewFromInt(volume),
+	}
+}
+
+func at(value string, loc *time.Location) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", value, loc)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestAggregateValues(t *testing.T) {
+	base := at("2026-10-18 10:00:00", time.UTC)
+	children := []dbModels.CandleModel{
+		child(1, dbModels.IntervalType_1MI, base.Add(2*time.Minute), 12, 13, 15, 11, 3),
+		child(1, dbModels.IntervalType_1MI, base, 10, 11, 12, 9, 1),
+		child(1, dbModels.IntervalType_1MI, base.Add(4*time.Minute), 13, 14, 14, 8, 5),
+		child(1, dbModels.IntervalType_1MI, base.Add(5*time.Minute), 14, 16, 17, 14, 2), // next bucket
+		child(2, dbModels.IntervalType_1MI, base.Add(time.Minute), 100, 101, 102, 99, 7),
+		child(1, dbModels.IntervalType_5MI, base, 0, 0, 0, 0, 100), // not the source, ignored
+	}
+
+	got := Aggregate(dbModels.IntervalType_5MI, children, dbModels.UTCAnchor)
+
+	want := []dbModels.CandleModel{
+		child(1, dbModels.IntervalType_5MI, base, 10, 14, 15, 8, 9),
+		child(1, dbModels.IntervalType_5MI, base.Add(5*time.Minute), 14, 16, 17, 14, 2),
+		child(2, dbModels.IntervalType_5MI, base, 100, 101, 102, 99, 7),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d candles, want %d", len(got), len(want))
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.ProductID != w.ProductID || g.IntervalType != w.IntervalType || !g.Start.Equal(w.Start) ||
+			!g.Open.Equal(w.Open) || !g.Close.Equal(w.Close) || !g.High.Equal(w.High) || !g.Low.Equal(w.Low) || !g.Volume.Equal(w.Volume) {
+			t.Errorf("candle %d = %+v, want %+v", i, g, w)
+		}
+	}
+}
+
+func TestAggregateNothingFor1MI(t *testing.T) {
+	children := []dbModels.CandleModel{child(1, dbModels.IntervalType_1MI, at("2026-10-18 10:00:00", time.UTC), 1, 1, 1, 1, 1)}
+	if got := Aggregate(dbModels.IntervalType_1MI, children, dbModels.UTCAnchor); len(got) != 0 {
+		t.Fatalf("got %d candles", len(got))
+	}
+}
+
+// TestAggregateBoundaries rolls the children around a boundary of every
+// interval up: the last child before the boundary closes one bucket, the
+// first child at the boundary opens the next.
+func TestAggregateBoundaries(t *testing.T) {
+	taipei, err := time.LoadLocation("Asia/Taipei")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chicago, err := time.LoadLocation("America/Chicago")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		interval dbModels.IntervalType
+		anchor   dbModels.Anchor
+		boundary time.Time
+		previous time.Time // start of the bucket ending at boundary
+	}{
+		{"2MI", dbModels.IntervalType_2MI, dbModels.UTCAnchor, at("2026-10-18 10:04:00", time.UTC), at("2026-10-18 10:02:00", time.UTC)},
+		{"5MI", dbModels.IntervalType_5MI, dbModels.UTCAnchor, at("2026-10-18 10:05:00", time.UTC), at("2026-10-18 10:00:00", time.UTC)},
+		{"10MI", dbModels.IntervalType_10MI, dbModels.UTCAnchor, at("2026-10-18 10:10:00", time.UTC), at("2026-10-18 10:00:00", time.UTC)},
+		{"15MI", dbModels.IntervalType_15MI, dbModels.UTCAnchor, at("2026-10-18 10:15:00", time.UTC), at("2026-10-18 10:00:00", time.UTC)},
+		{"30MI", dbModels.IntervalType_30MI, dbModels.UTCAnchor, at("2026-10-18 10:30:00", time.UTC), at("2026-10-18 10:00:00", time.UTC)},
+		{"1HR across year", dbModels.IntervalType_1HR, dbModels.UTCAnchor, at("2027-01-01 00:00:00", time.UTC), at("2026-12-31 23:00:00", time.UTC)},
+		{"1DY", dbModels.IntervalType_1DY, dbModels.UTCAnchor, at("2026-10-19 00:00:00", time.UTC), at("2026-10-18 00:00:00", time.UTC)},
+		{"1DY Taipei", dbModels.IntervalType_1DY, dbModels.Anchor{Location: taipei}, at("2026-10-19 00:00:00", taipei), at("2026-10-18 00:00:00", taipei)},
+		{"1DY Chicago overnight session", dbModels.IntervalType_1DY, dbModels.Anchor{Location: chicago, Offset: -7 * time.Hour},
+			at("2026-10-18 17:00:00", chicago), at("2026-10-17 17:00:00", chicago)},
+		{"5DY", dbModels.IntervalType_5DY, dbModels.UTCAnchor, at("2026-10-19 00:00:00", time.UTC), at("2026-10-14 00:00:00", time.UTC)},
+		{"1WK starts on Monday", dbModels.IntervalType_1WK, dbModels.UTCAnchor, at("2026-10-19 00:00:00", time.UTC), at("2026-10-12 00:00:00", time.UTC)},
+		{"1WK Taipei across year", dbModels.IntervalType_1WK, dbModels.Anchor{Location: taipei}, at("2027-01-04 00:00:00", taipei), at("2026-12-28 00:00:00", taipei)},
+		{"1MO", dbModels.IntervalType_1MO, dbModels.UTCAnchor, at("2026-11-01 00:00:00", time.UTC), at("2026-10-01 00:00:00", time.UTC)},
+		{"1MO across year", dbModels.IntervalType_1MO, dbModels.Anchor{Location: taipei}, at("2027-01-01 00:00:00", taipei), at("2026-12-01 00:00:00", taipei)},
+		{"1MO Chicago overnight session", dbModels.IntervalType_1MO, dbModels.Anchor{Location: chicago, Offset: -7 * time.Hour},
+			at("2026-10-31 17:00:00", chicago), at("2026-09-30 17:00:00", chicago)},
+		{"1YR", dbModels.IntervalType_1YR, dbModels.Anchor{Location: taipei}, at("2027-01-01 00:00:00", taipei), at("2026-01-01 00:00:00", taipei)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := tt.interval.Source()
+			first := tt.anchor.Truncate(source, tt.previous)
+			last := tt.anchor.Previous(source, tt.boundary)
+			after := tt.anchor.Truncate(source, tt.boundary)
+			if !first.Equal(tt.previous) || !after.Equal(tt.boundary) {
+				t.Fatalf("%s buckets are not aligned to the %s boundary", source.Name(), tt.interval.Name())
+			}
+
+			children := []dbModels.CandleModel{
+				child(1, source, first, 10, 11, 12, 9, 1),
+				child(1, source, last, 11, 20, 21, 5, 2),
+				child(1, source, after, 30, 31, 32, 29, 4),
+			}
+			got := Aggregate(tt.interval, children, tt.anchor)
+			if len(got) != 2 {
+				t.Fatalf("got %d candles, want 2", len(got))
+			}
+
+			closed, opened := got[0], got[1]
+			if !closed.Start.Equal(tt.previous) || !opened.Start.Equal(tt.boundary) {
+				t.Fatalf("starts %v and %v, want %v and %v", closed.Start, opened.Start, tt.previous, tt.boundary)
+			}
+			if next := tt.anchor.Next(tt.interval, closed.Start); !next.Equal(tt.boundary) {
+				t.Fatalf("Next = %v, want %v", next, tt.boundary)
+			}
+			if !closed.Open.Equal(decimal.NewFromInt(10)) || !closed.Close.Equal(decimal.NewFromInt(20)) ||
+				!closed.High.Equal(decimal.NewFromInt(21)) || !closed.Low.Equal(decimal.NewFromInt(5)) || !closed.Volume.Equal(decimal.NewFromInt(3)) {
+				t.Fatalf("closed bucket %+v", closed)
+			}
+			if !opened.Open.Equal(decimal.NewFromInt(30)) || !opened.Volume.Equal(decimal.NewFromInt(4)) {
+				t.Fatalf("opened bucket %+v", opened)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package aggregation
+
+import (
+	"time"
+
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+)
+
+// ChildrenGetter returns the stored candles of intervalType starting in [from, to).
+type ChildrenGetter func(intervalType dbModels.IntervalType, from, to time.Time) ([]dbModels.CandleModel, error)
+
+// Partials builds the forming candle of each interval for the bucket containing
+// now, with day and longer buckets aligned to anchor.
+// A forming candle is the aggregate of its finished children, read through get,
+// plus the forming candle of its source interval; forming1MI is the forming
+// minute itself, e.g. built from the latest quotes, and may be empty.
+// Finished children are stored a while after their bucket closed, those not
+// stored yet are built from the next finer stored interval, down to 1MI.
+func Partials(now time.Time, anchor dbModels.Anchor, intervalTypes []dbModels.IntervalType, forming1MI []dbModels.CandleModel, get ChildrenGetter) (map[dbModels.IntervalType][]dbModels.CandleModel, error) {
+
+	partials := map[dbModels.IntervalType][]dbModels.CandleModel{
+		dbModels.IntervalType_1MI: forming1MI,
+	}
+
+	var finished func(intervalType dbModels.IntervalType, from, to time.Time) ([]dbModels.CandleModel, error)
+	finished = func(intervalType dbModels.IntervalType, from, to time.Time) ([]dbModels.CandleModel, error) {
+
+		stored, err := get(intervalType, from, to)
+		if err != nil {
+			return nil, err
+		}
+		source := intervalType.Source()
+		if source == dbModels.IntervalType_None {
+			return stored, nil
+		}
+
+		// only the buckets after the last stored one of a product may be missing
+		have := map[bucketKey]bool{}
+		next := map[uint64]time.Time{}
+		for _, f := range forming1MI {
+			next[f.ProductID] = from
+		}
+		for _, m := range stored {
+			have[bucketKey{productID: m.ProductID, start: m.Start.UTC()}] = true
+			if n := anchor.Next(intervalType, m.Start); n.After(next[m.ProductID]) {
+				next[m.ProductID] = n
+			}
+		}
+		missingFrom := to
+		for _, n := range next {
+			if n.Before(missingFrom) {
+				missingFrom = n
+			}
+		}
+		if len(next) == 0 {
+			missingFrom = from
+		}
+		if !missingFrom.Before(to) {
+			return stored, nil
+		}
+
+		finer, err := finished(source, missingFrom, to)
+		if err != nil {
+			return nil, err
+		}
+		missing := []dbModels.CandleModel{}
+		for _, m := range finer {
+			if !have[bucketKey{productID: m.ProductID, start: anchor.Truncate(intervalType, m.Start).UTC()}] {
+				missing = append(missing, m)
+			}
+		}
+		for _, m := range Aggregate(intervalType, missing, anchor) {
+			stored = append(stored, *m)
+		}
+		return stored, nil
+	}
+
+	var build func(intervalType dbModels.IntervalType) error
+	build = func(intervalType dbModels.IntervalType) error {
+		if _, ok := partials[intervalType]; ok {
+			return nil
+		}
+
+		source := intervalType.Source()
+		if source == dbModels.IntervalType_None {
+			partials[intervalType] = []dbModels.CandleModel{}
+			return nil
+		}
+		if err := build(source); err != nil {
+			return err
+		}
+
+		children := []dbModels.CandleModel{}
+		from := anchor.Truncate(intervalType, now)
+		to := anchor.Truncate(source, now)
+		if from.Before(to) {
+			stored, err := finished(source, from, to)
+			if err != nil {
+				return err
+			}
+			children = stored
+		}
+		children = append(children, partials[source]...)
+
+		models := []dbModels.CandleModel{}
+		for _, m := range Aggregate(intervalType, children, anchor) {
+			models = append(models, *m)
+		}
+		partials[intervalType] = models
+		return nil
+	}
+
+	for _, i := range intervalTypes {
+		if err := build(i); err != nil {
+			return nil, err
+		}
+	}
+
+	return partials, nil
+}
@@ -0,0 +1,139 @@
+package aggregation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+)
+
+// storedCandles is a ChildrenGetter over candles stored so far.
+type storedCandles []dbModels.CandleModel
+
+func (s storedCandles) get(intervalType dbModels.IntervalType, from, to time.Time) ([]dbModels.CandleModel, error) {
+	result := []dbModels.CandleModel{}
+	for _, m := range s {
+		if m.IntervalType == intervalType && !m.Start.Before(from) && m.Start.Before(to) {
+			result = append(result, m)
+		}
+	}
+	return result, nil
+}
+
+// minutes returns n 1MI candles of productID from start on, each a little higher.
+func minutes(productID uint64, start time.Time, n int) []dbModels.CandleModel {
+	models := []dbModels.CandleModel{}
+	for i := 0; i < n; i++ {
+		price := int64(100 + i)
+		models = append(models, child(productID, dbModels.IntervalType_1MI, start.Add(time.Duration(i)*time.Minute), price, price+1, price+3, price-2, int64(i+1)))
+	}
+	return models
+}
+
+// rollUp stores the candles of intervalType built from the stored candles of its source.
+func rollUp(stored storedCandles, intervalType dbModels.IntervalType) storedCandles {
+	for _, m := range Aggregate(intervalType, stored, dbModels.UTCAnchor) {
+		stored = append(stored, *m)
+	}
+	return stored
+}
+
+// keep returns the stored candles keep reports true for.
+func (s storedCandles) keep(keep func(m *dbModels.CandleModel) bool) storedCandles {
+	result := storedCandles{}
+	for i := range s {
+		if keep(&s[i]) {
+			result = append(result, s[i])
+		}
+	}
+	return result
+}
+
+func assertPartial(t *testing.T, got []dbModels.CandleModel, want dbModels.CandleModel) {
+	t.Helper()
+	if len(got) != 1 {
+		t.Fatalf("got %d partial candles, want 1", len(got))
+	}
+	g := got[0]
+	if g.ProductID != want.ProductID || g.IntervalType != want.IntervalType || !g.Start.Equal(want.Start) ||
+		!g.Open.Equal(want.Open) || !g.Close.Equal(want.Close) || !g.High.Equal(want.High) || !g.Low.Equal(want.Low) || !g.Volume.Equal(want.Volume) {
+		t.Fatalf("partial %+v, want %+v", g, want)
+	}
+}
+
+// TestPartialsAfterBoundary asks for the forming 10MI candle at 10:05:10, when
+// the 5MI bucket of 10:00 closed but is not stored yet.
+func TestPartialsAfterBoundary(t *testing.T) {
+	base := at("2026-10-18 10:00:00", time.UTC)
+	now := base.Add(5*time.Minute + 10*time.Second)
+
+	stored := storedCandles(minutes(1, base, 5))
+	forming := []dbModels.CandleModel{child(1, dbModels.IntervalType_1MI, base.Add(5*time.Minute), 104, 90, 104, 90, 10)}
+
+	partials, err := Partials(now, dbModels.UTCAnchor, []dbModels.IntervalType{dbModels.IntervalType_10MI}, forming, stored.get)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 10:00 to 10:04 rise from 100 to 105, then the forming minute drops to 90
+	assertPartial(t, partials[dbModels.IntervalType_10MI], child(1, dbModels.IntervalType_10MI, base, 100, 90, 107, 90, 25))
+
+	// once stored, the 5MI candle is used as is
+	stored = rollUp(stored, dbModels.IntervalType_5MI).keep(func(m *dbModels.CandleModel) bool {
+		if m.IntervalType == dbModels.IntervalType_5MI {
+			m.High = m.High.Add(m.High)
+		}
+		return true
+	})
+	partials, err = Partials(now, dbModels.UTCAnchor, []dbModels.IntervalType{dbModels.IntervalType_10MI}, forming, stored.get)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertPartial(t, partials[dbModels.IntervalType_10MI], child(1, dbModels.IntervalType_10MI, base, 100, 90, 214, 90, 25))
+}
+
+// TestPartialsAfterBoundaries asks for the forming 1HR candle at 10:30:10,
+// when each interval it is built from lags behind the finer one.
+func TestPartialsAfterBoundaries(t *testing.T) {
+	base := at("2026-10-18 10:00:00", time.UTC)
+	now := base.Add(30*time.Minute + 10*time.Second)
+
+	all := storedCandles(minutes(1, base, 30))
+	all = append(all, minutes(2, base, 30)...)
+	all = rollUp(all, dbModels.IntervalType_5MI)
+	all = rollUp(all, dbModels.IntervalType_15MI)
+	all = rollUp(all, dbModels.IntervalType_30MI)
+
+	// 30MI 10:00 is missing, product 1 lacks 15MI 10:15 and 5MI 10:25 as well
+	stored := all.keep(func(m *dbModels.CandleModel) bool {
+		switch {
+		case m.IntervalType == dbModels.IntervalType_30MI:
+			return false
+		case m.ProductID == 1 && m.IntervalType == dbModels.IntervalType_15MI:
+			return m.Start.Before(base.Add(15 * time.Minute))
+		case m.ProductID == 1 && m.IntervalType == dbModels.IntervalType_5MI:
+			return m.Start.Before(base.Add(25 * time.Minute))
+		case m.ProductID == 2 && m.IntervalType == dbModels.IntervalType_15MI:
+			// the stored candles of product 2 are used as is
+			m.High = m.High.Add(m.High)
+		}
+		return true
+	})
+
+	forming := []dbModels.CandleModel{
+		child(1, dbModels.IntervalType_1MI, base.Add(30*time.Minute), 129, 90, 129, 90, 100),
+		child(2, dbModels.IntervalType_1MI, base.Add(30*time.Minute), 129, 90, 129, 90, 100),
+	}
+
+	partials, err := Partials(now, dbModels.UTCAnchor, []dbModels.IntervalType{dbModels.IntervalType_1HR}, forming, stored.get)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := partials[dbModels.IntervalType_1HR]
+	if len(got) != 2 {
+		t.Fatalf("got %d partial candles, want 2", len(got))
+	}
+	// 1 to 30 for the volume of the minutes, 100 for the forming one
+	assertPartial(t, got[:1], child(1, dbModels.IntervalType_1HR, base, 100, 90, 132, 90, 565))
+	// the doubled highs of the stored 15MI candles of product 2
+	assertPartial(t, got[1:], child(2, dbModels.IntervalType_1HR, base, 100, 90, 264, 90, 565))
+}
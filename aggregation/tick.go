@@ -0,0 +1,109 @@
+package aggregation
+
+import (
+	"sort"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	"github.com/shopspring/decimal"
+)
+
+const quoteTimeLayout = "150405"
+
+// Tick is a single price observation.
+type Tick struct {
+	At    time.Time
+	Price decimal.Decimal
+}
+
+// ParseQuoteTicks converts the HHMMSS keyed quotes returned by the quote
+// service into ticks. Each key is placed on the latest date not after to, so
+// windows up to 24 hours that cross midnight resolve correctly.
+// Keys that cannot be parsed are returned in invalid.
+func ParseQuoteTicks(quotes map[string]string, to time.Time) (ticks []Tick, invalid []string) {
+
+	ticks = []Tick{}
+	year, month, day := to.Date()
+
+	for k, v := range quotes {
+		quoteTime, err := time.Parse(quoteTimeLayout, k)
+		if err != nil {
+			invalid = append(invalid, k)
+			continue
+		}
+		price, err := decimal.NewFromString(v)
+		if err != nil {
+			invalid = append(invalid, k)
+			continue
+		}
+
+		at := time.Date(year, month, day, quoteTime.Hour(), quoteTime.Minute(), quoteTime.Second(), 0, to.Location())
+		if at.After(to) {
+			at = at.AddDate(0, 0, -1)
+		}
+		ticks = append(ticks, Tick{At: at, Price: price})
+	}
+
+	sort.Slice(ticks, func(i, j int) bool {
+		return ticks[i].At.Before(ticks[j].At)
+	})
+
+	return ticks, invalid
+}
+
+// FromTicks builds the 1MI candle starting at start from the ticks within
+// (start, start+1m]. seed, when not nil, is the fallback open/close price and
+// also bounds high/low; without a seed a minute with no tick returns nil.
+func FromTicks(productID uint64, start time.Time, ticks []Tick, seed *decimal.Decimal) *dbModels.CandleModel {
+
+	end := start.Add(time.Minute)
+
+	var model *dbModels.CandleModel
+	if seed != nil {
+		model = &dbModels.CandleModel{
+			ProductID:    productID,
+			IntervalType: dbModels.IntervalType_1MI,
+			Start:        start,
+			Open:         *seed,
+			Close:        *seed,
+			High:         *seed,
+			Low:          *seed,
+		}
+	}
+
+	opened := false
+	for _, t := range ticks {
+		if !t.At.After(start) || t.At.After(end) {
+			continue
+		}
+
+		if model == nil {
+			model = &dbModels.CandleModel{
+				ProductID:    productID,
+				IntervalType: dbModels.IntervalType_1MI,
+				Start:        start,
+				High:         t.Price,
+				Low:          t.Price,
+			}
+		}
+
+		if !opened && t.At.Before(end) {
+			model.Open = t.Price
+			opened = true
+		}
+		model.Close = t.Price
+
+		if t.Price.GreaterThan(model.High) {
+			model.High = t.Price
+		}
+		if t.Price.LessThan(model.Low) {
+			model.Low = t.Price
+		}
+	}
+
+	if model != nil && !opened && seed == nil {
+		model.Open = model.Close
+	}
+
+	return model
+}
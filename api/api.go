@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/paper-trade-chatbot/be-candle/correction"
+	"github.com/paper-trade-chatbot/be-candle/cronjob"
+	"github.com/paper-trade-chatbot/be-candle/dao/candleDao"
+	"github.com/paper-trade-chatbot/be-candle/retention"
+	"github.com/paper-trade-chatbot/be-candle/seriesCache"
+	"github.com/paper-trade-chatbot/be-candle/service/backfill"
+	"github.com/paper-trade-chatbot/be-candle/service/candle"
+	"github.com/paper-trade-chatbot/be-candle/service/indicator"
+	"github.com/paper-trade-chatbot/be-candle/service/volume"
+	commonApi "github.com/paper-trade-chatbot/be-common/api"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Initialize registers the candle HTTP handlers on the common router.
+func Initialize(ctx context.Context, candleIntf candle.CandleIntf, backfillIntf backfill.BackfillIntf, indicatorIntf indicator.IndicatorIntf, volumeIntf volume.VolumeIntf, seriesCacheInstance *seriesCache.SeriesCache, registry *cronjob.Registry, corrector *correction.Corrector, store candleDao.CandleStore, retainer *retention.Retainer) {
+
+	root := commonApi.GetRoot()
+	candleGroup := root.Group("candle")
+
+	candleHandler := &CandleHandler{CandleIntf: candleIntf}
+	candleGroup.GET("latest", candleHandler.GetLatestCandles)
+	candleGroup.POST("batch", candleHandler.GetCandlesBatch)
+
+	backfillHandler := &BackfillHandler{BackfillIntf: backfillIntf}
+	backfillGroup := candleGroup.Group("backfill")
+	backfillGroup.POST("", backfillHandler.Backfill)
+	backfillGroup.GET("", backfillHandler.GetProgress)
+
+	indicatorHandler := &IndicatorHandler{IndicatorIntf: indicatorIntf}
+	candleGroup.POST("indicators", indicatorHandler.GetIndicators)
+
+	volumeHandler := &VolumeHandler{VolumeIntf: volumeIntf}
+	candleGroup.POST("volumes", volumeHandler.AddVolumeTicks)
+
+	cacheHandler := &CacheHandler{SeriesCache: seriesCacheInstance}
+	candleGroup.GET("cache/stats", cacheHandler.GetStats)
+
+	cronjobHandler := &CronjobHandler{Registry: registry}
+	cronjobGroup := candleGroup.Group("cronjobs")
+	cronjobGroup.GET("", cronjobHandler.GetStatuses)
+	cronjobGroup.POST(":name/trigger", cronjobHandler.Trigger)
+
+	correctionHandler := &CorrectionHandler{Corrector: corrector, Store: store}
+	candleGroup.POST("corrections", correctionHandler.Correct)
+
+	retentionHandler := &RetentionHandler{Retainer: retainer}
+	candleGroup.GET("retention/preview", retentionHandler.Preview)
+
+	logging.Info(ctx, "candle api registered")
+}
+
+// respondWithError responds with the grpc status of err, mapped to an HTTP status.
+func respondWithError(ctx *gin.Context, err error) {
+	requestID, _ := ctx.Value(logging.ContextKeyRequestId).(string)
+
+	statusCode := http.StatusInternalServerError
+	if s, ok := status.FromError(err); ok {
+		switch s.Code() {
+		case codes.InvalidArgument, codes.OutOfRange:
+			statusCode = http.StatusBadRequest
+		case codes.NotFound:
+			statusCode = http.StatusNotFound
+		case codes.Unimplemented:
+			statusCode = http.StatusNotImplemented
+		default:
+			if s.Code() > codes.Unauthenticated {
+				// business error codes from be-common
+				statusCode = http.StatusBadRequest
+			}
+		}
+	}
+
+	logging.Error(ctx, "[api] %s error: %v", ctx.FullPath(), err)
+	ctx.AbortWithStatusJSON(statusCode, gin.H{
+		"error":      err.Error(),
+		"request_id": requestID,
+	})
+}
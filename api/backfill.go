@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/paper-trade-chatbot/be-candle/service/backfill"
+	common "github.com/paper-trade-chatbot/be-common"
+	"github.com/paper-trade-chatbot/be-common/logging"
+)
+
+type BackfillHandler struct {
+	BackfillIntf backfill.BackfillIntf
+}
+
+type BackfillReq struct {
+	ProductIDs []uint64 `json:"productIDs"`
+	From       int64    `json:"from"`
+	To         int64    `json:"to"`
+}
+
+type GetProgressReq struct {
+	ProductIDs []uint64 `form:"productID"`
+}
+
+// Backfill starts rebuilding missing 1MI candles and returns immediately.
+func (h *BackfillHandler) Backfill(ctx *gin.Context) {
+
+	req := &BackfillReq{}
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		respondWithError(ctx, common.ErrInvalidParam)
+		return
+	}
+
+	from := time.Unix(req.From, 0).Truncate(time.Minute)
+	to := time.Unix(req.To, 0).Truncate(time.Minute)
+	if err := backfill.ValidateWindow(from, to); err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	// the request context ends with the response
+	requestID, _ := ctx.Value(logging.ContextKeyRequestId).(string)
+	backfillCtx := context.WithValue(context.Background(), logging.ContextKeyRequestId, requestID)
+	go func() {
+		if err := h.BackfillIntf.Backfill(backfillCtx, req.ProductIDs, from, to); err != nil {
+			logging.Error(backfillCtx, "[Backfill] error: %v", err)
+		}
+	}()
+
+	ctx.JSON(http.StatusAccepted, gin.H{
+		"from": from.Unix(),
+		"to":   to.Unix(),
+	})
+}
+
+// GetProgress reports the backfill progress per product.
+func (h *BackfillHandler) GetProgress(ctx *gin.Context) {
+
+	req := &GetProgressReq{}
+	if err := ctx.ShouldBindQuery(req); err != nil {
+		respondWithError(ctx, common.ErrInvalidParam)
+		return
+	}
+
+	progress, err := h.BackfillIntf.GetProgress(ctx, req.ProductIDs)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"progress": progress,
+	})
+}
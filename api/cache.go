@@ -0,0 +1,17 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/paper-trade-chatbot/be-candle/seriesCache"
+)
+
+type CacheHandler struct {
+	SeriesCache *seriesCache.SeriesCache
+}
+
+// GetStats reports the hits and misses of the candle cache since start.
+func (h *CacheHandler) GetStats(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, h.SeriesCache.Stats())
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/paper-trade-chatbot/be-candle/service/candle"
+	common "github.com/paper-trade-chatbot/be-common"
+)
+
+type CandleHandler struct {
+	CandleIntf candle.CandleIntf
+}
+
+// GetLatestCandles returns the latest candles of each product, e.g.
+// GET /candle/latest?productID=1&productID=2&intervalType=21&count=200
+func (h *CandleHandler) GetLatestCandles(ctx *gin.Context) {
+
+	req := &candle.GetLatestCandlesReq{}
+	if err := ctx.ShouldBindQuery(req); err != nil {
+		respondWithError(ctx, common.ErrInvalidParam)
+		return
+	}
+
+	res, err := h.CandleIntf.GetLatestCandles(ctx, req)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, res)
+}
+
+// GetCandlesBatch runs several product/interval queries in one request.
+func (h *CandleHandler) GetCandlesBatch(ctx *gin.Context) {
+
+	req := &candle.GetCandlesBatchReq{}
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		respondWithError(ctx, common.ErrInvalidParam)
+		return
+	}
+
+	res, err := h.CandleIntf.GetCandlesBatch(ctx, req)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, res)
+}
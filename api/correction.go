@@ -0,0 +1,96 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/paper-trade-chatbot/be-candle/correction"
+	"github.com/paper-trade-chatbot/be-candle/dao/candleDao"
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	common "github.com/paper-trade-chatbot/be-common"
+	"github.com/shopspring/decimal"
+)
+
+type CorrectionHandler struct {
+	Corrector *correction.Corrector
+	Store     candleDao.CandleStore
+}
+
+// CorrectedCandle replaces the stored 1MI candle starting at Start, in unix seconds.
+type CorrectedCandle struct {
+	ProductID uint64          `json:"productID"`
+	Start     int64           `json:"start"`
+	Open      decimal.Decimal `json:"open"`
+	Close     decimal.Decimal `json:"close"`
+	High      decimal.Decimal `json:"high"`
+	Low       decimal.Decimal `json:"low"`
+	Volume    decimal.Decimal `json:"volume"`
+}
+
+type CorrectReq struct {
+	Candles []*CorrectedCandle `json:"candles"`
+	Ticks   []*correction.Tick `json:"ticks"`
+}
+
+type CorrectRes struct {
+	Candles *correction.Result `json:"candles"`
+	Ticks   *correction.Result `json:"ticks"`
+}
+
+// Correct re-finalizes 1MI candles within the grace window, from corrected
+// candles replacing the stored ones or from late ticks extending them, and
+// recomputes the aggregated candles built from them.
+func (h *CorrectionHandler) Correct(ctx *gin.Context) {
+
+	req := &CorrectReq{}
+	if err := ctx.ShouldBindJSON(req); err != nil || len(req.Candles)+len(req.Ticks) == 0 {
+		respondWithError(ctx, common.ErrInvalidParam)
+		return
+	}
+
+	candles := []*dbModels.CandleModel{}
+	for _, c := range req.Candles {
+		if c.ProductID == 0 || c.High.LessThan(c.Low) || c.Volume.IsNegative() {
+			respondWithError(ctx, common.ErrInvalidParam)
+			return
+		}
+		candles = append(candles, &dbModels.CandleModel{
+			ProductID:    c.ProductID,
+			IntervalType: dbModels.IntervalType_1MI,
+			Start:        time.Unix(c.Start, 0),
+			Open:         c.Open,
+			Close:        c.Close,
+			High:         c.High,
+			Low:          c.Low,
+			Volume:       c.Volume,
+		})
+	}
+	for _, t := range req.Ticks {
+		if !t.Valid() {
+			respondWithError(ctx, common.ErrInvalidParam)
+			return
+		}
+	}
+
+	res := &CorrectRes{
+		Candles: &correction.Result{},
+		Ticks:   &correction.Result{},
+	}
+
+	var err error
+	if len(candles) > 0 {
+		if res.Candles, err = h.Corrector.Correct(ctx, h.Store, candles, candleDao.ConflictMode_Overwrite); err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+	}
+	if len(req.Ticks) > 0 {
+		if res.Ticks, err = h.Corrector.Correct(ctx, h.Store, correction.MinutesOfTicks(req.Ticks), candleDao.ConflictMode_Extend); err != nil {
+			respondWithError(ctx, err)
+			return
+		}
+	}
+
+	ctx.JSON(http.StatusOK, res)
+}
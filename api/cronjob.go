@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/paper-trade-chatbot/be-candle/cronjob"
+)
+
+type CronjobHandler struct {
+	Registry *cronjob.Registry
+}
+
+// GetStatuses lists the cronjobs with their last run on this instance.
+func (h *CronjobHandler) GetStatuses(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{
+		"cronjobs": h.Registry.Statuses(),
+	})
+}
+
+// Trigger runs a cronjob now and returns immediately.
+func (h *CronjobHandler) Trigger(ctx *gin.Context) {
+
+	name := ctx.Param("name")
+	if err := h.Registry.Trigger(name); err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, gin.H{
+		"name": name,
+	})
+}
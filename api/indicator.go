@@ -0,0 +1,31 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/paper-trade-chatbot/be-candle/service/indicator"
+	common "github.com/paper-trade-chatbot/be-common"
+)
+
+type IndicatorHandler struct {
+	IndicatorIntf indicator.IndicatorIntf
+}
+
+// GetIndicators computes technical indicators over stored candles.
+func (h *IndicatorHandler) GetIndicators(ctx *gin.Context) {
+
+	req := &indicator.GetIndicatorsReq{}
+	if err := ctx.ShouldBindJSON(req); err != nil {
+		respondWithError(ctx, common.ErrInvalidParam)
+		return
+	}
+
+	res, err := h.IndicatorIntf.GetIndicators(ctx, req)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/paper-trade-chatbot/be-candle/retention"
+)
+
+type RetentionHandler struct {
+	Retainer *retention.Retainer
+}
+
+// Preview reports what the applyRetention cronjob would delete and downsample
+// now, without changing anything.
+func (h *RetentionHandler) Preview(ctx *gin.Context) {
+
+	report, err := h.Retainer.Apply(ctx, time.Now(), true)
+	if err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, report)
+}
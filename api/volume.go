@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/paper-trade-chatbot/be-candle/service/volume"
+	common "github.com/paper-trade-chatbot/be-common"
+)
+
+type VolumeHandler struct {
+	VolumeIntf volume.VolumeIntf
+}
+
+type AddVolumeTicksReq struct {
+	Ticks []*volume.Tick `json:"ticks"`
+}
+
+// AddVolumeTicks accepts trade sizes from the quote service and paper-trading fills.
+func (h *VolumeHandler) AddVolumeTicks(ctx *gin.Context) {
+
+	req := &AddVolumeTicksReq{}
+	if err := ctx.ShouldBindJSON(req); err != nil || len(req.Ticks) == 0 {
+		respondWithError(ctx, common.ErrInvalidParam)
+		return
+	}
+	for _, t := range req.Ticks {
+		if !volume.ValidateTick(t) {
+			respondWithError(ctx, common.ErrInvalidParam)
+			return
+		}
+	}
+
+	if err := h.VolumeIntf.AddTicks(ctx, req.Ticks); err != nil {
+		respondWithError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"total": len(req.Ticks),
+	})
+}
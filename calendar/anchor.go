@@ -0,0 +1,129 @@
+package calendar
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+)
+
+var ErrInvalidAnchor = errors.New("invalid anchor")
+
+// anchorOverrides replaces the anchor of exchanges or products.
+type anchorOverrides struct {
+	exchanges map[string]*anchorOverride
+	products  map[uint64]*anchorOverride
+}
+
+// anchorOverride keeps the calendar's location if Location is nil
+type anchorOverride struct {
+	Location *time.Location
+	Offset   time.Duration
+}
+
+// parseAnchorOverrides parses comma separated entries of
+//
+//	exchange:<code>=<location>@<[-]HH:MM>
+//	product:<id>=<location>@<[-]HH:MM>
+//
+// where either side of @ may be empty, e.g. exchange:TWSE=Asia/Taipei or
+// product:12=@-07:00. Offsets must be multiples of 15 minutes, as day candles
+// are built from 15MI candles.
+func parseAnchorOverrides(raw string) (*anchorOverrides, error) {
+
+	overrides := &anchorOverrides{
+		exchanges: map[string]*anchorOverride{},
+		products:  map[uint64]*anchorOverride{},
+	}
+
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		keyValue := strings.SplitN(entry, "=", 2)
+		kindKey := strings.SplitN(keyValue[0], ":", 2)
+		if len(keyValue) != 2 || len(kindKey) != 2 {
+			return nil, ErrInvalidAnchor
+		}
+
+		override, err := parseAnchorOverride(keyValue[1])
+		if err != nil {
+			return nil, err
+		}
+
+		switch kindKey[0] {
+		case "exchange":
+			overrides.exchanges[kindKey[1]] = override
+		case "product":
+			productID, err := strconv.ParseUint(kindKey[1], 10, 64)
+			if err != nil {
+				return nil, ErrInvalidAnchor
+			}
+			overrides.products[productID] = override
+		default:
+			return nil, ErrInvalidAnchor
+		}
+	}
+
+	return overrides, nil
+}
+
+func parseAnchorOverride(value string) (*anchorOverride, error) {
+
+	override := &anchorOverride{}
+	locationOffset := strings.SplitN(value, "@", 2)
+
+	if locationOffset[0] != "" {
+		loc, err := time.LoadLocation(locationOffset[0])
+		if err != nil {
+			return nil, ErrInvalidAnchor
+		}
+		override.Location = loc
+	}
+
+	if len(locationOffset) == 2 && locationOffset[1] != "" {
+		offset := locationOffset[1]
+		negative := strings.HasPrefix(offset, "-")
+		clock, err := time.Parse("15:04", strings.TrimPrefix(offset, "-"))
+		if err != nil {
+			return nil, ErrInvalidAnchor
+		}
+		override.Offset = time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute
+		if negative {
+			override.Offset = -override.Offset
+		}
+		if override.Offset%(time.Minute*15) != 0 {
+			return nil, ErrInvalidAnchor
+		}
+	}
+
+	return override, nil
+}
+
+// apply returns c with the override of the product or its exchange, c itself if none.
+func (o *anchorOverrides) apply(c *Calendar, productID uint64) *Calendar {
+
+	override, ok := o.products[productID]
+	if !ok {
+		override, ok = o.exchanges[c.ExchangeCode]
+	}
+	if !ok {
+		return c
+	}
+
+	anchor := dbModels.Anchor{
+		Location: c.Anchor.Location,
+		Offset:   override.Offset,
+	}
+	if override.Location != nil {
+		anchor.Location = override.Location
+	}
+
+	copied := *c
+	copied.Anchor = anchor
+	return &copied
+}
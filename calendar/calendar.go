@@ -0,0 +1,195 @@
+package calendar
+
+import (
+	"time"
+
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	"github.com/paper-trade-chatbot/be-proto/product"
+)
+
+const day = time.Hour * 24
+
+// Period is an absolute time range [Start, End).
+type Period struct {
+	Start time.Time
+	End   time.Time
+}
+
+func (p Period) Contains(t time.Time) bool {
+	return !t.Before(p.Start) && t.Before(p.End)
+}
+
+// Calendar is the trading calendar of an exchange.
+type Calendar struct {
+	ExchangeCode string
+	Location     *time.Location
+
+	// session hours as local time of day, Close before Open for overnight sessions
+	AllDay bool
+	Open   time.Duration
+	Close  time.Duration
+
+	// trading weekdays from StartDay to EndDay, wrapping after Saturday
+	EveryDay bool
+	StartDay time.Weekday
+	EndDay   time.Weekday
+
+	Trade     []Period // extra trading periods
+	StopTrade []Period // holidays and half days
+
+	// alignment of day and longer candles
+	Anchor dbModels.Anchor
+}
+
+// UTC is the calendar of products whose exchange is unknown: always open, UTC days.
+var UTC = &Calendar{
+	Location: time.UTC,
+	AllDay:   true,
+	EveryDay: true,
+	Anchor:   dbModels.UTCAnchor,
+}
+
+// FromExchange builds the calendar of an exchange. The location falls back to
+// the fixed timezone offset if it is not a known IANA name. Open/close times
+// are seconds since local midnight; unix timestamps are reduced to their local
+// time of day. Without open/close the exchange trades all day, without
+// exchange days every day. Day candles start at local midnight, or at the
+// session open of the evening before for overnight sessions if it falls on a
+// bucket of the candles day candles are rolled up from, 15MI.
+func FromExchange(e *product.Exchange) *Calendar {
+
+	c := &Calendar{
+		ExchangeCode: e.GetCode(),
+		Location:     time.FixedZone(e.GetCode(), int(e.GetTimezoneOffset()*3600)),
+		AllDay:       true,
+		EveryDay:     true,
+	}
+
+	if e.GetLocation() != "" {
+		if loc, err := time.LoadLocation(e.GetLocation()); err == nil {
+			c.Location = loc
+		}
+	}
+
+	if e.OpenTime != nil && e.CloseTime != nil && e.GetOpenTime() != e.GetCloseTime() {
+		c.AllDay = false
+		c.Open = c.timeOfDay(e.GetOpenTime())
+		c.Close = c.timeOfDay(e.GetCloseTime())
+	}
+
+	if d := e.GetExchangeDay(); d != nil && !(d.GetStartDay() == 0 && d.GetEndDay() == 0) {
+		c.EveryDay = false
+		c.StartDay = time.Weekday(d.GetStartDay() % 7)
+		c.EndDay = time.Weekday(d.GetEndDay() % 7)
+	}
+
+	c.Anchor = dbModels.Anchor{Location: c.Location}
+	if !c.AllDay && c.Close <= c.Open {
+		// an open like 17:05 would split 15MI buckets between two days, such sessions keep midnight
+		if offset := c.Open - day; offset%dbModels.IntervalType_1DY.Source().Duration() == 0 {
+			c.Anchor.Offset = offset
+		}
+	}
+
+	for _, t := range e.GetExceptionTime().GetTrade() {
+		c.Trade = append(c.Trade, Period{Start: time.Unix(t.GetStart(), 0), End: time.Unix(t.GetEnd(), 0)})
+	}
+	for _, t := range e.GetExceptionTime().GetStopTrade() {
+		c.StopTrade = append(c.StopTrade, Period{Start: time.Unix(t.GetStart(), 0), End: time.Unix(t.GetEnd(), 0)})
+	}
+
+	return c
+}
+
+// IsOpen reports whether the exchange trades at t.
+func (c *Calendar) IsOpen(t time.Time) bool {
+
+	for _, p := range c.StopTrade {
+		if p.Contains(t) {
+			return false
+		}
+	}
+	for _, p := range c.Trade {
+		if p.Contains(t) {
+			return true
+		}
+	}
+
+	local := t.In(c.Location)
+	midnight := c.Midnight(local)
+	if c.AllDay {
+		return c.isTradingWeekday(midnight.Weekday())
+	}
+
+	tod := local.Sub(midnight)
+	if c.Open < c.Close {
+		return c.isTradingWeekday(midnight.Weekday()) && tod >= c.Open && tod < c.Close
+	}
+
+	// overnight session, it belongs to the day it opened on
+	if tod >= c.Open {
+		return c.isTradingWeekday(midnight.Weekday())
+	}
+	if tod < c.Close {
+		return c.isTradingWeekday(midnight.AddDate(0, 0, -1).Weekday())
+	}
+	return false
+}
+
+// Session returns the session opening on the local date of t.
+func (c *Calendar) Session(t time.Time) Period {
+	midnight := c.Midnight(t.In(c.Location))
+	if c.AllDay {
+		return Period{Start: midnight, End: midnight.AddDate(0, 0, 1)}
+	}
+	end := midnight.Add(c.Close)
+	if c.Close <= c.Open {
+		end = midnight.AddDate(0, 0, 1).Add(c.Close)
+	}
+	return Period{Start: midnight.Add(c.Open), End: end}
+}
+
+// IsTradingDay reports whether a session opens on the local date of t and is
+// not entirely cancelled by a holiday.
+func (c *Calendar) IsTradingDay(t time.Time) bool {
+
+	session := c.Session(t)
+	for _, p := range c.Trade {
+		if p.Start.Before(session.End) && session.Start.Before(p.End) {
+			return true
+		}
+	}
+	if !c.isTradingWeekday(c.Midnight(t.In(c.Location)).Weekday()) {
+		return false
+	}
+	for _, p := range c.StopTrade {
+		if !session.Start.Before(p.Start) && !p.End.Before(session.End) {
+			return false
+		}
+	}
+	return true
+}
+
+// Midnight returns the local midnight of the date of t, t must be in c.Location.
+func (c *Calendar) Midnight(t time.Time) time.Time {
+	year, month, date := t.Date()
+	return time.Date(year, month, date, 0, 0, 0, 0, c.Location)
+}
+
+func (c *Calendar) isTradingWeekday(w time.Weekday) bool {
+	if c.EveryDay {
+		return true
+	}
+	if c.StartDay <= c.EndDay {
+		return w >= c.StartDay && w <= c.EndDay
+	}
+	return w >= c.StartDay || w <= c.EndDay
+}
+
+func (c *Calendar) timeOfDay(v int64) time.Duration {
+	if v < int64(day/time.Second) {
+		return time.Duration(v) * time.Second
+	}
+	local := time.Unix(v, 0).In(c.Location)
+	return local.Sub(c.Midnight(local))
+}
@@ -0,0 +1,31 @@
+package calendar
+
+import (
+	"testing"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-proto/product"
+)
+
+func TestFromExchangeOvernightAnchor(t *testing.T) {
+	tests := []struct {
+		name   string
+		open   time.Duration
+		close  time.Duration
+		offset time.Duration
+	}{
+		{"day session keeps midnight", 9 * time.Hour, 16 * time.Hour, 0},
+		{"overnight session opens the evening before", 17 * time.Hour, 16 * time.Hour, -7 * time.Hour},
+		{"overnight open on a quarter hour", 17*time.Hour + 45*time.Minute, 16 * time.Hour, -6*time.Hour - 15*time.Minute},
+		{"overnight open off the quarter hours keeps midnight", 17*time.Hour + 5*time.Minute, 16 * time.Hour, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			open, close := int64(tt.open/time.Second), int64(tt.close/time.Second)
+			c := FromExchange(&product.Exchange{Code: "X", OpenTime: &open, CloseTime: &close})
+			if c.Anchor.Offset != tt.offset {
+				t.Fatalf("Offset = %v, want %v", c.Anchor.Offset, tt.offset)
+			}
+		})
+	}
+}
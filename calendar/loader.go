@@ -0,0 +1,126 @@
+package calendar
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-candle/service"
+	"github.com/paper-trade-chatbot/be-common/config"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/paper-trade-chatbot/be-common/pagination"
+	"github.com/paper-trade-chatbot/be-proto/product"
+)
+
+// the generator asks every minute, so products are at most one run stale
+const refreshInterval = time.Minute
+
+var (
+	lock             sync.RWMutex
+	productCalendars map[uint64]*Calendar
+	loadedAt         time.Time
+)
+
+// GetProductCalendars returns the calendar of every enabled product, UTC for
+// products whose exchange is unknown, with the anchors of CANDLE_ANCHORS
+// applied. A stale copy is returned if refreshing fails.
+func GetProductCalendars(ctx context.Context) (map[uint64]*Calendar, error) {
+
+	lock.RLock()
+	cached, at := productCalendars, loadedAt
+	lock.RUnlock()
+
+	if cached != nil && time.Since(at) < refreshInterval {
+		return cached, nil
+	}
+
+	loaded, err := loadProductCalendars(ctx)
+	if err != nil {
+		if cached != nil {
+			logging.Warn(ctx, "[GetProductCalendars] use stale calendars: %v", err)
+			return cached, nil
+		}
+		return nil, err
+	}
+
+	lock.Lock()
+	productCalendars, loadedAt = loaded, time.Now()
+	lock.Unlock()
+
+	return loaded, nil
+}
+
+// Of returns the calendar of the product, UTC if unknown.
+func Of(calendars map[uint64]*Calendar, productID uint64) *Calendar {
+	if c, ok := calendars[productID]; ok && c != nil {
+		return c
+	}
+	return UTC
+}
+
+func loadProductCalendars(ctx context.Context) (map[uint64]*Calendar, error) {
+
+	exchangeRes, err := pagination.IteratePageGRPC[*product.GetExchangesReq, *product.GetExchangesRes](
+		&product.GetExchangesReq{
+			Pagination: pagination.NewPagination(3000),
+		},
+		func(req *product.GetExchangesReq) (*product.GetExchangesRes, error) {
+			exchangeData, err := service.Impl.ProductIntf.GetExchanges(ctx, req)
+			if err != nil {
+				logging.Error(ctx, "[loadProductCalendars] GetExchanges err: %v", err)
+				return nil, err
+			}
+			return exchangeData, nil
+		},
+	)
+	if err != nil {
+		logging.Error(ctx, "[loadProductCalendars] IteratePage exchanges err: %v", err)
+		return nil, err
+	}
+
+	exchanges := map[string]*Calendar{}
+	for _, r := range exchangeRes {
+		for _, e := range r.Exchange {
+			exchanges[e.Code] = FromExchange(e)
+		}
+	}
+
+	enabled := product.Status_Status_Enabled
+	productRes, err := pagination.IteratePageGRPC[*product.GetProductsReq, *product.GetProductsRes](
+		&product.GetProductsReq{
+			Status:     &enabled,
+			Pagination: pagination.NewPagination(3000),
+		},
+		func(req *product.GetProductsReq) (*product.GetProductsRes, error) {
+			productData, err := service.Impl.ProductIntf.GetProducts(ctx, req)
+			if err != nil {
+				logging.Error(ctx, "[loadProductCalendars] GetProducts err: %v", err)
+				return nil, err
+			}
+			return productData, nil
+		},
+	)
+	if err != nil {
+		logging.Error(ctx, "[loadProductCalendars] IteratePage products err: %v", err)
+		return nil, err
+	}
+
+	overrides, err := parseAnchorOverrides(config.GetString("CANDLE_ANCHORS"))
+	if err != nil {
+		logging.Error(ctx, "[loadProductCalendars] CANDLE_ANCHORS err: %v", err)
+		return nil, err
+	}
+
+	calendars := map[uint64]*Calendar{}
+	for _, r := range productRes {
+		for _, p := range r.Product {
+			c, ok := exchanges[p.ExchangeCode]
+			if !ok {
+				c = UTC
+			}
+			calendars[uint64(p.Id)] = overrides.apply(c, uint64(p.Id))
+		}
+	}
+
+	return calendars, nil
+}
@@ -0,0 +1,281 @@
+package correction
+
+import (
+	"context"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-candle/aggregation"
+	"github.com/paper-trade-chatbot/be-candle/calendar"
+	"github.com/paper-trade-chatbot/be-candle/cronjob/lease"
+	"github.com/paper-trade-chatbot/be-candle/dao/candleDao"
+	"github.com/paper-trade-chatbot/be-candle/hub"
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	"github.com/paper-trade-chatbot/be-candle/seriesCache"
+	"github.com/paper-trade-chatbot/be-common/config"
+	"github.com/paper-trade-chatbot/be-common/logging"
+)
+
+// Result counts what a correction changed. Rejected candles were not 1MI or
+// ended before the grace window.
+type Result struct {
+	Corrected  int `json:"corrected"`  // 1MI candles stored or changed
+	Recomputed int `json:"recomputed"` // aggregated candles stored, changed or deleted
+	Rejected   int `json:"rejected"`
+}
+
+// Corrector re-finalizes 1MI candles which ended at most Grace ago, e.g. after
+// late ticks or from corrected candles, then recomputes every closed
+// aggregated candle built from them. A stored candle whose values change gets
+// the next revision, so clients can tell an amended bar from the original.
+type Corrector struct {
+	Grace time.Duration
+}
+
+var correctorInstance *Corrector
+
+// Initialize creates the global corrector with CANDLE_CORRECTION_GRACE_MINUTES.
+func Initialize(ctx context.Context) {
+	correctorInstance = New(time.Duration(config.GetInt("CANDLE_CORRECTION_GRACE_MINUTES")) * time.Minute)
+	logging.Info(ctx, "candle correction grace: %v", correctorInstance.Grace)
+}
+
+// GetCorrector returns the global corrector.
+func GetCorrector() *Corrector {
+	return correctorInstance
+}
+
+func New(grace time.Duration) *Corrector {
+	return &Corrector{
+		Grace: grace,
+	}
+}
+
+// Within reports whether the 1MI candle starting at start ended, at most Grace before now.
+func (c *Corrector) Within(start, now time.Time) bool {
+	end := start.Add(time.Minute)
+	return !end.After(now) && !end.Before(now.Add(-c.Grace))
+}
+
+// Correct stores models, 1MI candles within the grace window, resolving the
+// stored ones with mode: ConflictMode_Overwrite for corrected candles,
+// ConflictMode_Extend for candles built from late ticks, whose time within the
+// minute is unknown relative to the stored open and close.
+func (c *Corrector) Correct(ctx context.Context, store candleDao.CandleStore, models []*dbModels.CandleModel, mode candleDao.ConflictMode) (*Result, error) {
+
+	now := time.Now()
+	result := &Result{}
+
+	accepted := []*dbModels.CandleModel{}
+	for _, m := range models {
+		if m.IntervalType != dbModels.IntervalType_1MI || !c.Within(m.Start, now) {
+			result.Rejected++
+			continue
+		}
+		accepted = append(accepted, m)
+	}
+	if len(accepted) == 0 {
+		return result, nil
+	}
+
+	if err := lease.CheckFencing(ctx); err != nil {
+		logging.Error(ctx, "[Correct] CheckFencing err: %v", err)
+		return nil, err
+	}
+	upserted, err := store.Upserts(accepted, mode)
+	if err != nil {
+		logging.Error(ctx, "[Correct] upserts error: %v", err)
+		return nil, err
+	}
+	seriesCache.GetCache().Stored(ctx, accepted, mode, upserted)
+	result.Corrected = upserted.Inserted + len(upserted.Revised)
+
+	stored, err := store.GetsByKeys(accepted)
+	if err != nil {
+		logging.Error(ctx, "[Correct] GetsByKeys error: %v", err)
+		return nil, err
+	}
+	hub.GetHub().Publish(stored, true)
+
+	recomputed, err := Recompute(ctx, store, stored, now)
+	if err != nil {
+		return nil, err
+	}
+	result.Recomputed = len(recomputed)
+
+	logging.Info(ctx, "[Correct] corrected: %d, recomputed: %d, rejected: %d", result.Corrected, result.Recomputed, result.Rejected)
+	return result, nil
+}
+
+type bucketKey struct {
+	productID uint64
+	start     int64
+}
+
+// Recompute rebuilds every aggregated candle built from one of the changed
+// candles whose bucket closed by now, from fine to coarse. A bucket left
+// without children is deleted. Buckets still forming are left to the
+// generateAggregatedCandle cronjob. Returns the aggregated candles stored,
+// changed or deleted.
+func Recompute(ctx context.Context, store candleDao.CandleStore, changed []*dbModels.CandleModel, now time.Time) ([]*candleDao.Change, error) {
+	return recompute(ctx, store, changed, now, true)
+}
+
+// RecomputeInTransaction recomputes like Recompute through tx, a store within
+// a transaction, but leaves the cache and the hub alone since the transaction
+// may still roll back. Pass the changes to Recomputed once it committed.
+func RecomputeInTransaction(ctx context.Context, tx candleDao.CandleStore, changed []*dbModels.CandleModel, now time.Time) ([]*candleDao.Change, error) {
+	return recompute(ctx, tx, changed, now, false)
+}
+
+// Recomputed invalidates the cached series of changes returned by
+// RecomputeInTransaction and publishes the candles stored.
+func Recomputed(ctx context.Context, changes []*candleDao.Change) {
+
+	changed := []*dbModels.CandleModel{}
+	published := []*dbModels.CandleModel{}
+	for _, c := range changes {
+		if c.New != nil {
+			changed = append(changed, c.New)
+			published = append(published, c.New)
+		} else {
+			changed = append(changed, c.Old)
+		}
+	}
+	seriesCache.GetCache().Invalidate(ctx, changed)
+	if len(published) > 0 {
+		hub.GetHub().Publish(published, true)
+	}
+}
+
+// recompute implements Recompute, updating the cache and publishing what it
+// stored only if notify.
+func recompute(ctx context.Context, store candleDao.CandleStore, changed []*dbModels.CandleModel, now time.Time, notify bool) ([]*candleDao.Change, error) {
+
+	changes := []*candleDao.Change{}
+	if len(changed) == 0 {
+		return changes, nil
+	}
+
+	calendars, err := calendar.GetProductCalendars(ctx)
+	if err != nil {
+		logging.Error(ctx, "[Recompute] GetProductCalendars err: %v", err)
+		return nil, err
+	}
+
+	for _, interval := range dbModels.IntervalTypes {
+		if interval.Source() == dbModels.IntervalType_None {
+			continue
+		}
+
+		buckets := map[bucketKey]bool{}
+		models := []*dbModels.CandleModel{}
+		empty := []*dbModels.CandleModel{}
+		for _, m := range changed {
+			if !interval.BuiltFrom(m.IntervalType) {
+				continue
+			}
+
+			anchor := dbModels.UTCAnchor
+			if interval.Duration() == 0 {
+				anchor = calendar.Of(calendars, m.ProductID).Anchor
+			}
+
+			start := anchor.Truncate(interval, m.Start)
+			key := bucketKey{productID: m.ProductID, start: start.Unix()}
+			if buckets[key] || anchor.Next(interval, start).After(now) {
+				continue
+			}
+			buckets[key] = true
+
+			from := start
+			to := anchor.Next(interval, start).Add(-time.Second)
+			children, err := store.Gets(&candleDao.QueryModel{
+				ProductID:    m.ProductID,
+				IntervalType: interval.Source(),
+				StartFrom:    &from,
+				StartTo:      &to,
+			})
+			if err != nil {
+				logging.Error(ctx, "[Recompute] gets %d error: %v", interval, err)
+				return nil, err
+			}
+			if len(children) == 0 {
+				empty = append(empty, &dbModels.CandleModel{ProductID: m.ProductID, IntervalType: interval, Start: start})
+				continue
+			}
+			models = append(models, aggregation.Aggregate(interval, children, anchor)...)
+		}
+
+		if len(models) > 0 {
+			stored, err := overwrite(ctx, store, models, notify)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, stored...)
+		}
+
+		for _, e := range empty {
+			deleted, err := store.Deletes(&candleDao.QueryModel{
+				ProductID:    e.ProductID,
+				IntervalType: e.IntervalType,
+				Start:        &e.Start,
+			})
+			if err != nil {
+				logging.Error(ctx, "[Recompute] deletes %d error: %v", interval, err)
+				return nil, err
+			}
+			if notify {
+				seriesCache.GetCache().Invalidate(ctx, deleted)
+			}
+			for _, d := range deleted {
+				changes = append(changes, &candleDao.Change{Old: d})
+			}
+		}
+	}
+
+	return changes, nil
+}
+
+// overwrite overwrites the aggregated candles, returning the ones inserted or changed.
+func overwrite(ctx context.Context, store candleDao.CandleStore, models []*dbModels.CandleModel, notify bool) ([]*candleDao.Change, error) {
+
+	existing, err := store.GetsByKeys(models)
+	if err != nil {
+		logging.Error(ctx, "[Recompute] GetsByKeys error: %v", err)
+		return nil, err
+	}
+	old := map[bucketKey]*dbModels.CandleModel{}
+	for _, e := range existing {
+		old[bucketKey{productID: e.ProductID, start: e.Start.Unix()}] = e
+	}
+
+	if err := lease.CheckFencing(ctx); err != nil {
+		logging.Error(ctx, "[Recompute] CheckFencing err: %v", err)
+		return nil, err
+	}
+	result, err := store.Upserts(models, candleDao.ConflictMode_Overwrite)
+	if err != nil {
+		logging.Error(ctx, "[Recompute] upserts error: %v", err)
+		return nil, err
+	}
+	if notify {
+		seriesCache.GetCache().Stored(ctx, models, candleDao.ConflictMode_Overwrite, result)
+	}
+
+	changes := []*candleDao.Change{}
+	published := []*dbModels.CandleModel{}
+	for _, r := range result.Revised {
+		changes = append(changes, &candleDao.Change{Old: old[bucketKey{productID: r.ProductID, start: r.Start.Unix()}], New: r})
+		published = append(published, r)
+	}
+	for _, m := range models {
+		if _, ok := old[bucketKey{productID: m.ProductID, start: m.Start.Unix()}]; !ok {
+			changes = append(changes, &candleDao.Change{New: m})
+			published = append(published, m)
+		}
+	}
+	if notify && len(published) > 0 {
+		hub.GetHub().Publish(published, true)
+	}
+	return changes, nil
+}
@@ -0,0 +1,75 @@
+package correction
+
+import (
+	"sort"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	"github.com/shopspring/decimal"
+)
+
+// Tick is a late trade or price update, At in unix milliseconds.
+type Tick struct {
+	ProductID uint64          `json:"productID"`
+	At        int64           `json:"at"`
+	Price     decimal.Decimal `json:"price"`
+	Size      decimal.Decimal `json:"size"`
+}
+
+type minuteKey struct {
+	productID uint64
+	start     int64
+}
+
+// Valid reports whether t has a product, a positive price and no negative size.
+func (t *Tick) Valid() bool {
+	return t.ProductID != 0 && t.Price.IsPositive() && !t.Size.IsNegative()
+}
+
+// MinutesOfTicks builds a 1MI candle per product and minute of ticks, to be
+// corrected with ConflictMode_Extend. Like quotes, a minute covers the ticks
+// within (start, start+1m].
+func MinutesOfTicks(ticks []*Tick) []*dbModels.CandleModel {
+
+	sorted := make([]*Tick, len(ticks))
+	copy(sorted, ticks)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].At < sorted[j].At
+	})
+
+	minutes := map[minuteKey]*dbModels.CandleModel{}
+	models := []*dbModels.CandleModel{}
+
+	for _, t := range sorted {
+		start := time.UnixMilli(t.At).Add(-time.Nanosecond).Truncate(time.Minute)
+		key := minuteKey{productID: t.ProductID, start: start.Unix()}
+
+		m, ok := minutes[key]
+		if !ok {
+			m = &dbModels.CandleModel{
+				ProductID:    t.ProductID,
+				IntervalType: dbModels.IntervalType_1MI,
+				Start:        start,
+				Open:         t.Price,
+				Close:        t.Price,
+				High:         t.Price,
+				Low:          t.Price,
+				Volume:       t.Size,
+			}
+			minutes[key] = m
+			models = append(models, m)
+			continue
+		}
+
+		m.Close = t.Price
+		if t.Price.GreaterThan(m.High) {
+			m.High = t.Price
+		}
+		if t.Price.LessThan(m.Low) {
+			m.Low = t.Price
+		}
+		m.Volume = m.Volume.Add(t.Size)
+	}
+
+	return models
+}
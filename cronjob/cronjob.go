@@ -2,77 +2,229 @@ package cronjob
 
 import (
 	"context"
-	"reflect"
-	"runtime"
+	"fmt"
 	"runtime/debug"
-	"strings"
 	"time"
 
 	"github.com/go-co-op/gocron"
-	"github.com/go-redis/redis/v9"
 	"github.com/gofrs/uuid"
 	"github.com/paper-trade-chatbot/be-candle/cronjob/generateCandle"
-	"github.com/paper-trade-chatbot/be-common/cache"
+	"github.com/paper-trade-chatbot/be-candle/cronjob/lease"
+	"github.com/paper-trade-chatbot/be-candle/cronjob/maintainCandle"
+	"github.com/paper-trade-chatbot/be-candle/dao/candleDao"
 	"github.com/paper-trade-chatbot/be-common/logging"
 )
 
+const (
+	// the lease is renewed every third of leaseTTL while a job runs
+	leaseTTL = time.Second * 10
+	// how long a finished run keeps its key from being run again
+	doneDuration = time.Minute * 2
+)
+
+// Initialize registers every job, see Job for the per-job config. The jobs
+// read and write candles through store.
+func Initialize(ctx context.Context, store candleDao.CandleStore) {
+
+	registryInstance = NewRegistry()
+	generator := generateCandle.New(store)
+	maintainer := maintainCandle.New(store)
+
+	jobs := []*Job{
+		{
+			Name:       "generate1MICandle",
+			ConfigKey:  "CRONJOB_GENERATE_1MI_CANDLE",
+			Every:      time.Minute,
+			Key:        generateCandle.Generate1MICandleKey,
+			Run:        generator.Generate1MICandle,
+			RetryDelay: time.Second,
+			Enabled:    true,
+			Timeout:    time.Second * 10,
+			Retries:    1,
+		},
+		// 等1MI寫入後再彙整
+		{
+			Name:       "generateAggregatedCandle",
+			ConfigKey:  "CRONJOB_GENERATE_AGGREGATED_CANDLE",
+			Every:      time.Minute,
+			Offset:     time.Second * 20,
+			Key:        generateCandle.GenerateAggregatedCandleKey,
+			Run:        generator.GenerateAggregatedCandle,
+			RetryDelay: time.Second,
+			Enabled:    true,
+			Timeout:    time.Second * 30,
+			Retries:    1,
+		},
+		// 晚到的報價修正已寫入的1MI, stream mode由Ingestor修正
+		{
+			Name:       "correct1MICandle",
+			ConfigKey:  "CRONJOB_CORRECT_1MI_CANDLE",
+			Every:      time.Minute,
+			Offset:     time.Second * 40,
+			Key:        generateCandle.Correct1MICandleKey,
+			Run:        generator.Correct1MICandle,
+			RetryDelay: time.Second,
+			Enabled:    true,
+			Timeout:    time.Second * 30,
+		},
+		// 過期的k線每小時刪除一次, 避開整分的產生與彙整
+		{
+			Name:       "applyRetention",
+			ConfigKey:  "CRONJOB_APPLY_RETENTION",
+			Every:      time.Hour,
+			Offset:     time.Second * 50,
+			Key:        maintainCandle.ApplyRetentionKey,
+			Run:        maintainCandle.ApplyRetention,
+			RetryDelay: time.Minute,
+			Enabled:    true,
+			Timeout:    time.Minute * 10,
+		},
+		// 每天預先建立之後幾個月的分區
+		{
+			Name:       "createCandlePartitions",
+			ConfigKey:  "CRONJOB_CREATE_CANDLE_PARTITIONS",
+			Every:      time.Hour * 24,
+			Offset:     time.Second * 30,
+			Key:        maintainCandle.CreateCandlePartitionsKey,
+			Run:        maintainer.CreateCandlePartitions,
+			RetryDelay: time.Minute,
+			Enabled:    true,
+			Timeout:    time.Minute,
+			Retries:    2,
+		},
+	}
+	for _, job := range jobs {
+		// 設定錯誤就不啟動
+		if err := registryInstance.Register(ctx, job); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Cron schedules the enabled jobs of the registry.
 func Cron() {
 
 	scheduler := gocron.NewScheduler(time.UTC)
 
 	startTime := time.Now().Truncate(time.Minute)
-	scheduler.Every(1).Minute().StartAt(startTime).Do(work, generateCandle.Generate1MICandle, generateCandle.Generate1MICandleKey, time.Second*10)
+	for _, job := range registryInstance.jobs {
+		if !job.Enabled {
+			continue
+		}
+		scheduled, err := scheduler.Every(job.Every).StartAt(startTime.Add(job.Offset)).Do(registryInstance.work, job, false)
+		if err != nil {
+			logging.Error(context.Background(), "[Cron] schedule %s error: %v", job.Name, err)
+			continue
+		}
+		job.setScheduled(scheduled)
+	}
 
 	// Start all the pending jobs
 	scheduler.StartAsync()
 
 }
 
-func work(cronjob func(context.Context) error, generateKey func() string, maxDuration time.Duration) {
+// work runs job under the lease of its key, retrying errors up to job.Retries
+// times within the timeout. Manual runs take the same lease, so they never
+// overlap a scheduled run, but run even if the scheduled run of the key is
+// done and do not mark it as done themselves.
+func (r *Registry) work(job *Job, manual bool) {
 
 	cronjobID, _ := uuid.NewV4()
 	ctx := context.WithValue(context.Background(), logging.ContextKeyRequestId, cronjobID.String())
 
-	funcName := strings.Split(runtime.FuncForPC(reflect.ValueOf(cronjob).Pointer()).Name(), "/")
-	logging.Info(ctx, "[cronjob] start %s", funcName[len(funcName)-1])
-	key := "cronjob:" + generateKey()
+	logging.Info(ctx, "[cronjob] start %s", job.Name)
+	key := "cronjob:" + job.Key()
 
-	r, _ := cache.GetRedis()
-	if flag, _ := r.SetNX(ctx, key, cronjobID.String(), maxDuration).Result(); !flag {
+	acquire := lease.Acquire
+	if manual {
+		acquire = lease.AcquireAgain
+	}
+	l, err := acquire(ctx, key, "cronjob:fencing:"+job.Name, cronjobID.String(), leaseTTL)
+	if err != nil {
+		logging.Error(ctx, "[Cronjob] %s acquire lease error: %v", key, err)
+		job.finish(time.Now(), Outcome_Error, err)
+		return
+	}
+	if l == nil {
 		logging.Info(ctx, "[Cronjob] key already exist: %s", key)
+		job.finish(time.Now(), Outcome_Skipped, nil)
 		return
 	}
 
-	ch := make(chan int, 1)
+	start := time.Now()
+	job.start(start)
+
+	ch := make(chan error, 1)
 
-	ctxTimeout, cancel := context.WithTimeout(ctx, maxDuration)
+	ctxTimeout, cancel := context.WithTimeout(lease.WithLease(ctx, l), job.Timeout)
 	defer cancel()
 
+	// a lost lease stops the job, someone else may be running it by now
+	lost := make(chan struct{})
+	go l.Keep(ctxTimeout, func() {
+		close(lost)
+		cancel()
+	})
+
 	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				// Record the stack trace to logging service, or if we cannot
-				// find a logging from this request, use the static logging.
-				logging.Error(ctx, "\x1b[31m%v\n[Stack Trace]\n%s\x1b[m", r, debug.Stack())
+		var err error
+		for attempt := 0; attempt <= job.Retries; attempt++ {
+			if attempt > 0 {
+				logging.Warn(ctx, "[Cronjob] %s retry %d after error: %v", key, attempt, err)
+				select {
+				case <-ctxTimeout.Done():
+					ch <- err
+					return
+				case <-time.After(job.RetryDelay):
+				}
+			}
+			if err = runSafely(ctxTimeout, job.Run); err == nil || ctxTimeout.Err() != nil {
+				break
 			}
-			ch <- 1
-		}()
-		err := cronjob(ctxTimeout)
-		if err != nil {
-			logging.Error(ctxTimeout, "[Cronjob] %s error: %v", key, err)
 		}
+		ch <- err
 	}()
 
+	var doneTTL time.Duration
 	select {
 	case <-ctxTimeout.Done():
-		logging.Error(ctxTimeout, "[Cronjob] %s timeout error: %v", key, ctxTimeout.Err())
-	case <-ch:
+		select {
+		case <-lost:
+			logging.Error(ctxTimeout, "[Cronjob] %s lease lost: %v", key, ctxTimeout.Err())
+			job.finish(start, Outcome_LeaseLost, ctxTimeout.Err())
+		default:
+			logging.Error(ctxTimeout, "[Cronjob] %s timeout error: %v", key, ctxTimeout.Err())
+			job.finish(start, Outcome_Timeout, ctxTimeout.Err())
+		}
+	case err := <-ch:
+		if err != nil {
+			logging.Error(ctxTimeout, "[Cronjob] %s error: %v", key, err)
+			job.finish(start, Outcome_Error, err)
+		} else {
+			job.finish(start, Outcome_Success, nil)
+			// the minute is done, instances firing late must not run it again
+			if !manual {
+				doneTTL = doneDuration
+			}
+		}
 	}
+	cancel()
 
-	value, err := r.Get(ctx, key).Result()
-	if err != nil && err.Error() != redis.Nil.Error() && value == cronjobID.String() {
-		if err := r.Del(ctx, key).Err(); err != nil && err.Error() != redis.Nil.Error() {
-			logging.Error(ctxTimeout, "[Cronjob] %s failed to delete key: %v", key, err)
-		}
+	if err := l.Release(ctx, doneTTL); err != nil {
+		logging.Error(ctx, "[Cronjob] %s release lease error: %v", key, err)
 	}
 }
+
+// runSafely turns a panic of cronjob into an error.
+func runSafely(ctx context.Context, cronjob func(context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			// Record the stack trace to logging service, or if we cannot
+			// find a logging from this request, use the static logging.
+			logging.Error(ctx, "\x1b[31m%v\n[Stack Trace]\n%s\x1b[m", r, debug.Stack())
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return cronjob(ctx)
+}
@@ -0,0 +1,137 @@
+package generateCandle
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-candle/aggregation"
+	"github.com/paper-trade-chatbot/be-candle/correction"
+	"github.com/paper-trade-chatbot/be-candle/dao/candleDao"
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	"github.com/paper-trade-chatbot/be-candle/service"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/paper-trade-chatbot/be-proto/quote"
+)
+
+// Correct1MICandle compares the 1MI candles stored within the correction grace
+// window, except the minute Generate1MICandle is building, with the quotes
+// known by now, and re-finalizes those the quotes arriving late changed.
+// Open and close follow the quotes of the minute, high and low only extend:
+// the seed price a minute was generated with is not among the quotes.
+// Volumes are kept.
+func (gen *Generator) Correct1MICandle(ctx context.Context) error {
+
+	now := time.Now().Truncate(time.Minute)
+
+	corrector := correction.GetCorrector()
+	grace := corrector.Grace
+	if grace > maxCatchUpMinutes*time.Minute {
+		grace = maxCatchUpMinutes * time.Minute
+	}
+	from := now.Add(-grace)
+	to := now.Add(-time.Minute)
+	if !from.Before(to) {
+		return nil
+	}
+
+	startTo := to.Add(-time.Second)
+	stored, err := gen.Store.Gets(&candleDao.QueryModel{
+		IntervalType: dbModels.IntervalType_1MI,
+		StartFrom:    &from,
+		StartTo:      &startTo,
+	})
+	if err != nil {
+		logging.Error(ctx, "[Correct1MICandle] gets error: %v", err)
+		return err
+	}
+	if len(stored) == 0 {
+		return nil
+	}
+
+	byProduct := map[uint64][]*dbModels.CandleModel{}
+	productIDs := []int64{}
+	for i := range stored {
+		productID := stored[i].ProductID
+		if _, ok := byProduct[productID]; !ok {
+			productIDs = append(productIDs, int64(productID))
+		}
+		byProduct[productID] = append(byProduct[productID], &stored[i])
+	}
+
+	getFrom := from.Format("150405")
+	getTo := to.Format("150405")
+	quoteData, err := service.Impl.QuoteIntf.GetQuotes(ctx, &quote.GetQuotesReq{
+		ProductIDs: productIDs,
+		Flag:       quote.GetQuotesReq_GetFlag_Quote,
+		GetFrom:    &getFrom,
+		GetTo:      &getTo,
+	})
+	if err != nil {
+		logging.Error(ctx, "[Correct1MICandle] GetQuotes err: %v", err)
+		return err
+	}
+
+	corrections := []*dbModels.CandleModel{}
+	for _, q := range quoteData.Quotes {
+		delete(q.Quotes, "latest")
+		ticks, invalid := aggregation.ParseQuoteTicks(q.Quotes, to)
+		if len(invalid) > 0 {
+			logging.Warn(ctx, "[Correct1MICandle] parse quote error: %v", invalid)
+		}
+
+		for _, m := range byProduct[uint64(q.ProductID)] {
+			if amended := amend(m, ticks); amended != nil {
+				corrections = append(corrections, amended)
+			}
+		}
+	}
+	if len(corrections) == 0 {
+		return nil
+	}
+
+	if _, err := corrector.Correct(ctx, gen.Store, corrections, candleDao.ConflictMode_Overwrite); err != nil {
+		logging.Error(ctx, "[Correct1MICandle] correct error: %v", err)
+		return err
+	}
+	return nil
+}
+
+// amend applies the ticks of the minute of stored onto a copy of it, nil if
+// nothing changed.
+func amend(stored *dbModels.CandleModel, ticks []aggregation.Tick) *dbModels.CandleModel {
+
+	rebuilt := aggregation.FromTicks(stored.ProductID, stored.Start, ticks, nil)
+	if rebuilt == nil {
+		return nil
+	}
+
+	amended := *stored
+	end := stored.Start.Add(time.Minute)
+	for _, t := range ticks {
+		// a tick at the end of the minute closes it but does not open it
+		if t.At.After(stored.Start) && t.At.Before(end) {
+			amended.Open = rebuilt.Open
+			break
+		}
+	}
+	amended.Close = rebuilt.Close
+	if rebuilt.High.GreaterThan(amended.High) {
+		amended.High = rebuilt.High
+	}
+	if rebuilt.Low.LessThan(amended.Low) {
+		amended.Low = rebuilt.Low
+	}
+
+	if amended.Open.Equal(stored.Open) && amended.Close.Equal(stored.Close) &&
+		amended.High.Equal(stored.High) && amended.Low.Equal(stored.Low) {
+		return nil
+	}
+	return &amended
+}
+
+func Correct1MICandleKey() string {
+	now := time.Now()
+	key := "Correct1MICandle:" + strconv.Itoa(now.Hour()) + "-" + strconv.Itoa(now.Minute())
+	return key
+}
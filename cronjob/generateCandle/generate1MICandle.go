@@ -6,53 +6,82 @@ import (
 	"time"
 
 	mapset "github.com/deckarep/golang-set/v2"
+	"github.com/paper-trade-chatbot/be-candle/aggregation"
+	"github.com/paper-trade-chatbot/be-candle/calendar"
+	"github.com/paper-trade-chatbot/be-candle/correction"
+	"github.com/paper-trade-chatbot/be-candle/cronjob/lease"
 	"github.com/paper-trade-chatbot/be-candle/dao/candleDao"
+	"github.com/paper-trade-chatbot/be-candle/hub"
 	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	"github.com/paper-trade-chatbot/be-candle/seriesCache"
 	"github.com/paper-trade-chatbot/be-candle/service"
-	"github.com/paper-trade-chatbot/be-common/database"
+	"github.com/paper-trade-chatbot/be-candle/service/readiness"
+	"github.com/paper-trade-chatbot/be-candle/service/volume"
+	"github.com/paper-trade-chatbot/be-common/cache"
+	"github.com/paper-trade-chatbot/be-common/config"
 	"github.com/paper-trade-chatbot/be-common/logging"
-	"github.com/paper-trade-chatbot/be-common/pagination"
-	"github.com/paper-trade-chatbot/be-proto/product"
 	"github.com/paper-trade-chatbot/be-proto/quote"
 	"github.com/shopspring/decimal"
 )
 
-func Generate1MICandle(ctx context.Context) error {
+const maxCatchUpMinutes = 23 * 60
+
+// generatedKey keeps the last generated minute per product, as unix seconds
+const generatedKey = "candle:generated:1MI"
+
+// Generate1MICandle builds the 1MI candle of the minute that just ended for
+// every product whose exchange was trading, together with the minutes missed
+// since the product's last generated minute, at most CANDLE_CATCH_UP_MINUTES back.
+// The closed aggregated candles of the caught up minutes are recomputed.
+func (gen *Generator) Generate1MICandle(ctx context.Context) error {
 
 	now := time.Now().Truncate(time.Minute)
-	time.Sleep(time.Second * 1) // 等quote抓完報價
-
-	db := database.GetDB()
-
-	enabled := product.Status_Status_Enabled
-	productRes, err := pagination.IteratePageGRPC[*product.GetProductsReq, *product.GetProductsRes](
-		&product.GetProductsReq{
-			Status:     &enabled,
-			Pagination: pagination.NewPagination(3000),
-		},
-		func(req *product.GetProductsReq) (*product.GetProductsRes, error) {
-			productData, err := service.Impl.ProductIntf.GetProducts(ctx, req)
-			if err != nil {
-				logging.Error(ctx, "[Generate1MICandle] GetProducts err: %v", err)
-				return nil, err
-			}
-			return productData, nil
-		},
-	)
+
+	r, _ := cache.GetRedis()
+
+	calendars, err := calendar.GetProductCalendars(ctx)
 	if err != nil {
-		logging.Error(ctx, "[Generate1MICandle] IteratePage err: %v", err)
+		logging.Error(ctx, "[Generate1MICandle] GetProductCalendars err: %v", err)
 		return err
 	}
 
+	generated, err := r.HGetAll(ctx, generatedKey).Result()
+	if err != nil {
+		logging.Error(ctx, "[Generate1MICandle] HGetAll err: %v", err)
+		return err
+	}
+
+	// only products whose exchange was trading during the minute get a candle
 	productIDSet := mapset.NewSet[int64]()
+	missing := map[uint64][]time.Time{}
+	earliest := now.Add(-time.Minute)
 
-	for _, r := range productRes {
-		for _, p := range r.Product {
-			productIDSet.Add(p.Id)
+	for productID, c := range calendars {
+		minutes := missingMinutes(c, generated[strconv.FormatUint(productID, 10)], now)
+		if len(minutes) == 0 {
+			continue
 		}
+		productIDSet.Add(int64(productID))
+		missing[productID] = minutes
+		if minutes[0].Before(earliest) {
+			earliest = minutes[0]
+		}
+	}
+	if productIDSet.Cardinality() == 0 {
+		return nil
+	}
+
+	// 等quote抓完報價
+	readyAt, complete, err := readiness.GetReadiness().WaitReady(ctx, now.Add(-time.Minute), productIDSet.ToSlice())
+	if err != nil {
+		logging.Error(ctx, "[Generate1MICandle] WaitReady err: %v", err)
+		return err
+	}
+	if !complete {
+		logging.Warn(ctx, "[Generate1MICandle] quotes of %v not ready before the deadline", now.Add(-time.Minute))
 	}
 
-	from := now.Add(-time.Minute).Format("150405")
+	from := earliest.Format("150405")
 	to := now.Format("150405")
 	quoteData, err := service.Impl.QuoteIntf.GetQuotes(ctx, &quote.GetQuotesReq{
 		ProductIDs: productIDSet.ToSlice(),
@@ -69,9 +98,6 @@ func Generate1MICandle(ctx context.Context) error {
 
 	for _, q := range quoteData.Quotes {
 
-		from := time.Date(0, 0, 0, now.Add(-time.Minute).Hour(), now.Add(-time.Minute).Minute(), now.Add(-time.Minute).Second(), 0, time.UTC)
-		to := time.Date(0, 0, 0, now.Hour(), now.Minute(), now.Second(), 0, time.UTC)
-
 		if _, ok := q.Quotes["latest"]; !ok {
 			logging.Error(ctx, "[Generate1MICandle] quote [%s] not having latest quote.", q.ProductID)
 			return err
@@ -79,74 +105,117 @@ func Generate1MICandle(ctx context.Context) error {
 		latestPrice, _ := decimal.NewFromString(q.Quotes["latest"])
 		delete(q.Quotes, "latest")
 
-		closestToFrom := to // 用來找出最接近from的時間點
-		tempOpenQuote := latestPrice
-
-		closestToTo := from // 用來找出最接近to的時間點
-		tempCloseQuote := latestPrice
-
-		open := latestPrice
-		close := latestPrice
-		high := latestPrice
-		low := latestPrice
-
-		if isCrossingDate := (now.Hour() == 0 && now.Minute() == 0); isCrossingDate {
-			to.Add(time.Hour * 24)
+		ticks, invalid := aggregation.ParseQuoteTicks(q.Quotes, now)
+		if len(invalid) > 0 {
+			logging.Warn(ctx, "[Generate1MICandle] parse quote error: %v", invalid)
 		}
 
-		for k, v := range q.Quotes {
-			quoteTime, err := time.Parse("150405", k)
-			if err != nil {
-				logging.Warn(ctx, "[Generate1MICandle] parse time error: %v", err)
-				continue
+		// missed minutes carry the previous close forward, the latest price
+		// only stands for the minute that just ended
+		var seed *decimal.Decimal
+		for _, minute := range missing[uint64(q.ProductID)] {
+			if minute.Equal(now.Add(-time.Minute)) {
+				seed = &latestPrice
 			}
-
-			price, _ := decimal.NewFromString(v)
-
-			if k == "000000" {
-				quoteTime = quoteTime.Add(time.Hour * 24)
+			candleChart := aggregation.FromTicks(uint64(q.ProductID), minute, ticks, seed)
+			if candleChart == nil {
+				continue
 			}
+			seed = &candleChart.Close
+			models = append(models, candleChart)
+		}
+	}
 
-			if quoteTime.After(closestToTo) && !quoteTime.After(to) {
-				closestToTo = quoteTime
-				tempCloseQuote = price
+	volumes := map[int64]map[uint64]decimal.Decimal{}
+	for _, m := range models {
+		minuteVolumes, ok := volumes[m.Start.Unix()]
+		if !ok {
+			minuteVolumes, err = volume.GetVolume().GetVolumes(ctx, m.Start)
+			if err != nil {
+				logging.Error(ctx, "[Generate1MICandle] GetVolumes err: %v", err)
+				return err
 			}
+			volumes[m.Start.Unix()] = minuteVolumes
+		}
+		m.Volume = minuteVolumes[m.ProductID]
+	}
 
-			if quoteTime.Before(closestToFrom) && quoteTime.After(from) {
-				closestToFrom = quoteTime
-				tempOpenQuote = price
-			}
+	if err := lease.CheckFencing(ctx); err != nil {
+		logging.Error(ctx, "[Generate1MICandle] CheckFencing err: %v", err)
+		return err
+	}
+	result, err := gen.Store.Upserts(models, candleDao.ConflictMode_Skip)
+	if err != nil {
+		logging.Error(ctx, "[Generate1MICandle] upserts error: %v", err)
+		return err
+	}
+	seriesCache.GetCache().Stored(ctx, models, candleDao.ConflictMode_Skip, result)
+	hub.GetHub().Publish(models, true)
+
+	// the aggregated candles of caught up minutes closed without them, the
+	// minute that just ended is aggregated by generateAggregatedCandle
+	caughtUp := []*dbModels.CandleModel{}
+	for _, m := range models {
+		if m.Start.Before(now.Add(-time.Minute)) {
+			caughtUp = append(caughtUp, m)
+		}
+	}
+	if _, err := correction.Recompute(ctx, gen.Store, caughtUp, now); err != nil {
+		logging.Error(ctx, "[Generate1MICandle] Recompute err: %v", err)
+		return err
+	}
 
-			if price.LessThan(low) {
-				low = price
-			}
+	if err := readiness.GetReadiness().RecordLag(ctx, now.Add(-time.Minute), readyAt, time.Now(), complete); err != nil {
+		logging.Error(ctx, "[Generate1MICandle] RecordLag err: %v", err)
+	}
 
-			if high.LessThan(price) {
-				high = price
-			}
-		}
-		open = tempOpenQuote
-		close = tempCloseQuote
-
-		candleChart := &dbModels.CandleModel{
-			ProductID:    uint64(q.ProductID),
-			IntervalType: dbModels.IntervalType_1MI,
-			Start:        now.Add(-time.Minute),
-			Open:         open,
-			Close:        close,
-			High:         high,
-			Low:          low,
+	// a product without any quote is retried from the same minute next time
+	last := map[string]interface{}{}
+	for _, m := range models {
+		last[strconv.FormatUint(m.ProductID, 10)] = now.Add(-time.Minute).Unix()
+	}
+	if len(last) > 0 {
+		if err := r.HSet(ctx, generatedKey, last).Err(); err != nil {
+			logging.Error(ctx, "[Generate1MICandle] HSet err: %v", err)
+			return err
 		}
+	}
+
+	return nil
+}
+
+// missingMinutes lists the trading minutes after the last generated one up to
+// the minute ending at now. Without a last generated minute only the minute
+// ending at now is considered.
+func missingMinutes(c *calendar.Calendar, lastGenerated string, now time.Time) []time.Time {
 
-		models = append(models, candleChart)
+	from := now.Add(-time.Minute)
+	if last, err := strconv.ParseInt(lastGenerated, 10, 64); err == nil {
+		from = time.Unix(last, 0).Add(time.Minute)
+	}
+	if earliest := now.Add(-catchUpWindow()); from.Before(earliest) {
+		from = earliest
 	}
 
-	if _, err := candleDao.News(db, models); err != nil {
-		logging.Error(ctx, "[Generate1MICandle] news error: %v", err)
-		return err
+	minutes := []time.Time{}
+	for m := from; m.Before(now); m = m.Add(time.Minute) {
+		if c.IsOpen(m) {
+			minutes = append(minutes, m)
+		}
 	}
+	return minutes
+}
 
-	return nil
+// catchUpWindow is CANDLE_CATCH_UP_MINUTES, below a day as quotes are keyed by time of day
+func catchUpWindow() time.Duration {
+	minutes := config.GetInt("CANDLE_CATCH_UP_MINUTES")
+	if minutes < 1 {
+		minutes = 1
+	}
+	if minutes > maxCatchUpMinutes {
+		minutes = maxCatchUpMinutes
+	}
+	return time.Duration(minutes) * time.Minute
 }
 
 func Generate1MICandleKey() string {
@@ -0,0 +1,164 @@
+package generateCandle
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-candle/aggregation"
+	"github.com/paper-trade-chatbot/be-candle/calendar"
+	"github.com/paper-trade-chatbot/be-candle/cronjob/lease"
+	"github.com/paper-trade-chatbot/be-candle/dao/candleDao"
+	"github.com/paper-trade-chatbot/be-candle/hub"
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	"github.com/paper-trade-chatbot/be-candle/seriesCache"
+	"github.com/paper-trade-chatbot/be-common/logging"
+)
+
+// anchorGroup is the products whose day and longer buckets align on anchor
+type anchorGroup struct {
+	anchor     dbModels.Anchor
+	productIDs []uint64
+}
+
+// GenerateAggregatedCandle builds every interval coarser than 1MI whose bucket
+// closed at the current minute. Intervals are processed from fine to coarse so
+// that e.g. the 1HR candle is stored before the 1DY candle reads it.
+// Intraday buckets close at the same time for every product, day and longer
+// buckets close at the anchor of each product's exchange, local midnight or
+// the session open.
+// The forming bucket of every interval someone subscribed to in-progress
+// candles of is published as well.
+func (gen *Generator) GenerateAggregatedCandle(ctx context.Context) error {
+
+	now := time.Now().UTC().Truncate(time.Minute)
+
+	h := hub.GetHub()
+
+	calendars, err := calendar.GetProductCalendars(ctx)
+	if err != nil {
+		logging.Error(ctx, "[GenerateAggregatedCandle] GetProductCalendars err: %v", err)
+		return err
+	}
+	groups := groupByAnchor(calendars)
+
+	for _, interval := range dbModels.IntervalTypes {
+		if interval.Source() == dbModels.IntervalType_None {
+			continue
+		}
+
+		if interval.Duration() > 0 {
+			if err := aggregateClosed(ctx, gen.Store, h, interval, now, &anchorGroup{anchor: dbModels.UTCAnchor}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		for _, g := range groups {
+			if err := aggregateClosed(ctx, gen.Store, h, interval, now, g); err != nil {
+				return err
+			}
+		}
+	}
+
+	wantsPartial := []dbModels.IntervalType{}
+	for _, interval := range dbModels.IntervalTypes {
+		if interval.Source() != dbModels.IntervalType_None && h.WantsPartial(interval) {
+			wantsPartial = append(wantsPartial, interval)
+		}
+	}
+	if len(wantsPartial) == 0 {
+		return nil
+	}
+
+	for _, g := range groups {
+		partials, err := aggregation.Partials(now, g.anchor, wantsPartial, nil,
+			func(intervalType dbModels.IntervalType, from, to time.Time) ([]dbModels.CandleModel, error) {
+				startTo := to.Add(-time.Second)
+				return gen.Store.Gets(&candleDao.QueryModel{
+					IntervalType: intervalType,
+					ProductIDIn:  g.productIDs,
+					StartFrom:    &from,
+					StartTo:      &startTo,
+				})
+			},
+		)
+		if err != nil {
+			logging.Error(ctx, "[GenerateAggregatedCandle] partials error: %v", err)
+			return err
+		}
+
+		for _, interval := range wantsPartial {
+			models := []*dbModels.CandleModel{}
+			for i := range partials[interval] {
+				models = append(models, &partials[interval][i])
+			}
+			h.Publish(models, false)
+		}
+	}
+
+	return nil
+}
+
+// aggregateClosed stores the bucket of interval that closed at now, if any.
+// An empty productIDs aggregates every product.
+func aggregateClosed(ctx context.Context, store candleDao.CandleStore, h *hub.Hub, interval dbModels.IntervalType, now time.Time, g *anchorGroup) error {
+
+	if !g.anchor.Truncate(interval, now).Equal(now) {
+		return nil
+	}
+
+	from := g.anchor.Previous(interval, now)
+	to := now.Add(-time.Second)
+	children, err := store.Gets(&candleDao.QueryModel{
+		IntervalType: interval.Source(),
+		ProductIDIn:  g.productIDs,
+		StartFrom:    &from,
+		StartTo:      &to,
+	})
+	if err != nil {
+		logging.Error(ctx, "[GenerateAggregatedCandle] gets %d error: %v", interval, err)
+		return err
+	}
+
+	models := aggregation.Aggregate(interval, children, g.anchor)
+	if len(models) == 0 {
+		return nil
+	}
+
+	if err := lease.CheckFencing(ctx); err != nil {
+		logging.Error(ctx, "[GenerateAggregatedCandle] CheckFencing err: %v", err)
+		return err
+	}
+	result, err := store.Upserts(models, candleDao.ConflictMode_Overwrite)
+	if err != nil {
+		logging.Error(ctx, "[GenerateAggregatedCandle] upserts %d error: %v", interval, err)
+		return err
+	}
+	seriesCache.GetCache().Stored(ctx, models, candleDao.ConflictMode_Overwrite, result)
+	h.Publish(models, true)
+
+	return nil
+}
+
+func groupByAnchor(calendars map[uint64]*calendar.Calendar) []*anchorGroup {
+	groups := map[string]*anchorGroup{}
+	result := []*anchorGroup{}
+	for productID := range calendars {
+		anchor := calendar.Of(calendars, productID).Anchor
+		g, ok := groups[anchor.String()]
+		if !ok {
+			g = &anchorGroup{anchor: anchor}
+			groups[anchor.String()] = g
+			result = append(result, g)
+		}
+		g.productIDs = append(g.productIDs, productID)
+	}
+	return result
+}
+
+func GenerateAggregatedCandleKey() string {
+	now := time.Now()
+	key := "GenerateAggregatedCandle:" + strconv.Itoa(now.Hour()) + "-" + strconv.Itoa(now.Minute())
+	return key
+}
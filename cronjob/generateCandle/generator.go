@@ -0,0 +1,16 @@
+package generateCandle
+
+import (
+	"github.com/paper-trade-chatbot/be-candle/dao/candleDao"
+)
+
+// Generator runs the candle generating cronjobs against Store.
+type Generator struct {
+	Store candleDao.CandleStore
+}
+
+func New(store candleDao.CandleStore) *Generator {
+	return &Generator{
+		Store: store,
+	}
+}
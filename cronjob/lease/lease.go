@@ -0,0 +1,203 @@
+package lease
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/paper-trade-chatbot/be-common/cache"
+	"github.com/paper-trade-chatbot/be-common/logging"
+)
+
+type contextKey string
+
+const contextKeyFencing contextKey = "fencing"
+
+// getRedis returns the client leases are kept in, replaced in tests
+var getRedis = func() redis.Scripter {
+	r, _ := cache.GetRedis()
+	return r.Client
+}
+
+// acquireScript takes KEYS[1] unless it is held or, if ARGV[3] is 1, KEYS[2]
+// marks the run as done, returning the next fencing token of KEYS[3], 0 if not
+// acquired.
+var acquireScript = redis.NewScript(`
+if ARGV[3] == '1' and redis.call('EXISTS', KEYS[2]) == 1 then
+	return 0
+end
+if not redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return 0
+end
+return redis.call('INCR', KEYS[3])
+`)
+
+// renewScript extends KEYS[1] only while ARGV[1] still owns it.
+var renewScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseScript deletes KEYS[1] only while ARGV[1] still owns it, marking the
+// run as done in KEYS[2] for ARGV[2] milliseconds unless ARGV[2] is 0.
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+redis.call('DEL', KEYS[1])
+if tonumber(ARGV[2]) > 0 then
+	redis.call('SET', KEYS[2], ARGV[1], 'PX', ARGV[2])
+end
+return 1
+`)
+
+// checkScript returns 0 if KEYS[1] was incremented past the token ARGV[1].
+var checkScript = redis.NewScript(`
+local current = redis.call('GET', KEYS[1])
+if current and tonumber(current) > tonumber(ARGV[1]) then
+	return 0
+end
+return 1
+`)
+
+var (
+	ErrLeaseLost = errors.New("lease lost")
+	ErrFenced    = errors.New("fencing token superseded")
+)
+
+// Lease is a lock on Key held by Owner for ttl at a time, renewed while the
+// holder is alive. Token increases with every acquisition of the same
+// FencingKey, so writes can be rejected from a holder that lost the lease
+// meanwhile, see CheckFencing.
+type Lease struct {
+	Key        string
+	FencingKey string
+	Owner      string
+	Token      int64
+
+	ttl time.Duration
+}
+
+// Acquire takes the lease on key for ttl, nil if someone else holds it or a
+// previous holder released it as done.
+func Acquire(ctx context.Context, key, fencingKey, owner string, ttl time.Duration) (*Lease, error) {
+	return acquire(ctx, key, fencingKey, owner, ttl, true)
+}
+
+// AcquireAgain takes the lease on key for ttl even if a previous holder
+// released it as done, nil if someone else holds it.
+func AcquireAgain(ctx context.Context, key, fencingKey, owner string, ttl time.Duration) (*Lease, error) {
+	return acquire(ctx, key, fencingKey, owner, ttl, false)
+}
+
+func acquire(ctx context.Context, key, fencingKey, owner string, ttl time.Duration, checkDone bool) (*Lease, error) {
+
+	done := 0
+	if checkDone {
+		done = 1
+	}
+	token, err := acquireScript.Run(ctx, getRedis(), []string{key, doneKey(key), fencingKey}, owner, ttl.Milliseconds(), done).Int64()
+	if err != nil {
+		return nil, err
+	}
+	if token == 0 {
+		return nil, nil
+	}
+
+	return &Lease{
+		Key:        key,
+		FencingKey: fencingKey,
+		Owner:      owner,
+		Token:      token,
+		ttl:        ttl,
+	}, nil
+}
+
+// Keep renews the lease every third of its ttl until ctx is done. If a renewal
+// fails the lease may already belong to someone else, so lost is called and
+// renewing stops.
+func (l *Lease) Keep(ctx context.Context, lost func()) {
+
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := l.renew(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logging.Error(ctx, "[Lease] %s renew error: %v", l.Key, err)
+			lost()
+			return
+		}
+	}
+}
+
+func (l *Lease) renew(ctx context.Context) error {
+	renewed, err := renewScript.Run(ctx, getRedis(), []string{l.Key}, l.Owner, l.ttl.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if renewed == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// Release gives the lease up if it is still held. A done lease keeps anyone
+// from acquiring key again for doneTTL, 0 lets the next caller retry.
+func (l *Lease) Release(ctx context.Context, doneTTL time.Duration) error {
+	released, err := releaseScript.Run(ctx, getRedis(), []string{l.Key, doneKey(l.Key)}, l.Owner, doneTTL.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+	if released == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func doneKey(key string) string {
+	return key + ":done"
+}
+
+// WithLease passes the lease a job runs under, whose writes are fenced.
+func WithLease(ctx context.Context, l *Lease) context.Context {
+	return context.WithValue(ctx, contextKeyFencing, l)
+}
+
+// FencingToken returns the fencing token of the lease ctx runs under, false outside a lease.
+func FencingToken(ctx context.Context) (int64, bool) {
+	l, ok := ctx.Value(contextKeyFencing).(*Lease)
+	if !ok {
+		return 0, false
+	}
+	return l.Token, true
+}
+
+// CheckFencing returns ErrFenced if the lease ctx runs under was acquired
+// again since, by a holder with a newer token. Writers call it right before
+// writing; outside a lease writes are not fenced and it returns nil.
+func CheckFencing(ctx context.Context) error {
+	l, ok := ctx.Value(contextKeyFencing).(*Lease)
+	if !ok {
+		return nil
+	}
+	current, err := checkScript.Run(ctx, getRedis(), []string{l.FencingKey}, l.Token).Int64()
+	if err != nil {
+		return err
+	}
+	if current == 0 {
+		return ErrFenced
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package lease
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// startRedis runs the lease scripts against an in-process Redis.
+func startRedis(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	getRedis = func() redis.Scripter { return client }
+	return mr
+}
+
+func TestAcquire(t *testing.T) {
+	ctx := context.Background()
+	startRedis(t)
+
+	l, err := Acquire(ctx, "job", "job:fencing", "a", 30*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l == nil || l.Token != 1 || l.Owner != "a" || l.FencingKey != "job:fencing" {
+		t.Fatalf("lease %+v", l)
+	}
+
+	// held by a
+	if l, err := Acquire(ctx, "job", "job:fencing", "b", 30*time.Second); err != nil || l != nil {
+		t.Fatalf("acquired %+v, %v while held", l, err)
+	}
+	if l, err := AcquireAgain(ctx, "job", "job:fencing", "b", 30*time.Second); err != nil || l != nil {
+		t.Fatalf("acquired again %+v, %v while held", l, err)
+	}
+}
+
+func TestAcquireDone(t *testing.T) {
+	ctx := context.Background()
+	startRedis(t)
+
+	l, err := Acquire(ctx, "job", "job:fencing", "a", 30*time.Second)
+	if err != nil || l == nil {
+		t.Fatalf("Acquire = %+v, %v", l, err)
+	}
+	if err := l.Release(ctx, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	// the run is done, only a manual run takes the lease again
+	if l, err := Acquire(ctx, "job", "job:fencing", "b", 30*time.Second); err != nil || l != nil {
+		t.Fatalf("acquired %+v, %v after done", l, err)
+	}
+	again, err := AcquireAgain(ctx, "job", "job:fencing", "c", 30*time.Second)
+	if err != nil || again == nil || again.Token != 2 {
+		t.Fatalf("AcquireAgain = %+v, %v", again, err)
+	}
+}
+
+func TestAcquireAfterRetry(t *testing.T) {
+	ctx := context.Background()
+	startRedis(t)
+
+	l, err := Acquire(ctx, "job", "job:fencing", "a", 30*time.Second)
+	if err != nil || l == nil {
+		t.Fatalf("Acquire = %+v, %v", l, err)
+	}
+	// released without done, the next caller retries
+	if err := l.Release(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if l, err := Acquire(ctx, "job", "job:fencing", "b", 30*time.Second); err != nil || l == nil || l.Token != 2 {
+		t.Fatalf("Acquire after release = %+v, %v", l, err)
+	}
+}
+
+func TestRenew(t *testing.T) {
+	ctx := context.Background()
+	mr := startRedis(t)
+
+	l, err := Acquire(ctx, "job", "job:fencing", "a", 30*time.Second)
+	if err != nil || l == nil {
+		t.Fatalf("Acquire = %+v, %v", l, err)
+	}
+
+	mr.FastForward(20 * time.Second)
+	if err := l.renew(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// renewed for another 30s from now
+	mr.FastForward(20 * time.Second)
+	if !mr.Exists("job") {
+		t.Fatal("lease expired despite the renewal")
+	}
+
+	// expired and taken by b
+	mr.FastForward(30 * time.Second)
+	if l, err := Acquire(ctx, "job", "job:fencing", "b", 30*time.Second); err != nil || l == nil {
+		t.Fatalf("Acquire after expiry = %+v, %v", l, err)
+	}
+	if err := l.renew(ctx); !errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("renew after someone else took the lease: %v", err)
+	}
+	if owner, _ := mr.Get("job"); owner != "b" {
+		t.Fatalf("lease of b renewed by a, owner %q", owner)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	ctx := context.Background()
+	mr := startRedis(t)
+
+	a, err := Acquire(ctx, "job", "job:fencing", "a", 30*time.Second)
+	if err != nil || a == nil {
+		t.Fatalf("Acquire = %+v, %v", a, err)
+	}
+
+	// b never held the lease and cannot release the one of a
+	b := &Lease{Key: "job", FencingKey: "job:fencing", Owner: "b", ttl: 30 * time.Second}
+	if err := b.Release(ctx, time.Minute); !errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("release by a non owner: %v", err)
+	}
+	if owner, _ := mr.Get("job"); owner != "a" {
+		t.Fatalf("owner %q after a refused release", owner)
+	}
+	if mr.Exists("job:done") {
+		t.Fatal("refused release marked the run as done")
+	}
+
+	if err := a.Release(ctx, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists("job") {
+		t.Fatal("lease kept after release")
+	}
+	if err := a.Release(ctx, 0); !errors.Is(err, ErrLeaseLost) {
+		t.Fatalf("second release: %v", err)
+	}
+}
+
+// TestKeepReportsExpiry lets the lease lapse before Keep renews it: the
+// renewal finds the key gone and Keep calls lost.
+func TestKeepReportsExpiry(t *testing.T) {
+	mr := startRedis(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	l, err := Acquire(ctx, "job", "job:fencing", "a", 30*time.Millisecond)
+	if err != nil || l == nil {
+		t.Fatalf("Acquire = %+v, %v", l, err)
+	}
+	mr.FastForward(time.Second)
+
+	lost := make(chan struct{})
+	go l.Keep(ctx, func() { close(lost) })
+
+	select {
+	case <-lost:
+	case <-ctx.Done():
+		t.Fatal("expiry not reported")
+	}
+}
+
+func TestCheckFencing(t *testing.T) {
+	mr := startRedis(t)
+
+	a, err := Acquire(context.Background(), "job", "job:fencing", "a", 30*time.Second)
+	if err != nil || a == nil {
+		t.Fatalf("Acquire = %+v, %v", a, err)
+	}
+	ctx := WithLease(context.Background(), a)
+
+	if token, ok := FencingToken(ctx); !ok || token != a.Token {
+		t.Fatalf("FencingToken = %d, %v", token, ok)
+	}
+	if err := CheckFencing(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// a stalls past its ttl and b acquires the lease again with a newer token
+	mr.FastForward(time.Minute)
+	b, err := Acquire(context.Background(), "job", "job:fencing", "b", 30*time.Second)
+	if err != nil || b == nil || b.Token <= a.Token {
+		t.Fatalf("reacquire = %+v, %v", b, err)
+	}
+
+	if err := CheckFencing(ctx); !errors.Is(err, ErrFenced) {
+		t.Fatalf("write with an older token: %v", err)
+	}
+	if err := CheckFencing(WithLease(context.Background(), b)); err != nil {
+		t.Fatalf("write with the current token: %v", err)
+	}
+
+	// writes outside a lease are not fenced
+	if err := CheckFencing(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,39 @@
+package maintainCandle
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-candle/retention"
+	"github.com/paper-trade-chatbot/be-common/logging"
+)
+
+// ApplyRetention deletes the candles older than the retention policy of their
+// interval, see retention.Retainer. A run cut short by its timeout is resumed
+// by the next one.
+func ApplyRetention(ctx context.Context) error {
+
+	report, err := retention.GetRetainer().Apply(ctx, time.Now(), false)
+	if report != nil {
+		for _, r := range report.Intervals {
+			logging.Info(ctx, "[ApplyRetention] %s dry run: %t, cutoff: %d, deleted: %d, downsampled: %d, inconsistent: %d",
+				r.Name, report.DryRun, r.Cutoff, r.Deleted, r.Downsampled, r.Inconsistent)
+		}
+		for _, p := range report.Partitions {
+			logging.Info(ctx, "[ApplyRetention] %s partition %s dry run: %t, rows: %d, dropped: %t",
+				p.Table, p.Partition, report.DryRun, p.Rows, p.Dropped)
+		}
+	}
+	if err != nil {
+		logging.Error(ctx, "[ApplyRetention] apply error: %v", err)
+		return err
+	}
+	return nil
+}
+
+func ApplyRetentionKey() string {
+	now := time.Now()
+	key := "ApplyRetention:" + strconv.Itoa(now.Hour())
+	return key
+}
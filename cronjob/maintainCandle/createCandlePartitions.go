@@ -0,0 +1,63 @@
+package maintainCandle
+
+import (
+	"context"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-candle/dao/candleDao"
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	"github.com/paper-trade-chatbot/be-common/config"
+	"github.com/paper-trade-chatbot/be-common/logging"
+)
+
+// CreateCandlePartitions keeps a partition for the current month and the
+// CANDLE_PARTITION_MONTHS_AHEAD months after it in every partitioned candle
+// table, so that the rows of a new month never land in the future partition.
+func (m *Maintainer) CreateCandlePartitions(ctx context.Context) error {
+
+	now := time.Now().UTC()
+	thisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	until := thisMonth.AddDate(0, config.GetInt("CANDLE_PARTITION_MONTHS_AHEAD")+1, 0)
+
+	for _, table := range candleDao.PartitionedTables() {
+
+		partitions, err := m.Store.GetPartitions(table)
+		if err != nil {
+			logging.Error(ctx, "[CreateCandlePartitions] gets %s error: %v", table, err)
+			return err
+		}
+
+		var last time.Time
+		for _, p := range partitions {
+			if before, ok := p.Before(); ok && before.After(last) {
+				last = before
+			}
+		}
+		if last.IsZero() {
+			logging.Warn(ctx, "[CreateCandlePartitions] %s is not partitioned by month", table)
+			continue
+		}
+
+		months := []time.Time{}
+		for month := last.UTC(); month.Before(until); month = month.AddDate(0, 1, 0) {
+			months = append(months, month)
+		}
+		if len(months) == 0 {
+			continue
+		}
+
+		if err := m.Store.AddPartitions(table, months); err != nil {
+			logging.Error(ctx, "[CreateCandlePartitions] adds %s error: %v", table, err)
+			return err
+		}
+		logging.Info(ctx, "[CreateCandlePartitions] %s added %s to %s", table, dbModels.PartitionName(months[0]), dbModels.PartitionName(months[len(months)-1]))
+	}
+
+	return nil
+}
+
+func CreateCandlePartitionsKey() string {
+	now := time.Now()
+	key := "CreateCandlePartitions:" + now.Format("20060102")
+	return key
+}
@@ -0,0 +1,16 @@
+package maintainCandle
+
+import (
+	"github.com/paper-trade-chatbot/be-candle/dao/candleDao"
+)
+
+// Maintainer runs the candle table maintaining cronjobs against Store.
+type Maintainer struct {
+	Store candleDao.CandleStore
+}
+
+func New(store candleDao.CandleStore) *Maintainer {
+	return &Maintainer{
+		Store: store,
+	}
+}
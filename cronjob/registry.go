@@ -0,0 +1,186 @@
+package cronjob
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-co-op/gocron"
+	"github.com/paper-trade-chatbot/be-common/config"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	ErrNoSuchJob      = status.Error(codes.NotFound, "no such cronjob")
+	ErrInvalidTimeout = errors.New("cronjob timeout must be positive")
+)
+
+type Outcome string
+
+const (
+	Outcome_None      Outcome = ""
+	Outcome_Success   Outcome = "success"
+	Outcome_Error     Outcome = "error"
+	Outcome_Timeout   Outcome = "timeout"
+	Outcome_LeaseLost Outcome = "leaseLost"
+	Outcome_Skipped   Outcome = "skipped" // another run held the lease
+)
+
+// Job is a task run every Every, Offset after the minute the scheduler started
+// in, by one instance at a time. Enabled, Timeout and Retries are the defaults
+// of the job, overridden by <ConfigKey>_ENABLED, <ConfigKey>_TIMEOUT_MS and
+// <ConfigKey>_RETRIES when set.
+type Job struct {
+	Name       string
+	ConfigKey  string
+	Every      time.Duration
+	Offset     time.Duration
+	Key        func() string // lease key of the current run
+	Run        func(context.Context) error
+	RetryDelay time.Duration
+
+	Enabled bool
+	Timeout time.Duration
+	Retries int
+
+	lock      sync.Mutex
+	status    Status
+	scheduled *gocron.Job
+}
+
+// Status is the last run of a job on this instance, times in unix seconds.
+type Status struct {
+	Name         string  `json:"name"`
+	Enabled      bool    `json:"enabled"`
+	Every        int64   `json:"every"`
+	TimeoutMS    int64   `json:"timeoutMS"`
+	Retries      int     `json:"retries"`
+	Running      bool    `json:"running"`
+	LastRun      int64   `json:"lastRun"`
+	LastDuration int64   `json:"lastDurationMS"`
+	LastOutcome  Outcome `json:"lastOutcome"`
+	LastError    string  `json:"lastError"`
+	NextRun      int64   `json:"nextRun"`
+}
+
+// Registry holds the jobs by name.
+type Registry struct {
+	jobs   []*Job
+	byName map[string]*Job
+}
+
+var registryInstance *Registry
+
+// GetRegistry returns the global registry.
+func GetRegistry() *Registry {
+	return registryInstance
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		jobs:   []*Job{},
+		byName: map[string]*Job{},
+	}
+}
+
+// Register reads the config of job over its defaults and adds it.
+func (r *Registry) Register(ctx context.Context, job *Job) error {
+	if isSet(job.ConfigKey + "_ENABLED") {
+		job.Enabled = config.GetBool(job.ConfigKey + "_ENABLED")
+	}
+	if isSet(job.ConfigKey + "_TIMEOUT_MS") {
+		// signed, so that a negative timeout is rejected below instead of failing to parse
+		job.Timeout = time.Duration(config.GetInt64(job.ConfigKey+"_TIMEOUT_MS")) * time.Millisecond
+	}
+	if isSet(job.ConfigKey + "_RETRIES") {
+		job.Retries = config.GetInt(job.ConfigKey + "_RETRIES")
+	}
+	if job.Timeout <= 0 {
+		logging.Error(ctx, "[Register] %s timeout: %v", job.Name, job.Timeout)
+		return ErrInvalidTimeout
+	}
+	job.status.Name = job.Name
+
+	r.jobs = append(r.jobs, job)
+	r.byName[job.Name] = job
+	logging.Info(ctx, "cronjob %s enabled: %t, timeout: %v, retries: %d", job.Name, job.Enabled, job.Timeout, job.Retries)
+	return nil
+}
+
+func isSet(key string) bool {
+	_, ok := os.LookupEnv(key)
+	return ok
+}
+
+// Statuses lists every job in registration order.
+func (r *Registry) Statuses() []*Status {
+	statuses := []*Status{}
+	for _, job := range r.jobs {
+		statuses = append(statuses, job.Status())
+	}
+	return statuses
+}
+
+// Trigger runs the job now in the background, even if it is disabled.
+func (r *Registry) Trigger(name string) error {
+	job, ok := r.byName[name]
+	if !ok {
+		return ErrNoSuchJob
+	}
+	go r.work(job, true)
+	return nil
+}
+
+func (job *Job) Status() *Status {
+	job.lock.Lock()
+	defer job.lock.Unlock()
+
+	s := job.status
+	s.Enabled = job.Enabled
+	s.Every = int64(job.Every / time.Second)
+	s.TimeoutMS = job.Timeout.Milliseconds()
+	s.Retries = job.Retries
+	if job.scheduled != nil {
+		s.NextRun = job.scheduled.NextRun().Unix()
+	}
+	return &s
+}
+
+func (job *Job) setScheduled(scheduled *gocron.Job) {
+	job.lock.Lock()
+	defer job.lock.Unlock()
+	job.scheduled = scheduled
+}
+
+func (job *Job) start(at time.Time) {
+	job.lock.Lock()
+	defer job.lock.Unlock()
+	job.status.Running = true
+	job.status.LastRun = at.Unix()
+}
+
+// finish records a run started at start, a skipped run keeps the previous result.
+func (job *Job) finish(start time.Time, outcome Outcome, err error) {
+	job.lock.Lock()
+	defer job.lock.Unlock()
+
+	if outcome == Outcome_Skipped {
+		if !job.status.Running {
+			job.status.LastOutcome = outcome
+		}
+		return
+	}
+
+	job.status.Running = false
+	job.status.LastRun = start.Unix()
+	job.status.LastDuration = time.Since(start).Milliseconds()
+	job.status.LastOutcome = outcome
+	job.status.LastError = ""
+	if err != nil {
+		job.status.LastError = err.Error()
+	}
+}
@@ -0,0 +1,56 @@
+package cronjob
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRegisterDefaults(t *testing.T) {
+	t.Setenv("TEST_JOB_RETRIES", "3")
+
+	r := NewRegistry()
+	job := &Job{Name: "test", ConfigKey: "TEST_JOB", Enabled: true, Timeout: time.Second, Retries: 1}
+	if err := r.Register(context.Background(), job); err != nil {
+		t.Fatal(err)
+	}
+	if !job.Enabled || job.Timeout != time.Second || job.Retries != 3 {
+		t.Fatalf("enabled %v, timeout %v, retries %d", job.Enabled, job.Timeout, job.Retries)
+	}
+}
+
+func TestRegisterOverrides(t *testing.T) {
+	t.Setenv("TEST_JOB_ENABLED", "false")
+	t.Setenv("TEST_JOB_TIMEOUT_MS", "2500")
+
+	r := NewRegistry()
+	job := &Job{Name: "test", ConfigKey: "TEST_JOB", Enabled: true, Timeout: time.Second}
+	if err := r.Register(context.Background(), job); err != nil {
+		t.Fatal(err)
+	}
+	if job.Enabled || job.Timeout != 2500*time.Millisecond {
+		t.Fatalf("enabled %v, timeout %v", job.Enabled, job.Timeout)
+	}
+}
+
+func TestRegisterRejectsTimeout(t *testing.T) {
+	for _, timeout := range []string{"0", "-1"} {
+		t.Setenv("TEST_JOB_TIMEOUT_MS", timeout)
+
+		r := NewRegistry()
+		job := &Job{Name: "test", ConfigKey: "TEST_JOB", Timeout: time.Second}
+		if err := r.Register(context.Background(), job); !errors.Is(err, ErrInvalidTimeout) {
+			t.Errorf("timeout %s: %v", timeout, err)
+		}
+		if _, ok := r.byName["test"]; ok {
+			t.Errorf("timeout %s registered", timeout)
+		}
+	}
+
+	// a job without a timeout default needs the config
+	r := NewRegistry()
+	if err := r.Register(context.Background(), &Job{Name: "test", ConfigKey: "TEST_UNSET_JOB"}); !errors.Is(err, ErrInvalidTimeout) {
+		t.Errorf("no timeout: %v", err)
+	}
+}
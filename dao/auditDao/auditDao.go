@@ -0,0 +1,25 @@
+package auditDao
+
+import (
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+
+	"gorm.io/gorm"
+)
+
+const table = "candle_audit"
+
+// News rows
+func News(db *gorm.DB, m []*dbModels.CandleAuditModel) (int, error) {
+
+	if len(m) == 0 {
+		return 0, nil
+	}
+
+	err := db.Table(table).
+		CreateInBatches(m, 3000).Error
+	if err != nil {
+		return 0, err
+	}
+
+	return len(m), nil
+}
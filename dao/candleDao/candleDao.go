@@ -9,9 +9,16 @@ import (
 	"github.com/paper-trade-chatbot/be-proto/general"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-const table = "candle"
+const (
+	table    = "candle"     // every interval but 1MI
+	table1MI = "candle_1mi" // 1MI, range partitioned by start month
+	tableAll = "candle_all" // view of both, for queries of every interval
+)
+
+var ErrUnboundedDelete = errors.New("delete needs an interval type and products")
 
 type OrderColumn int
 
@@ -34,6 +41,43 @@ type Order struct {
 	Direction OrderDirection
 }
 
+type ConflictMode int
+
+const (
+	ConflictMode_None      ConflictMode = iota // fail the whole batch
+	ConflictMode_Skip                          // keep the existing row
+	ConflictMode_Overwrite                     // replace the existing row
+	ConflictMode_Merge                         // keep open, take close, extend high/low, add volume
+	ConflictMode_Extend                        // keep open and close, extend high/low, add volume
+)
+
+type UpsertResult struct {
+	Inserted int
+	Updated  int
+	Skipped  int
+	Revised  []*dbModels.CandleModel // updated rows whose values changed, as stored
+}
+
+// Change is a row before and after a write, Old is nil for an insert and New
+// for a delete
+type Change struct {
+	Old *dbModels.CandleModel
+	New *dbModels.CandleModel
+}
+
+// Cursor is the primary key of the last row of a keyset page
+type Cursor struct {
+	ProductID    uint64
+	IntervalType dbModels.IntervalType
+	Start        time.Time
+}
+
+type candleKey struct {
+	ProductID    uint64
+	IntervalType dbModels.IntervalType
+	Start        int64
+}
+
 // QueryModel set query condition, used by queryChain()
 type QueryModel struct {
 	ProductID    uint64
@@ -47,10 +91,40 @@ type QueryModel struct {
 	Limit        int
 }
 
+// TableOf returns the table holding the candles of intervalType, the view of
+// every table for IntervalType_None.
+func TableOf(intervalType dbModels.IntervalType) string {
+	switch intervalType {
+	case dbModels.IntervalType_None:
+		return tableAll
+	case dbModels.IntervalType_1MI:
+		return table1MI
+	}
+	return table
+}
+
+// PartitionedTables lists the tables range partitioned by start month, see partitionDao.
+func PartitionedTables() []string {
+	return []string{table1MI}
+}
+
+// byTable groups rows by the table holding them, in a stable order.
+func byTable(m []*dbModels.CandleModel) (tables []string, rows map[string][]*dbModels.CandleModel) {
+	rows = map[string][]*dbModels.CandleModel{}
+	for _, c := range m {
+		t := TableOf(c.IntervalType)
+		if _, ok := rows[t]; !ok {
+			tables = append(tables, t)
+		}
+		rows[t] = append(rows[t], c)
+	}
+	return tables, rows
+}
+
 // New a row
 func New(db *gorm.DB, model *dbModels.CandleModel) (int, error) {
 
-	err := db.Table(table).
+	err := db.Table(TableOf(model.IntervalType)).
 		Create(model).Error
 
 	if err != nil {
@@ -64,11 +138,14 @@ func News(db *gorm.DB, m []*dbModels.CandleModel) (int, error) {
 
 	err := db.Transaction(func(tx *gorm.DB) error {
 
-		err := tx.Table(table).
-			CreateInBatches(m, 3000).Error
+		tables, rows := byTable(m)
+		for _, t := range tables {
+			err := tx.Table(t).
+				CreateInBatches(rows[t], 3000).Error
 
-		if err != nil {
-			return err
+			if err != nil {
+				return err
+			}
 		}
 		return nil
 	})
@@ -80,28 +157,377 @@ func News(db *gorm.DB, m []*dbModels.CandleModel) (int, error) {
 	return len(m), nil
 }
 
+// Upserts new rows, resolving rows whose primary key already exists with mode.
+// Rows repeating a key within m are resolved against the earlier row the same way.
+// New rows start at revision 0, an existing row changed by the batch gets the
+// next revision.
+func Upserts(db *gorm.DB, m []*dbModels.CandleModel, mode ConflictMode) (*UpsertResult, error) {
+
+	if mode == ConflictMode_None {
+		count, err := News(db, m)
+		if err != nil {
+			return nil, err
+		}
+		return &UpsertResult{Inserted: count}, nil
+	}
+
+	var result *UpsertResult
+	err := db.Transaction(func(tx *gorm.DB) error {
+
+		existing, err := getsForUpdate(tx, m)
+		if err != nil {
+			return err
+		}
+
+		var inserts []*dbModels.CandleModel
+		result, inserts = planUpserts(m, existing, mode)
+
+		tables, rows := byTable(inserts)
+		for _, t := range tables {
+			if err := tx.Table(t).CreateInBatches(rows[t], 3000).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, u := range result.Revised {
+			if err := update(tx, u); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// planUpserts resolves m against the existing rows with mode, changing them
+// in place. Returns the rows to insert, the changed rows are in Revised.
+func planUpserts(m []*dbModels.CandleModel, existing map[candleKey]*dbModels.CandleModel, mode ConflictMode) (*UpsertResult, []*dbModels.CandleModel) {
+
+	result := &UpsertResult{}
+	inserts := []*dbModels.CandleModel{}
+	pending := map[candleKey]*dbModels.CandleModel{}
+	updates := []*dbModels.CandleModel{}
+	original := map[candleKey]dbModels.CandleModel{}
+
+	for _, c := range m {
+		key := keyOf(c)
+
+		if p, ok := pending[key]; ok {
+			if !resolveConflict(p, c, mode) {
+				result.Skipped++
+				continue
+			}
+			result.Updated++
+			continue
+		}
+
+		e, ok := existing[key]
+		if !ok {
+			row := *c
+			row.Revision = 0
+			pending[key] = &row
+			inserts = append(inserts, &row)
+			continue
+		}
+
+		before := *e
+		if !resolveConflict(e, c, mode) {
+			result.Skipped++
+			continue
+		}
+		if _, ok := original[key]; !ok {
+			original[key] = before
+			updates = append(updates, e)
+		}
+		result.Updated++
+	}
+	result.Inserted = len(inserts)
+
+	for _, u := range updates {
+		if sameValues(u, original[keyOf(u)]) {
+			continue
+		}
+		u.Revision++
+		result.Revised = append(result.Revised, u)
+	}
+
+	return result, inserts
+}
+
+// Modifies replaces the values of the stored rows sharing a primary key with
+// m, the rows whose values change get the next revision. Rows of m not stored
+// are returned in missing.
+func Modifies(db *gorm.DB, m []*dbModels.CandleModel) (changes []*Change, missing []*dbModels.CandleModel, err error) {
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+
+		existing, err := getsForUpdate(tx, m)
+		if err != nil {
+			return err
+		}
+
+		changes, missing = planModifies(m, existing)
+		for _, c := range changes {
+			if err := update(tx, c.New); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+	return changes, missing, nil
+}
+
+// planModifies overwrites the existing rows with m, changing them in place.
+func planModifies(m []*dbModels.CandleModel, existing map[candleKey]*dbModels.CandleModel) (changes []*Change, missing []*dbModels.CandleModel) {
+
+	for _, c := range m {
+		e, ok := existing[keyOf(c)]
+		if !ok {
+			missing = append(missing, c)
+			continue
+		}
+
+		before := *e
+		resolveConflict(e, c, ConflictMode_Overwrite)
+		if sameValues(e, before) {
+			continue
+		}
+		e.Revision++
+
+		after := *e
+		changes = append(changes, &Change{Old: &before, New: &after})
+	}
+	return changes, missing
+}
+
+// update writes the values and revision of a stored row
+func update(tx *gorm.DB, m *dbModels.CandleModel) error {
+	t := TableOf(m.IntervalType)
+	return tx.Table(t).
+		Where(t+".product_id = ? AND "+t+".interval_type = ? AND "+t+".start = ?", m.ProductID, m.IntervalType, m.Start).
+		Updates(map[string]interface{}{
+			"open":     m.Open,
+			"close":    m.Close,
+			"high":     m.High,
+			"low":      m.Low,
+			"volume":   m.Volume,
+			"revision": m.Revision,
+		}).Error
+}
+
+// Deletes removes the rows of an interval type and product(s) matching query,
+// returning them as they were.
+func Deletes(db *gorm.DB, query *QueryModel) ([]*dbModels.CandleModel, error) {
+
+	if query.IntervalType == dbModels.IntervalType_None || (query.ProductID == 0 && len(query.ProductIDIn) == 0) {
+		return nil, ErrUnboundedDelete
+	}
+
+	t := TableOf(query.IntervalType)
+	deleted := []*dbModels.CandleModel{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+
+		err := tx.Table(t).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Scopes(queryChain(t, query)).
+			Find(&deleted).Error
+		if err != nil {
+			return err
+		}
+		if len(deleted) == 0 {
+			return nil
+		}
+
+		return tx.Table(t).
+			Scopes(queryChain(t, query)).
+			Delete(&dbModels.CandleModel{}).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
+
+// DeletesByKeys removes the rows sharing a primary key with m, a statement
+// per chunk of keys so that no lock is held across chunks. Returns the number
+// of rows deleted.
+func DeletesByKeys(db *gorm.DB, m []*dbModels.CandleModel) (int64, error) {
+
+	var deleted int64
+	err := keyChunks(m, func(t string, keys [][]interface{}) error {
+		result := db.Table(t).
+			Where("("+t+".product_id, "+t+".interval_type, "+t+".start) IN ?", keys).
+			Delete(&dbModels.CandleModel{})
+		if result.Error != nil {
+			return result.Error
+		}
+		deleted += result.RowsAffected
+		return nil
+	})
+
+	return deleted, err
+}
+
+// resolveConflict applies incoming onto current according to mode, returns false if skipped
+func resolveConflict(current, incoming *dbModels.CandleModel, mode ConflictMode) bool {
+	switch mode {
+	case ConflictMode_Overwrite:
+		current.Open = incoming.Open
+		current.Close = incoming.Close
+		current.High = incoming.High
+		current.Low = incoming.Low
+		current.Volume = incoming.Volume
+		return true
+	case ConflictMode_Merge:
+		current.Close = incoming.Close
+		if incoming.High.GreaterThan(current.High) {
+			current.High = incoming.High
+		}
+		if incoming.Low.LessThan(current.Low) {
+			current.Low = incoming.Low
+		}
+		current.Volume = current.Volume.Add(incoming.Volume)
+		return true
+	case ConflictMode_Extend:
+		if incoming.High.GreaterThan(current.High) {
+			current.High = incoming.High
+		}
+		if incoming.Low.LessThan(current.Low) {
+			current.Low = incoming.Low
+		}
+		current.Volume = current.Volume.Add(incoming.Volume)
+		return true
+	}
+	return false
+}
+
+func sameValues(m *dbModels.CandleModel, other dbModels.CandleModel) bool {
+	return m.Open.Equal(other.Open) &&
+		m.Close.Equal(other.Close) &&
+		m.High.Equal(other.High) &&
+		m.Low.Equal(other.Low) &&
+		m.Volume.Equal(other.Volume)
+}
+
+// getsForUpdate locks and returns the existing rows sharing a primary key with m
+func getsForUpdate(tx *gorm.DB, m []*dbModels.CandleModel) (map[candleKey]*dbModels.CandleModel, error) {
+	return getsByKeys(tx, m, true)
+}
+
+// GetsByKeys returns the stored rows sharing a primary key with m
+func GetsByKeys(tx *gorm.DB, m []*dbModels.CandleModel) ([]*dbModels.CandleModel, error) {
+
+	existing, err := getsByKeys(tx, m, false)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := []*dbModels.CandleModel{}
+	for _, c := range m {
+		if r, ok := existing[keyOf(c)]; ok {
+			rows = append(rows, r)
+			delete(existing, keyOf(c))
+		}
+	}
+	return rows, nil
+}
+
+func getsByKeys(tx *gorm.DB, m []*dbModels.CandleModel, lock bool) (map[candleKey]*dbModels.CandleModel, error) {
+
+	existing := map[candleKey]*dbModels.CandleModel{}
+	err := keyChunks(m, func(t string, keys [][]interface{}) error {
+		db := tx.Table(t)
+		if lock {
+			db = db.Clauses(clause.Locking{Strength: "UPDATE"})
+		}
+		rows := []*dbModels.CandleModel{}
+		err := db.
+			Where("("+t+".product_id, "+t+".interval_type, "+t+".start) IN ?", keys).
+			Find(&rows).Error
+		if err != nil {
+			return err
+		}
+
+		for _, r := range rows {
+			existing[keyOf(r)] = r
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+// keyChunks calls fn with the primary keys of m, 1000 at a time, table by table.
+func keyChunks(m []*dbModels.CandleModel, fn func(t string, keys [][]interface{}) error) error {
+
+	tables, rows := byTable(m)
+	for _, t := range tables {
+		const chunk = 1000
+		for i := 0; i < len(rows[t]); i += chunk {
+			end := i + chunk
+			if end > len(rows[t]) {
+				end = len(rows[t])
+			}
+
+			keys := [][]interface{}{}
+			for _, c := range rows[t][i:end] {
+				keys = append(keys, []interface{}{c.ProductID, c.IntervalType, c.Start})
+			}
+			if err := fn(t, keys); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func keyOf(m *dbModels.CandleModel) candleKey {
+	return candleKey{
+		ProductID:    m.ProductID,
+		IntervalType: m.IntervalType,
+		Start:        m.Start.Unix(),
+	}
+}
+
 // Get return a record as raw-data-form
 func Get(tx *gorm.DB, query *QueryModel) (*dbModels.CandleModel, error) {
 
+	t := TableOf(query.IntervalType)
 	result := &dbModels.CandleModel{}
-	err := tx.Table(table).
-		Scopes(queryChain(query)).
-		Scan(result).Error
+	scan := tx.Table(t).
+		Scopes(queryChain(t, query)).
+		Limit(1).
+		Scan(result)
 
-	if errors.Is(err, gorm.ErrRecordNotFound) {
+	if errors.Is(scan.Error, gorm.ErrRecordNotFound) || (scan.Error == nil && scan.RowsAffected == 0) {
 		return nil, nil
 	}
-	if err != nil {
-		return nil, err
+	if scan.Error != nil {
+		return nil, scan.Error
 	}
 	return result, nil
 }
 
 // Gets return records as raw-data-form
 func Gets(tx *gorm.DB, query *QueryModel) ([]dbModels.CandleModel, error) {
+	t := TableOf(query.IntervalType)
 	result := make([]dbModels.CandleModel, 0)
-	err := tx.Table(table).
-		Scopes(queryChain(query)).
+	err := tx.Table(t).
+		Scopes(queryChain(t, query)).
 		Scan(&result).Error
 
 	if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -115,12 +541,75 @@ func Gets(tx *gorm.DB, query *QueryModel) ([]dbModels.CandleModel, error) {
 	return result, nil
 }
 
+// GetLatest returns the latest n candles of a product in ascending start order
+func GetLatest(tx *gorm.DB, productID uint64, intervalType dbModels.IntervalType, n int) ([]dbModels.CandleModel, error) {
+	t := TableOf(intervalType)
+	result := make([]dbModels.CandleModel, 0, n)
+	err := tx.Table(t).
+		Scopes(queryChain(t, &QueryModel{
+			ProductID:    productID,
+			IntervalType: intervalType,
+			OrderBy: []*Order{{
+				Column:    OrderColumn_Start,
+				Direction: OrderDirection_DESC,
+			}},
+			Limit: n,
+		})).
+		Scan(&result).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return []dbModels.CandleModel{}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+
+	return result, nil
+}
+
+// GetProductIDs return the distinct product id of matched records
+func GetProductIDs(tx *gorm.DB, query *QueryModel) ([]uint64, error) {
+	t := TableOf(query.IntervalType)
+	result := make([]uint64, 0)
+	err := tx.Table(t).
+		Scopes(queryChain(t, query)).
+		Distinct(t+".product_id").
+		Pluck(t+".product_id", &result).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetStarts return the start of every matched record
+func GetStarts(tx *gorm.DB, query *QueryModel) ([]time.Time, error) {
+	t := TableOf(query.IntervalType)
+	result := make([]time.Time, 0)
+	err := tx.Table(t).
+		Scopes(queryChain(t, query)).
+		Pluck(t+".start", &result).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
 func GetsWithPagination(tx *gorm.DB, query *QueryModel, paginate *general.Pagination) ([]dbModels.CandleModel, *general.PaginationInfo, error) {
 
+	t := TableOf(query.IntervalType)
 	var rows []dbModels.CandleModel
 	var count int64 = 0
-	err := tx.Table(table).
-		Scopes(queryChain(query)).
+	err := tx.Table(t).
+		Scopes(queryChain(t, query)).
 		Count(&count).
 		Scopes(paginateChain(paginate)).
 		Scan(&rows).Error
@@ -139,14 +628,69 @@ func GetsWithPagination(tx *gorm.DB, query *QueryModel, paginate *general.Pagina
 	return rows, paginationInfo, nil
 }
 
-func queryChain(query *QueryModel) func(db *gorm.DB) *gorm.DB {
+// GetsByKeyset returns up to limit rows after cursor (from the first row if nil)
+// in primary key order, descending if query orders start DESC, together with
+// the cursor of the next page, nil on the last page.
+// Unlike GetsWithPagination no COUNT is run and deep pages cost the same as the
+// first one. query.OrderBy only sets the direction, Offset and Limit are ignored.
+func GetsByKeyset(tx *gorm.DB, query *QueryModel, cursor *Cursor, limit int) ([]dbModels.CandleModel, *Cursor, error) {
+
+	desc := false
+	for _, o := range query.OrderBy {
+		if o.Column == OrderColumn_Start {
+			desc = o.Direction == OrderDirection_DESC
+		}
+	}
+
+	keysetQuery := *query
+	keysetQuery.OrderBy = nil
+	keysetQuery.Offset = 0
+	keysetQuery.Limit = 0
+
+	direction := " ASC"
+	if desc {
+		direction = " DESC"
+	}
+
+	t := TableOf(query.IntervalType)
+	rows := make([]dbModels.CandleModel, 0)
+	err := tx.Table(t).
+		Scopes(queryChain(t, &keysetQuery)).
+		Scopes(keysetScope(t, cursor, desc)).
+		Order(t + ".product_id" + direction).
+		Order(t + ".interval_type" + direction).
+		Order(t + ".start" + direction).
+		Limit(limit + 1).
+		Scan(&rows).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return []dbModels.CandleModel{}, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(rows) <= limit {
+		return rows, nil, nil
+	}
+
+	rows = rows[:limit]
+	last := rows[limit-1]
+	return rows, &Cursor{
+		ProductID:    last.ProductID,
+		IntervalType: last.IntervalType,
+		Start:        last.Start,
+	}, nil
+}
+
+func queryChain(t string, query *QueryModel) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
 		return db.
-			Scopes(productIDEqualScope(query.ProductID)).
-			Scopes(intervalTypeEqualScope(query.IntervalType)).
-			Scopes(startEqualScope(query.Start)).
-			Scopes(productIDInScope(query.ProductIDIn)).
-			Scopes(startBetweenScope(query.StartFrom, query.StartTo)).
+			Scopes(productIDEqualScope(t, query.ProductID)).
+			Scopes(intervalTypeEqualScope(t, query.IntervalType)).
+			Scopes(startEqualScope(t, query.Start)).
+			Scopes(productIDInScope(t, query.ProductIDIn)).
+			Scopes(startBetweenScope(t, query.StartFrom, query.StartTo)).
 			Scopes(orderByScope(query.OrderBy)).
 			Scopes(offsetScope(query.Offset)).
 			Scopes(limitScope(query.Limit))
@@ -164,46 +708,46 @@ func paginateChain(paginate *general.Pagination) func(db *gorm.DB) *gorm.DB {
 	}
 }
 
-func productIDEqualScope(productID uint64) func(db *gorm.DB) *gorm.DB {
+func productIDEqualScope(t string, productID uint64) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
 		if productID != 0 {
-			return db.Where(table+".product_id = ?", productID)
+			return db.Where(t+".product_id = ?", productID)
 		}
 		return db
 	}
 }
 
-func intervalTypeEqualScope(intervalType dbModels.IntervalType) func(db *gorm.DB) *gorm.DB {
+func intervalTypeEqualScope(t string, intervalType dbModels.IntervalType) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
 		if intervalType != dbModels.IntervalType_None {
-			return db.Where(table+".interval_type = ?", intervalType)
+			return db.Where(t+".interval_type = ?", intervalType)
 		}
 		return db
 	}
 }
 
-func startEqualScope(start *time.Time) func(db *gorm.DB) *gorm.DB {
+func startEqualScope(t string, start *time.Time) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
 		if start != nil {
-			return db.Where(table+".start = ?", start)
+			return db.Where(t+".start = ?", start)
 		}
 		return db
 	}
 }
 
-func productIDInScope(productIDIn []uint64) func(db *gorm.DB) *gorm.DB {
+func productIDInScope(t string, productIDIn []uint64) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
 		if len(productIDIn) > 0 {
-			return db.Where(table+".product_id IN ?", productIDIn)
+			return db.Where(t+".product_id IN ?", productIDIn)
 		}
 		return db
 	}
 }
 
-func startBetweenScope(startFrom, startTo *time.Time) func(db *gorm.DB) *gorm.DB {
+func startBetweenScope(t string, startFrom, startTo *time.Time) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
 		if startFrom != nil && startTo != nil {
-			return db.Where(table+".start BETWEEN ? AND ?", startFrom, startTo)
+			return db.Where(t+".start BETWEEN ? AND ?", startFrom, startTo)
 		}
 		return db
 	}
@@ -217,6 +761,8 @@ func orderByScope(order []*Order) func(db *gorm.DB) *gorm.DB {
 				switch o.Column {
 				case OrderColumn_Start:
 					orderClause += "start"
+				case OrderColumn_ProductID:
+					orderClause += "product_id"
 				default:
 					continue
 				}
@@ -236,6 +782,20 @@ func orderByScope(order []*Order) func(db *gorm.DB) *gorm.DB {
 	}
 }
 
+func keysetScope(t string, cursor *Cursor, desc bool) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if cursor == nil {
+			return db
+		}
+		comparison := " > "
+		if desc {
+			comparison = " < "
+		}
+		return db.Where("("+t+".product_id, "+t+".interval_type, "+t+".start)"+comparison+"(?, ?, ?)",
+			cursor.ProductID, cursor.IntervalType, cursor.Start)
+	}
+}
+
 func limitScope(limit int) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
 		if limit > 0 {
@@ -248,7 +808,7 @@ func limitScope(limit int) func(db *gorm.DB) *gorm.DB {
 func offsetScope(offset int) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
 		if offset > 0 {
-			return db.Limit(offset)
+			return db.Offset(offset)
 		}
 		return db
 	}
@@ -0,0 +1,109 @@
+package candleDao
+
+import (
+	"time"
+
+	"github.com/paper-trade-chatbot/be-candle/dao/auditDao"
+	"github.com/paper-trade-chatbot/be-candle/dao/partitionDao"
+	"github.com/paper-trade-chatbot/be-candle/dao/precisionDao"
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	"github.com/paper-trade-chatbot/be-proto/general"
+
+	"gorm.io/gorm"
+)
+
+// GormStore keeps the candles in the candle tables of db.
+type GormStore struct {
+	db *gorm.DB
+}
+
+var _ CandleStore = (*GormStore)(nil)
+
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{
+		db: db,
+	}
+}
+
+func (s *GormStore) News(m []*dbModels.CandleModel) (int, error) {
+	return News(s.db, m)
+}
+
+func (s *GormStore) Upserts(m []*dbModels.CandleModel, mode ConflictMode) (*UpsertResult, error) {
+	return Upserts(s.db, m, mode)
+}
+
+func (s *GormStore) Modifies(m []*dbModels.CandleModel) ([]*Change, []*dbModels.CandleModel, error) {
+	return Modifies(s.db, m)
+}
+
+func (s *GormStore) Get(query *QueryModel) (*dbModels.CandleModel, error) {
+	return Get(s.db, query)
+}
+
+func (s *GormStore) Gets(query *QueryModel) ([]dbModels.CandleModel, error) {
+	return Gets(s.db, query)
+}
+
+func (s *GormStore) GetsByKeys(m []*dbModels.CandleModel) ([]*dbModels.CandleModel, error) {
+	return GetsByKeys(s.db, m)
+}
+
+func (s *GormStore) GetStarts(query *QueryModel) ([]time.Time, error) {
+	return GetStarts(s.db, query)
+}
+
+func (s *GormStore) GetsWithPagination(query *QueryModel, paginate *general.Pagination) ([]dbModels.CandleModel, *general.PaginationInfo, error) {
+	return GetsWithPagination(s.db, query, paginate)
+}
+
+func (s *GormStore) GetsByKeyset(query *QueryModel, cursor *Cursor, limit int) ([]dbModels.CandleModel, *Cursor, error) {
+	return GetsByKeyset(s.db, query, cursor, limit)
+}
+
+func (s *GormStore) GetLatest(productID uint64, intervalType dbModels.IntervalType, n int) ([]dbModels.CandleModel, error) {
+	return GetLatest(s.db, productID, intervalType, n)
+}
+
+func (s *GormStore) GetProductIDs(query *QueryModel) ([]uint64, error) {
+	return GetProductIDs(s.db, query)
+}
+
+func (s *GormStore) Deletes(query *QueryModel) ([]*dbModels.CandleModel, error) {
+	return Deletes(s.db, query)
+}
+
+func (s *GormStore) DeletesByKeys(m []*dbModels.CandleModel) (int64, error) {
+	return DeletesByKeys(s.db, m)
+}
+
+func (s *GormStore) Scan(query *QueryModel, batch int) *Iterator {
+	return newIterator(s, query, batch)
+}
+
+func (s *GormStore) GetPrecisions(productIDIn []uint64) (map[uint64]*dbModels.PrecisionModel, error) {
+	return precisionDao.Gets(s.db, productIDIn)
+}
+
+func (s *GormStore) NewAudits(m []*dbModels.CandleAuditModel) error {
+	_, err := auditDao.News(s.db, m)
+	return err
+}
+
+func (s *GormStore) GetPartitions(table string) ([]*dbModels.PartitionModel, error) {
+	return partitionDao.Gets(s.db, table)
+}
+
+func (s *GormStore) AddPartitions(table string, months []time.Time) error {
+	return partitionDao.Adds(s.db, table, months)
+}
+
+func (s *GormStore) DropPartitions(table string, names []string) error {
+	return partitionDao.Drops(s.db, table, names)
+}
+
+func (s *GormStore) Transaction(fn func(tx CandleStore) error) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return fn(NewGormStore(tx))
+	})
+}
@@ -0,0 +1,411 @@
+package candleDao
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	"github.com/paper-trade-chatbot/be-common/pagination"
+	"github.com/paper-trade-chatbot/be-proto/general"
+)
+
+// ErrDuplicateKey is returned by MemoryStore inserting a row whose primary key exists
+var ErrDuplicateKey = errors.New("candle already exists")
+
+// MemoryStore keeps candles in memory, for tests and tools. Rows are returned
+// as copies. Transactions are not isolated from writes made meanwhile outside
+// of them.
+type MemoryStore struct {
+	lock       sync.RWMutex
+	rows       map[candleKey]dbModels.CandleModel
+	precisions map[uint64]*dbModels.PrecisionModel
+	audits     []*dbModels.CandleAuditModel
+}
+
+var _ CandleStore = (*MemoryStore)(nil)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		rows:       map[candleKey]dbModels.CandleModel{},
+		precisions: map[uint64]*dbModels.PrecisionModel{},
+		audits:     []*dbModels.CandleAuditModel{},
+	}
+}
+
+// SetPrecision sets the precision of a product, like a row of candle_precision.
+func (s *MemoryStore) SetPrecision(p *dbModels.PrecisionModel) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.precisions[p.ProductID] = p
+}
+
+// Audits returns the audit trail in insertion order.
+func (s *MemoryStore) Audits() []*dbModels.CandleAuditModel {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return append([]*dbModels.CandleAuditModel{}, s.audits...)
+}
+
+func (s *MemoryStore) News(m []*dbModels.CandleModel) (int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	seen := map[candleKey]bool{}
+	for _, c := range m {
+		key := keyOf(c)
+		if _, ok := s.rows[key]; ok || seen[key] {
+			return 0, ErrDuplicateKey
+		}
+		seen[key] = true
+	}
+	for _, c := range m {
+		s.rows[keyOf(c)] = *c
+	}
+	return len(m), nil
+}
+
+func (s *MemoryStore) Upserts(m []*dbModels.CandleModel, mode ConflictMode) (*UpsertResult, error) {
+
+	if mode == ConflictMode_None {
+		count, err := s.News(m)
+		if err != nil {
+			return nil, err
+		}
+		return &UpsertResult{Inserted: count}, nil
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	result, inserts := planUpserts(m, s.existing(m), mode)
+	for _, c := range inserts {
+		s.rows[keyOf(c)] = *c
+	}
+	for _, u := range result.Revised {
+		s.rows[keyOf(u)] = *u
+	}
+	return result, nil
+}
+
+func (s *MemoryStore) Modifies(m []*dbModels.CandleModel) ([]*Change, []*dbModels.CandleModel, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	changes, missing := planModifies(m, s.existing(m))
+	for _, c := range changes {
+		s.rows[keyOf(c.New)] = *c.New
+	}
+	return changes, missing, nil
+}
+
+// existing returns copies of the stored rows sharing a primary key with m
+func (s *MemoryStore) existing(m []*dbModels.CandleModel) map[candleKey]*dbModels.CandleModel {
+	existing := map[candleKey]*dbModels.CandleModel{}
+	for _, c := range m {
+		if r, ok := s.rows[keyOf(c)]; ok {
+			existing[keyOf(c)] = &r
+		}
+	}
+	return existing
+}
+
+func (s *MemoryStore) Get(query *QueryModel) (*dbModels.CandleModel, error) {
+	limited := *query
+	limited.Limit = 1
+	rows, _ := s.Gets(&limited)
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0], nil
+}
+
+func (s *MemoryStore) Gets(query *QueryModel) ([]dbModels.CandleModel, error) {
+	rows := s.matching(query)
+	sortRows(rows, query.OrderBy)
+	return page(rows, query.Offset, query.Limit), nil
+}
+
+func (s *MemoryStore) GetsByKeys(m []*dbModels.CandleModel) ([]*dbModels.CandleModel, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	rows := []*dbModels.CandleModel{}
+	seen := map[candleKey]bool{}
+	for _, c := range m {
+		key := keyOf(c)
+		if r, ok := s.rows[key]; ok && !seen[key] {
+			seen[key] = true
+			rows = append(rows, &r)
+		}
+	}
+	return rows, nil
+}
+
+func (s *MemoryStore) GetStarts(query *QueryModel) ([]time.Time, error) {
+	rows, _ := s.Gets(query)
+	starts := make([]time.Time, 0, len(rows))
+	for _, r := range rows {
+		starts = append(starts, r.Start)
+	}
+	return starts, nil
+}
+
+func (s *MemoryStore) GetsWithPagination(query *QueryModel, paginate *general.Pagination) ([]dbModels.CandleModel, *general.PaginationInfo, error) {
+	rows, _ := s.Gets(query)
+
+	offset, limit := pagination.GetOffsetAndLimit(paginate)
+	paginationInfo := pagination.SetPaginationDto(paginate.Page, paginate.PageSize, int32(len(rows)), int32(offset))
+
+	return page(rows, offset, limit), paginationInfo, nil
+}
+
+func (s *MemoryStore) GetsByKeyset(query *QueryModel, cursor *Cursor, limit int) ([]dbModels.CandleModel, *Cursor, error) {
+
+	desc := false
+	for _, o := range query.OrderBy {
+		if o.Column == OrderColumn_Start {
+			desc = o.Direction == OrderDirection_DESC
+		}
+	}
+
+	keysetQuery := *query
+	keysetQuery.OrderBy = nil
+	all := s.matching(&keysetQuery)
+	sortRows(all, nil)
+	if desc {
+		for i, j := 0, len(all)-1; i < j; i, j = i+1, j-1 {
+			all[i], all[j] = all[j], all[i]
+		}
+	}
+
+	rows := []dbModels.CandleModel{}
+	for _, r := range all {
+		if cursor != nil {
+			after := lessKey(cursor.key(), keyOf(&r))
+			if desc {
+				after = lessKey(keyOf(&r), cursor.key())
+			}
+			if !after {
+				continue
+			}
+		}
+		rows = append(rows, r)
+		if len(rows) > limit {
+			break
+		}
+	}
+
+	if len(rows) <= limit {
+		return rows, nil, nil
+	}
+
+	rows = rows[:limit]
+	last := rows[limit-1]
+	return rows, &Cursor{
+		ProductID:    last.ProductID,
+		IntervalType: last.IntervalType,
+		Start:        last.Start,
+	}, nil
+}
+
+func (s *MemoryStore) GetLatest(productID uint64, intervalType dbModels.IntervalType, n int) ([]dbModels.CandleModel, error) {
+	rows, _ := s.Gets(&QueryModel{
+		ProductID:    productID,
+		IntervalType: intervalType,
+		OrderBy: []*Order{{
+			Column:    OrderColumn_Start,
+			Direction: OrderDirection_DESC,
+		}},
+		Limit: n,
+	})
+	for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+		rows[i], rows[j] = rows[j], rows[i]
+	}
+	return rows, nil
+}
+
+func (s *MemoryStore) GetProductIDs(query *QueryModel) ([]uint64, error) {
+	productIDs := []uint64{}
+	for _, r := range s.matching(query) {
+		if len(productIDs) == 0 || productIDs[len(productIDs)-1] != r.ProductID {
+			productIDs = append(productIDs, r.ProductID)
+		}
+	}
+	return productIDs, nil
+}
+
+func (s *MemoryStore) Deletes(query *QueryModel) ([]*dbModels.CandleModel, error) {
+
+	if query.IntervalType == dbModels.IntervalType_None || (query.ProductID == 0 && len(query.ProductIDIn) == 0) {
+		return nil, ErrUnboundedDelete
+	}
+
+	rows, _ := s.Gets(query)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	deleted := []*dbModels.CandleModel{}
+	for i := range rows {
+		if _, ok := s.rows[keyOf(&rows[i])]; ok {
+			delete(s.rows, keyOf(&rows[i]))
+			deleted = append(deleted, &rows[i])
+		}
+	}
+	return deleted, nil
+}
+
+func (s *MemoryStore) DeletesByKeys(m []*dbModels.CandleModel) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var deleted int64
+	for _, c := range m {
+		if _, ok := s.rows[keyOf(c)]; ok {
+			delete(s.rows, keyOf(c))
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *MemoryStore) Scan(query *QueryModel, batch int) *Iterator {
+	return newIterator(s, query, batch)
+}
+
+func (s *MemoryStore) GetPrecisions(productIDIn []uint64) (map[uint64]*dbModels.PrecisionModel, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	precisions := map[uint64]*dbModels.PrecisionModel{}
+	for _, productID := range productIDIn {
+		if p, ok := s.precisions[productID]; ok {
+			precisions[productID] = p
+		}
+	}
+	return precisions, nil
+}
+
+func (s *MemoryStore) NewAudits(m []*dbModels.CandleAuditModel) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.audits = append(s.audits, m...)
+	return nil
+}
+
+// GetPartitions returns none, MemoryStore keeps no partitions.
+func (s *MemoryStore) GetPartitions(table string) ([]*dbModels.PartitionModel, error) {
+	return []*dbModels.PartitionModel{}, nil
+}
+
+func (s *MemoryStore) AddPartitions(table string, months []time.Time) error {
+	return nil
+}
+
+func (s *MemoryStore) DropPartitions(table string, names []string) error {
+	return nil
+}
+
+// Transaction restores the rows and audits as they were before fn if it fails.
+func (s *MemoryStore) Transaction(fn func(tx CandleStore) error) error {
+
+	s.lock.RLock()
+	rows := make(map[candleKey]dbModels.CandleModel, len(s.rows))
+	for k, v := range s.rows {
+		rows[k] = v
+	}
+	audits := len(s.audits)
+	s.lock.RUnlock()
+
+	if err := fn(s); err != nil {
+		s.lock.Lock()
+		s.rows = rows
+		s.audits = s.audits[:audits]
+		s.lock.Unlock()
+		return err
+	}
+	return nil
+}
+
+// matching returns copies of the rows matching the conditions of query in
+// primary key order, ignoring OrderBy, Offset and Limit.
+func (s *MemoryStore) matching(query *QueryModel) []dbModels.CandleModel {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	productIDIn := map[uint64]bool{}
+	for _, p := range query.ProductIDIn {
+		productIDIn[p] = true
+	}
+
+	rows := []dbModels.CandleModel{}
+	for _, r := range s.rows {
+		switch {
+		case query.ProductID != 0 && r.ProductID != query.ProductID:
+		case query.IntervalType != dbModels.IntervalType_None && r.IntervalType != query.IntervalType:
+		case query.Start != nil && !r.Start.Equal(*query.Start):
+		case len(productIDIn) > 0 && !productIDIn[r.ProductID]:
+		case query.StartFrom != nil && query.StartTo != nil && (r.Start.Before(*query.StartFrom) || r.Start.After(*query.StartTo)):
+		default:
+			rows = append(rows, r)
+		}
+	}
+	sortRows(rows, nil)
+	return rows
+}
+
+// sortRows sorts rows by orders, then by primary key.
+func sortRows(rows []dbModels.CandleModel, orders []*Order) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := &rows[i], &rows[j]
+		for _, o := range orders {
+			var less, greater bool
+			switch o.Column {
+			case OrderColumn_Start:
+				less, greater = a.Start.Before(b.Start), a.Start.After(b.Start)
+			case OrderColumn_ProductID:
+				less, greater = a.ProductID < b.ProductID, a.ProductID > b.ProductID
+			default:
+				continue
+			}
+			if o.Direction == OrderDirection_DESC {
+				less, greater = greater, less
+			}
+			if less || greater {
+				return less
+			}
+		}
+		return lessKey(keyOf(a), keyOf(b))
+	})
+}
+
+func page(rows []dbModels.CandleModel, offset, limit int) []dbModels.CandleModel {
+	if offset >= len(rows) {
+		return []dbModels.CandleModel{}
+	}
+	rows = rows[offset:]
+	if limit > 0 && limit < len(rows) {
+		rows = rows[:limit]
+	}
+	return rows
+}
+
+func lessKey(a, b candleKey) bool {
+	if a.ProductID != b.ProductID {
+		return a.ProductID < b.ProductID
+	}
+	if a.IntervalType != b.IntervalType {
+		return a.IntervalType < b.IntervalType
+	}
+	return a.Start < b.Start
+}
+
+func (c *Cursor) key() candleKey {
+	return candleKey{
+		ProductID:    c.ProductID,
+		IntervalType: c.IntervalType,
+		Start:        c.Start.Unix(),
+	}
+}
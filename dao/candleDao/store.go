@@ -0,0 +1,115 @@
+package candleDao
+
+import (
+	"time"
+
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	"github.com/paper-trade-chatbot/be-proto/general"
+)
+
+// CandleStore keeps candles, with the precision of each product and the audit
+// trail of the changes made to them. GormStore keeps them in the database,
+// MemoryStore in memory for tests and tools. The methods behave like the
+// functions of this package of the same name.
+type CandleStore interface {
+	// insert and upsert
+	News(m []*dbModels.CandleModel) (int, error)
+	Upserts(m []*dbModels.CandleModel, mode ConflictMode) (*UpsertResult, error)
+	Modifies(m []*dbModels.CandleModel) (changes []*Change, missing []*dbModels.CandleModel, err error)
+
+	// query
+	Get(query *QueryModel) (*dbModels.CandleModel, error)
+	Gets(query *QueryModel) ([]dbModels.CandleModel, error)
+	GetsByKeys(m []*dbModels.CandleModel) ([]*dbModels.CandleModel, error)
+	GetStarts(query *QueryModel) ([]time.Time, error)
+	GetsWithPagination(query *QueryModel, paginate *general.Pagination) ([]dbModels.CandleModel, *general.PaginationInfo, error)
+	GetsByKeyset(query *QueryModel, cursor *Cursor, limit int) ([]dbModels.CandleModel, *Cursor, error)
+
+	// latest n
+	GetLatest(productID uint64, intervalType dbModels.IntervalType, n int) ([]dbModels.CandleModel, error)
+
+	GetProductIDs(query *QueryModel) ([]uint64, error)
+
+	// delete
+	Deletes(query *QueryModel) ([]*dbModels.CandleModel, error)
+	DeletesByKeys(m []*dbModels.CandleModel) (int64, error)
+
+	// range scan
+	Scan(query *QueryModel, batch int) *Iterator
+
+	GetPrecisions(productIDIn []uint64) (map[uint64]*dbModels.PrecisionModel, error)
+	NewAudits(m []*dbModels.CandleAuditModel) error
+
+	// month partitions of a table of PartitionedTables, a store without
+	// partitions has none and deletes expired rows one by one instead
+	GetPartitions(table string) ([]*dbModels.PartitionModel, error)
+	AddPartitions(table string, months []time.Time) error
+	DropPartitions(table string, names []string) error
+
+	// Transaction runs fn with a store whose writes are all kept if fn returns
+	// nil and all discarded otherwise.
+	Transaction(fn func(tx CandleStore) error) error
+}
+
+// Iterator walks the rows matching a query in primary key order, descending
+// if the query orders start DESC, reading batch rows at a time by keyset.
+//
+//	it := store.Scan(query, 1000)
+//	for it.Next() {
+//		c := it.Candle()
+//	}
+//	if err := it.Err(); err != nil {
+type Iterator struct {
+	store  CandleStore
+	query  *QueryModel
+	batch  int
+	rows   []dbModels.CandleModel
+	index  int
+	cursor *Cursor
+	done   bool
+	err    error
+}
+
+func newIterator(store CandleStore, query *QueryModel, batch int) *Iterator {
+	return &Iterator{
+		store: store,
+		query: query,
+		batch: batch,
+		index: -1,
+	}
+}
+
+// Next moves to the next row, false after the last one or on error.
+func (it *Iterator) Next() bool {
+
+	if it.err != nil {
+		return false
+	}
+
+	it.index++
+	if it.index < len(it.rows) {
+		return true
+	}
+	if it.done {
+		return false
+	}
+
+	rows, next, err := it.store.GetsByKeyset(it.query, it.cursor, it.batch)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	it.rows, it.index = rows, 0
+	it.cursor, it.done = next, next == nil
+	return len(it.rows) > 0
+}
+
+// Candle returns the current row.
+func (it *Iterator) Candle() *dbModels.CandleModel {
+	return &it.rows[it.index]
+}
+
+// Err returns the error which stopped the iteration, if any.
+func (it *Iterator) Err() error {
+	return it.err
+}
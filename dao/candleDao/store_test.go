@@ -0,0 +1,356 @@
+package candleDao
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	"github.com/paper-trade-chatbot/be-proto/general"
+	"github.com/shopspring/decimal"
+)
+
+var storeBase = time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+func testCandle(productID uint64, intervalType dbModels.IntervalType, minute int, price int64) *dbModels.CandleModel {
+	p := decimal.NewFromInt(price)
+	return &dbModels.CandleModel{
+		ProductID:    productID,
+		IntervalType: intervalType,
+		Start:        storeBase.Add(time.Duration(minute) * time.Minute),
+		Open:         p,
+		Close:        p,
+		High:         p,
+		Low:          p,
+		Volume:       decimal.NewFromInt(1),
+	}
+}
+
+// seed stores minutes 0..n-1 of 1MI for every product, at price = minute
+func seed(t *testing.T, store CandleStore, n int, productIDs ...uint64) {
+	t.Helper()
+	m := []*dbModels.CandleModel{}
+	for _, productID := range productIDs {
+		for i := 0; i < n; i++ {
+			m = append(m, testCandle(productID, dbModels.IntervalType_1MI, i, int64(i)))
+		}
+	}
+	if _, err := store.News(m); err != nil {
+		t.Fatalf("News: %v", err)
+	}
+}
+
+func starts(rows []dbModels.CandleModel) []int64 {
+	result := []int64{}
+	for _, r := range rows {
+		result = append(result, int64(r.Start.Sub(storeBase)/time.Minute))
+	}
+	return result
+}
+
+func equalInts(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// testCandleStore is the behaviour every CandleStore shares, newStore returns
+// an empty store.
+func testCandleStore(t *testing.T, newStore func() CandleStore) {
+
+	t.Run("News fails on an existing key", func(t *testing.T) {
+		store := newStore()
+		seed(t, store, 1, 1)
+		if _, err := store.News([]*dbModels.CandleModel{testCandle(1, dbModels.IntervalType_1MI, 0, 5)}); err == nil {
+			t.Fatal("want an error")
+		}
+		rows, _ := store.Gets(&QueryModel{ProductID: 1, IntervalType: dbModels.IntervalType_1MI})
+		if len(rows) != 1 || !rows[0].Close.Equal(decimal.NewFromInt(0)) {
+			t.Fatalf("stored row changed: %v", rows)
+		}
+	})
+
+	t.Run("Upserts", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			mode     ConflictMode
+			incoming int64
+			inserted int
+			updated  int
+			skipped  int
+			close    int64
+			revision uint32
+		}{
+			{"skip", ConflictMode_Skip, 5, 1, 0, 1, 0, 0},
+			{"overwrite", ConflictMode_Overwrite, 5, 1, 1, 0, 5, 1},
+			{"overwrite same values", ConflictMode_Overwrite, 0, 1, 1, 0, 0, 0},
+			{"merge", ConflictMode_Merge, 5, 1, 1, 0, 5, 1},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				store := newStore()
+				seed(t, store, 1, 1)
+
+				result, err := store.Upserts([]*dbModels.CandleModel{
+					testCandle(1, dbModels.IntervalType_1MI, 0, tt.incoming),
+					testCandle(1, dbModels.IntervalType_1MI, 1, 1),
+				}, tt.mode)
+				if err != nil {
+					t.Fatalf("Upserts: %v", err)
+				}
+				if result.Inserted != tt.inserted || result.Updated != tt.updated || result.Skipped != tt.skipped {
+					t.Fatalf("got %+v", result)
+				}
+
+				stored, _ := store.Get(&QueryModel{ProductID: 1, IntervalType: dbModels.IntervalType_1MI, Start: &storeBase})
+				if !stored.Close.Equal(decimal.NewFromInt(tt.close)) || stored.Revision != tt.revision {
+					t.Fatalf("stored %v revision %d", stored.Close, stored.Revision)
+				}
+				if len(result.Revised) > 0 && result.Revised[0].Revision != tt.revision {
+					t.Fatalf("revised at revision %d", result.Revised[0].Revision)
+				}
+			})
+		}
+	})
+
+	t.Run("Modifies", func(t *testing.T) {
+		store := newStore()
+		seed(t, store, 2, 1)
+
+		changes, missing, err := store.Modifies([]*dbModels.CandleModel{
+			testCandle(1, dbModels.IntervalType_1MI, 0, 7),
+			testCandle(1, dbModels.IntervalType_1MI, 1, 1), // unchanged
+			testCandle(1, dbModels.IntervalType_1MI, 9, 7),
+		})
+		if err != nil {
+			t.Fatalf("Modifies: %v", err)
+		}
+		if len(changes) != 1 || len(missing) != 1 {
+			t.Fatalf("changes %d, missing %d", len(changes), len(missing))
+		}
+		if !changes[0].Old.Close.Equal(decimal.NewFromInt(0)) || !changes[0].New.Close.Equal(decimal.NewFromInt(7)) || changes[0].New.Revision != 1 {
+			t.Fatalf("change %+v -> %+v", changes[0].Old, changes[0].New)
+		}
+		if stored, _ := store.Get(&QueryModel{ProductID: 1, IntervalType: dbModels.IntervalType_1MI, Start: &missing[0].Start}); stored != nil {
+			t.Fatal("missing candle was inserted")
+		}
+	})
+
+	t.Run("Gets filters and orders", func(t *testing.T) {
+		store := newStore()
+		seed(t, store, 5, 1, 2)
+		from, to := storeBase.Add(time.Minute), storeBase.Add(3*time.Minute)
+
+		rows, err := store.Gets(&QueryModel{
+			ProductIDIn:  []uint64{2},
+			IntervalType: dbModels.IntervalType_1MI,
+			StartFrom:    &from,
+			StartTo:      &to,
+			OrderBy:      []*Order{{Column: OrderColumn_Start, Direction: OrderDirection_DESC}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := starts(rows); !equalInts(got, []int64{3, 2, 1}) {
+			t.Fatalf("got %v", got)
+		}
+		for _, r := range rows {
+			if r.ProductID != 2 {
+				t.Fatalf("product %d", r.ProductID)
+			}
+		}
+	})
+
+	t.Run("GetsWithPagination", func(t *testing.T) {
+		store := newStore()
+		seed(t, store, 5, 1)
+
+		rows, info, err := store.GetsWithPagination(&QueryModel{ProductID: 1, IntervalType: dbModels.IntervalType_1MI}, &general.Pagination{Page: 2, PageSize: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := starts(rows); !equalInts(got, []int64{2, 3}) {
+			t.Fatalf("got %v", got)
+		}
+		if info.TotalRows != 5 || info.TotalPages != 3 {
+			t.Fatalf("info %+v", info)
+		}
+	})
+
+	t.Run("GetsByKeyset pages without overlap", func(t *testing.T) {
+		for _, direction := range []OrderDirection{OrderDirection_ASC, OrderDirection_DESC} {
+			store := newStore()
+			seed(t, store, 5, 1)
+			query := &QueryModel{ProductID: 1, IntervalType: dbModels.IntervalType_1MI, OrderBy: []*Order{{Column: OrderColumn_Start, Direction: direction}}}
+
+			got := []int64{}
+			var cursor *Cursor
+			for pages := 0; ; pages++ {
+				if pages > 5 {
+					t.Fatal("does not end")
+				}
+				rows, next, err := store.GetsByKeyset(query, cursor, 2)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, starts(rows)...)
+				if next == nil {
+					break
+				}
+				cursor = next
+			}
+			want := []int64{0, 1, 2, 3, 4}
+			if direction == OrderDirection_DESC {
+				want = []int64{4, 3, 2, 1, 0}
+			}
+			if !equalInts(got, want) {
+				t.Fatalf("%d: got %v", direction, got)
+			}
+		}
+	})
+
+	t.Run("GetLatest", func(t *testing.T) {
+		store := newStore()
+		seed(t, store, 5, 1, 2)
+
+		rows, err := store.GetLatest(1, dbModels.IntervalType_1MI, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := starts(rows); !equalInts(got, []int64{2, 3, 4}) {
+			t.Fatalf("got %v", got)
+		}
+	})
+
+	t.Run("GetProductIDs", func(t *testing.T) {
+		store := newStore()
+		seed(t, store, 2, 3, 1)
+
+		productIDs, err := store.GetProductIDs(&QueryModel{IntervalType: dbModels.IntervalType_1MI})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := map[uint64]bool{}
+		for _, p := range productIDs {
+			got[p] = true
+		}
+		if len(productIDs) != 2 || !got[1] || !got[3] {
+			t.Fatalf("got %v", productIDs)
+		}
+	})
+
+	t.Run("Deletes", func(t *testing.T) {
+		store := newStore()
+		seed(t, store, 5, 1, 2)
+		from, to := storeBase, storeBase.Add(time.Minute)
+
+		if _, err := store.Deletes(&QueryModel{ProductID: 1}); !errors.Is(err, ErrUnboundedDelete) {
+			t.Fatalf("got %v", err)
+		}
+		deleted, err := store.Deletes(&QueryModel{ProductID: 1, IntervalType: dbModels.IntervalType_1MI, StartFrom: &from, StartTo: &to})
+		if err != nil || len(deleted) != 2 {
+			t.Fatalf("deleted %d, err %v", len(deleted), err)
+		}
+		left, _ := store.Gets(&QueryModel{ProductID: 1, IntervalType: dbModels.IntervalType_1MI})
+		if got := starts(left); !equalInts(got, []int64{2, 3, 4}) {
+			t.Fatalf("left %v", got)
+		}
+		other, _ := store.Gets(&QueryModel{ProductID: 2, IntervalType: dbModels.IntervalType_1MI})
+		if len(other) != 5 {
+			t.Fatalf("other product left %d", len(other))
+		}
+	})
+
+	t.Run("DeletesByKeys", func(t *testing.T) {
+		store := newStore()
+		seed(t, store, 3, 1)
+
+		deleted, err := store.DeletesByKeys([]*dbModels.CandleModel{
+			testCandle(1, dbModels.IntervalType_1MI, 1, 0),
+			testCandle(1, dbModels.IntervalType_1MI, 8, 0),
+		})
+		if err != nil || deleted != 1 {
+			t.Fatalf("deleted %d, err %v", deleted, err)
+		}
+		left, _ := store.Gets(&QueryModel{ProductID: 1, IntervalType: dbModels.IntervalType_1MI})
+		if got := starts(left); !equalInts(got, []int64{0, 2}) {
+			t.Fatalf("left %v", got)
+		}
+	})
+
+	t.Run("Scan", func(t *testing.T) {
+		store := newStore()
+		seed(t, store, 7, 1)
+
+		got := []int64{}
+		it := store.Scan(&QueryModel{ProductID: 1, IntervalType: dbModels.IntervalType_1MI}, 3)
+		for it.Next() {
+			got = append(got, int64(it.Candle().Start.Sub(storeBase)/time.Minute))
+		}
+		if it.Err() != nil {
+			t.Fatal(it.Err())
+		}
+		if !equalInts(got, []int64{0, 1, 2, 3, 4, 5, 6}) {
+			t.Fatalf("got %v", got)
+		}
+	})
+
+	t.Run("Transaction", func(t *testing.T) {
+		store := newStore()
+		seed(t, store, 3, 1)
+		audit := []*dbModels.CandleAuditModel{{ProductID: 1}}
+
+		failed := errors.New("failed")
+		err := store.Transaction(func(tx CandleStore) error {
+			if _, err := tx.Deletes(&QueryModel{ProductID: 1, IntervalType: dbModels.IntervalType_1MI}); err != nil {
+				return err
+			}
+			if err := tx.NewAudits(audit); err != nil {
+				return err
+			}
+			return failed
+		})
+		if !errors.Is(err, failed) {
+			t.Fatalf("got %v", err)
+		}
+		rows, _ := store.Gets(&QueryModel{ProductID: 1, IntervalType: dbModels.IntervalType_1MI})
+		if len(rows) != 3 {
+			t.Fatalf("rolled back to %d rows", len(rows))
+		}
+
+		err = store.Transaction(func(tx CandleStore) error {
+			_, err := tx.Deletes(&QueryModel{ProductID: 1, IntervalType: dbModels.IntervalType_1MI})
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows, _ = store.Gets(&QueryModel{ProductID: 1, IntervalType: dbModels.IntervalType_1MI})
+		if len(rows) != 0 {
+			t.Fatalf("committed with %d rows", len(rows))
+		}
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	testCandleStore(t, func() CandleStore {
+		return NewMemoryStore()
+	})
+
+	t.Run("Transaction discards audits", func(t *testing.T) {
+		store := NewMemoryStore()
+		store.Transaction(func(tx CandleStore) error {
+			tx.NewAudits([]*dbModels.CandleAuditModel{{ProductID: 1}})
+			return errors.New("failed")
+		})
+		if len(store.Audits()) != 0 {
+			t.Fatalf("kept %d audits", len(store.Audits()))
+		}
+	})
+}
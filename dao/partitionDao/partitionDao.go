@@ -0,0 +1,59 @@
+package partitionDao
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+
+	"gorm.io/gorm"
+)
+
+// the partition every table keeps empty above the last month, split by Adds
+const futurePartition = "p_future"
+
+// Gets returns the partitions of a table in order, none if it is not partitioned
+func Gets(tx *gorm.DB, table string) ([]*dbModels.PartitionModel, error) {
+	result := []*dbModels.PartitionModel{}
+	err := tx.Table("information_schema.PARTITIONS").
+		Select("PARTITION_NAME, PARTITION_DESCRIPTION, TABLE_ROWS").
+		Where("TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND PARTITION_NAME IS NOT NULL", table).
+		Order("PARTITION_ORDINAL_POSITION").
+		Scan(&result).Error
+
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Adds splits a partition for each month of months, in ascending order, off
+// the future partition. The future partition should be empty, otherwise its
+// rows are copied.
+func Adds(tx *gorm.DB, table string, months []time.Time) error {
+
+	if len(months) == 0 {
+		return nil
+	}
+
+	partitions := []string{}
+	for _, month := range months {
+		next := month.AddDate(0, 1, 0)
+		partitions = append(partitions, fmt.Sprintf("PARTITION `%s` VALUES LESS THAN (%d)", dbModels.PartitionName(month), next.Unix()))
+	}
+	partitions = append(partitions, "PARTITION `"+futurePartition+"` VALUES LESS THAN MAXVALUE")
+
+	return tx.Exec("ALTER TABLE `" + table + "` REORGANIZE PARTITION `" + futurePartition + "` INTO (" + strings.Join(partitions, ", ") + ")").Error
+}
+
+// Drops removes partitions with their rows
+func Drops(tx *gorm.DB, table string, names []string) error {
+
+	if len(names) == 0 {
+		return nil
+	}
+
+	return tx.Exec("ALTER TABLE `" + table + "` DROP PARTITION `" + strings.Join(names, "`, `") + "`").Error
+}
@@ -0,0 +1,32 @@
+package precisionDao
+
+import (
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+
+	"gorm.io/gorm"
+)
+
+const table = "candle_precision"
+
+// Gets returns the precision of the given products by product id, products
+// without a row are left out.
+func Gets(tx *gorm.DB, productIDIn []uint64) (map[uint64]*dbModels.PrecisionModel, error) {
+
+	result := map[uint64]*dbModels.PrecisionModel{}
+	if len(productIDIn) == 0 {
+		return result, nil
+	}
+
+	rows := []*dbModels.PrecisionModel{}
+	err := tx.Table(table).
+		Where(table+".product_id IN ?", productIDIn).
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range rows {
+		result[r.ProductID] = r
+	}
+	return result, nil
+}
@@ -0,0 +1,9 @@
+-- +migrate Up
+-- a finalized candle corrected afterwards gets the next revision
+ALTER TABLE `be-candle`.`candle`
+    ADD COLUMN `revision` INTEGER UNSIGNED NOT NULL DEFAULT 0 COMMENT '修正次數' AFTER `volume`;
+
+
+-- +migrate Down
+ALTER TABLE `be-candle`.`candle`
+    DROP COLUMN `revision`;
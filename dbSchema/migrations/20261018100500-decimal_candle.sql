@@ -0,0 +1,109 @@
+-- +migrate Up notransaction
+-- DOUBLE(20,10) rounds crypto prices and truncates large volumes. The columns
+-- are widened to DECIMAL(36,18), the per-product precision is kept in
+-- candle_precision and enforced by CreateCandles.
+-- Changing the column type in place would copy the table under a lock. The
+-- candles are copied into candle_decimal instead, the same way as
+-- pt-online-schema-change: triggers mirror every write to candle while
+-- copy_candle_decimal copies the existing rows in chunks of the primary key,
+-- then both tables swap names at once. Each chunk commits on its own, so
+-- candle stays writable throughout and an interrupted run starts over.
+DROP TRIGGER IF EXISTS `be-candle`.`candle_decimal_insert`;
+DROP TRIGGER IF EXISTS `be-candle`.`candle_decimal_update`;
+DROP TRIGGER IF EXISTS `be-candle`.`candle_decimal_delete`;
+DROP PROCEDURE IF EXISTS `be-candle`.`copy_candle_decimal`;
+DROP TABLE IF EXISTS `be-candle`.`candle_decimal`;
+
+CREATE TABLE `be-candle`.`candle_decimal` LIKE `be-candle`.`candle`;
+ALTER TABLE `be-candle`.`candle_decimal`
+    MODIFY `open` DECIMAL(36,18) NOT NULL COMMENT '開盤價',
+    MODIFY `close` DECIMAL(36,18) NOT NULL COMMENT '收盤價',
+    MODIFY `high` DECIMAL(36,18) NOT NULL COMMENT '最高價',
+    MODIFY `low` DECIMAL(36,18) NOT NULL COMMENT '最低價',
+    MODIFY `volume` DECIMAL(36,18) NOT NULL COMMENT '成交量';
+
+CREATE TRIGGER `be-candle`.`candle_decimal_insert` AFTER INSERT ON `be-candle`.`candle` FOR EACH ROW
+REPLACE INTO `be-candle`.`candle_decimal` (`product_id`, `interval_type`, `start`, `open`, `close`, `high`, `low`, `volume`, `revision`)
+VALUES (NEW.`product_id`, NEW.`interval_type`, NEW.`start`, NEW.`open`, NEW.`close`, NEW.`high`, NEW.`low`, NEW.`volume`, NEW.`revision`);
+
+-- the primary key of a candle never changes, an update replaces the same row
+CREATE TRIGGER `be-candle`.`candle_decimal_update` AFTER UPDATE ON `be-candle`.`candle` FOR EACH ROW
+REPLACE INTO `be-candle`.`candle_decimal` (`product_id`, `interval_type`, `start`, `open`, `close`, `high`, `low`, `volume`, `revision`)
+VALUES (NEW.`product_id`, NEW.`interval_type`, NEW.`start`, NEW.`open`, NEW.`close`, NEW.`high`, NEW.`low`, NEW.`volume`, NEW.`revision`);
+
+CREATE TRIGGER `be-candle`.`candle_decimal_delete` AFTER DELETE ON `be-candle`.`candle` FOR EACH ROW
+DELETE FROM `be-candle`.`candle_decimal`
+WHERE `product_id` = OLD.`product_id` AND `interval_type` = OLD.`interval_type` AND `start` = OLD.`start`;
+
+-- copy_candle_decimal walks the primary key one product and interval type at a
+-- time and copies at most chunk_size candles per statement. Rows the triggers
+-- already wrote are newer and kept.
+-- +migrate StatementBegin
+CREATE PROCEDURE `be-candle`.`copy_candle_decimal`(IN chunk_size INT)
+BEGIN
+    DECLARE cur_product INT UNSIGNED;
+    DECLARE cur_interval TINYINT UNSIGNED;
+    DECLARE chunk_start TIMESTAMP;
+    DECLARE chunk_end TIMESTAMP;
+
+    SELECT MIN(`product_id`) INTO cur_product FROM `be-candle`.`candle`;
+    WHILE cur_product IS NOT NULL DO
+        SELECT MIN(`interval_type`) INTO cur_interval FROM `be-candle`.`candle`
+        WHERE `product_id` = cur_product;
+        WHILE cur_interval IS NOT NULL DO
+            SELECT MIN(`start`) INTO chunk_start FROM `be-candle`.`candle`
+            WHERE `product_id` = cur_product AND `interval_type` = cur_interval;
+            WHILE chunk_start IS NOT NULL DO
+                SELECT MAX(`start`) INTO chunk_end FROM (
+                    SELECT `start` FROM `be-candle`.`candle`
+                    WHERE `product_id` = cur_product AND `interval_type` = cur_interval AND `start` >= chunk_start
+                    ORDER BY `start` LIMIT chunk_size
+                ) AS `chunk`;
+
+                INSERT IGNORE INTO `be-candle`.`candle_decimal` (`product_id`, `interval_type`, `start`, `open`, `close`, `high`, `low`, `volume`, `revision`)
+                SELECT `product_id`, `interval_type`, `start`, `open`, `close`, `high`, `low`, `volume`, `revision`
+                FROM `be-candle`.`candle`
+                WHERE `product_id` = cur_product AND `interval_type` = cur_interval AND `start` BETWEEN chunk_start AND chunk_end
+                LOCK IN SHARE MODE;
+
+                SELECT MIN(`start`) INTO chunk_start FROM `be-candle`.`candle`
+                WHERE `product_id` = cur_product AND `interval_type` = cur_interval AND `start` > chunk_end;
+            END WHILE;
+
+            SELECT MIN(`interval_type`) INTO cur_interval FROM `be-candle`.`candle`
+            WHERE `product_id` = cur_product AND `interval_type` > cur_interval;
+        END WHILE;
+
+        SELECT MIN(`product_id`) INTO cur_product FROM `be-candle`.`candle`
+        WHERE `product_id` > cur_product;
+    END WHILE;
+END;
+-- +migrate StatementEnd
+
+CALL `be-candle`.`copy_candle_decimal`(5000);
+DROP PROCEDURE `be-candle`.`copy_candle_decimal`;
+
+-- the triggers move along with the old table and are dropped with it
+RENAME TABLE `be-candle`.`candle` TO `be-candle`.`candle_double`,
+    `be-candle`.`candle_decimal` TO `be-candle`.`candle`;
+DROP TABLE `be-candle`.`candle_double`;
+
+CREATE TABLE IF NOT EXISTS `be-candle`.`candle_precision`
+(
+    `product_id` INTEGER UNSIGNED NOT NULL COMMENT '產品id',
+    `price_precision` TINYINT(4) UNSIGNED NOT NULL COMMENT '價格總位數',
+    `price_scale` TINYINT(4) UNSIGNED NOT NULL COMMENT '價格小數位數',
+    `volume_precision` TINYINT(4) UNSIGNED NOT NULL COMMENT '成交量總位數',
+    `volume_scale` TINYINT(4) UNSIGNED NOT NULL COMMENT '成交量小數位數',
+    PRIMARY KEY (`product_id`)
+) DEFAULT CHARSET=`utf8mb4` COLLATE=`utf8mb4_general_ci` COMMENT 'k線精度';
+
+
+-- +migrate Down
+DROP TABLE IF EXISTS `candle_precision`;
+ALTER TABLE `be-candle`.`candle`
+    MODIFY `open` DOUBLE(20,10) NOT NULL COMMENT '開盤價',
+    MODIFY `close` DOUBLE(20,10) NOT NULL COMMENT '收盤價',
+    MODIFY `high` DOUBLE(20,10) NOT NULL COMMENT '最高價',
+    MODIFY `low` DOUBLE(20,10) NOT NULL COMMENT '最低價',
+    MODIFY `volume` DOUBLE(20,10) NOT NULL COMMENT '成交量';
@@ -0,0 +1,31 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS `be-candle`.`candle_audit`
+(
+    `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `product_id` INTEGER UNSIGNED NOT NULL COMMENT '產品id',
+    `interval_type` TINYINT(4) UNSIGNED NOT NULL COMMENT '區間種類',
+    `start` TIMESTAMP NOT NULL COMMENT '開始時間',
+    `action` VARCHAR(16) NOT NULL COMMENT 'modify, delete, recompute',
+    `old_open` DECIMAL(36,18) NULL COMMENT '修改前開盤價',
+    `old_close` DECIMAL(36,18) NULL COMMENT '修改前收盤價',
+    `old_high` DECIMAL(36,18) NULL COMMENT '修改前最高價',
+    `old_low` DECIMAL(36,18) NULL COMMENT '修改前最低價',
+    `old_volume` DECIMAL(36,18) NULL COMMENT '修改前成交量',
+    `old_revision` INTEGER UNSIGNED NULL COMMENT '修改前修正次數',
+    `new_open` DECIMAL(36,18) NULL COMMENT '修改後開盤價',
+    `new_close` DECIMAL(36,18) NULL COMMENT '修改後收盤價',
+    `new_high` DECIMAL(36,18) NULL COMMENT '修改後最高價',
+    `new_low` DECIMAL(36,18) NULL COMMENT '修改後最低價',
+    `new_volume` DECIMAL(36,18) NULL COMMENT '修改後成交量',
+    `new_revision` INTEGER UNSIGNED NULL COMMENT '修改後修正次數',
+    `request_id` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '請求id',
+    `account` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '操作帳號',
+    `created_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '建立時間',
+    PRIMARY KEY (`id`),
+    INDEX `idx_candle` (`product_id`, `interval_type`, `start`),
+    INDEX `idx_request_id` (`request_id`)
+) DEFAULT CHARSET=`utf8mb4` COLLATE=`utf8mb4_general_ci` COMMENT 'k線修改紀錄';
+
+
+-- +migrate Down
+DROP TABLE IF EXISTS `candle_audit`;
@@ -0,0 +1,99 @@
+-- +migrate Up notransaction
+-- 1MI candles are about half the rows and the first to expire. They move to
+-- candle_1mi, range partitioned by start month so that range scans prune to
+-- the months asked for and expired months are dropped instead of deleted.
+-- p<yyyymm> holds the candles starting in that month, p202610 everything up to
+-- October 2026 as well. The createCandlePartitions cronjob splits p_future,
+-- which stays empty, into the coming months.
+-- move_candle_1mi moves the 1MI rows over in chunks of the primary key, each
+-- copied and deleted in a transaction of its own, so that candle stays
+-- writable meanwhile and an interrupted run resumes where it stopped.
+CREATE TABLE IF NOT EXISTS `be-candle`.`candle_1mi`
+(
+    `product_id` INTEGER UNSIGNED NOT NULL COMMENT '產品id',
+    `interval_type` TINYINT(4) UNSIGNED NOT NULL COMMENT '區間種類 21:1MI',
+    `start` TIMESTAMP NOT NULL COMMENT '開始時間',
+    `open` DECIMAL(36,18) NOT NULL COMMENT '開盤價',
+    `close` DECIMAL(36,18) NOT NULL COMMENT '收盤價',
+    `high` DECIMAL(36,18) NOT NULL COMMENT '最高價',
+    `low` DECIMAL(36,18) NOT NULL COMMENT '最低價',
+    `volume` DECIMAL(36,18) NOT NULL COMMENT '成交量',
+    `revision` INTEGER UNSIGNED NOT NULL DEFAULT 0 COMMENT '修正次數',
+    PRIMARY KEY (`product_id`, `interval_type`, `start`)
+) DEFAULT CHARSET=`utf8mb4` COLLATE=`utf8mb4_general_ci` COMMENT '1分k線'
+PARTITION BY RANGE (UNIX_TIMESTAMP(`start`)) (
+    PARTITION `p202610` VALUES LESS THAN (1793491200), -- 2026-11-01 00:00:00 UTC
+    PARTITION `p202611` VALUES LESS THAN (1796083200), -- 2026-12-01 00:00:00 UTC
+    PARTITION `p202612` VALUES LESS THAN (1798761600), -- 2027-01-01 00:00:00 UTC
+    PARTITION `p202701` VALUES LESS THAN (1801440000), -- 2027-02-01 00:00:00 UTC
+    PARTITION `p_future` VALUES LESS THAN MAXVALUE
+);
+
+DROP PROCEDURE IF EXISTS `be-candle`.`move_candle_1mi`;
+
+-- the copy locks the range it reads until the delete commits, so no candle
+-- written to it meanwhile is deleted without being copied. Rows already in
+-- candle_1mi are newer and kept.
+-- +migrate StatementBegin
+CREATE PROCEDURE `be-candle`.`move_candle_1mi`(IN chunk_size INT)
+BEGIN
+    DECLARE cur_product INT UNSIGNED;
+    DECLARE chunk_start TIMESTAMP;
+    DECLARE chunk_end TIMESTAMP;
+
+    DECLARE EXIT HANDLER FOR SQLEXCEPTION
+    BEGIN
+        ROLLBACK;
+        RESIGNAL;
+    END;
+
+    SELECT MIN(`product_id`) INTO cur_product FROM `be-candle`.`candle`;
+    WHILE cur_product IS NOT NULL DO
+        SELECT MIN(`start`) INTO chunk_start FROM `be-candle`.`candle`
+        WHERE `product_id` = cur_product AND `interval_type` = 21;
+        WHILE chunk_start IS NOT NULL DO
+            START TRANSACTION;
+
+            SELECT MAX(`start`) INTO chunk_end FROM (
+                SELECT `start` FROM `be-candle`.`candle`
+                WHERE `product_id` = cur_product AND `interval_type` = 21 AND `start` >= chunk_start
+                ORDER BY `start` LIMIT chunk_size
+            ) AS `chunk`;
+
+            INSERT IGNORE INTO `be-candle`.`candle_1mi`
+            SELECT `product_id`, `interval_type`, `start`, `open`, `close`, `high`, `low`, `volume`, `revision`
+            FROM `be-candle`.`candle`
+            WHERE `product_id` = cur_product AND `interval_type` = 21 AND `start` BETWEEN chunk_start AND chunk_end
+            FOR UPDATE;
+
+            DELETE FROM `be-candle`.`candle`
+            WHERE `product_id` = cur_product AND `interval_type` = 21 AND `start` BETWEEN chunk_start AND chunk_end;
+
+            COMMIT;
+
+            SELECT MIN(`start`) INTO chunk_start FROM `be-candle`.`candle`
+            WHERE `product_id` = cur_product AND `interval_type` = 21 AND `start` > chunk_end;
+        END WHILE;
+
+        SELECT MIN(`product_id`) INTO cur_product FROM `be-candle`.`candle`
+        WHERE `product_id` > cur_product;
+    END WHILE;
+END;
+-- +migrate StatementEnd
+
+CALL `be-candle`.`move_candle_1mi`(5000);
+DROP PROCEDURE `be-candle`.`move_candle_1mi`;
+
+-- queries of every interval read both tables
+CREATE OR REPLACE VIEW `be-candle`.`candle_all` AS
+SELECT `product_id`, `interval_type`, `start`, `open`, `close`, `high`, `low`, `volume`, `revision` FROM `be-candle`.`candle`
+UNION ALL
+SELECT `product_id`, `interval_type`, `start`, `open`, `close`, `high`, `low`, `volume`, `revision` FROM `be-candle`.`candle_1mi`;
+
+
+-- +migrate Down notransaction
+DROP VIEW IF EXISTS `be-candle`.`candle_all`;
+INSERT INTO `be-candle`.`candle`
+SELECT `product_id`, `interval_type`, `start`, `open`, `close`, `high`, `low`, `volume`, `revision`
+FROM `be-candle`.`candle_1mi`;
+DROP TABLE IF EXISTS `candle_1mi`;
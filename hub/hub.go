@@ -0,0 +1,219 @@
+package hub
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	"github.com/paper-trade-chatbot/be-common/cache"
+	"github.com/paper-trade-chatbot/be-common/config"
+	"github.com/paper-trade-chatbot/be-common/logging"
+)
+
+// Event is a candle pushed to subscribers.
+type Event struct {
+	Candle   *dbModels.CandleModel
+	Complete bool
+}
+
+// Subscription receives the events matching its filter on Events until it is
+// unsubscribed or dropped for falling behind, after which Dropped is closed.
+type Subscription struct {
+	Events  chan *Event
+	Dropped chan struct{}
+
+	productIDs     map[uint64]bool
+	intervalTypes  map[dbModels.IntervalType]bool
+	includePartial bool
+}
+
+// Hub fans out generated candles to subscribers with bounded buffers. Once
+// connected, candles are published through Redis so that the subscribers of
+// every replica receive the candles generated by any of them.
+type Hub struct {
+	lock          sync.RWMutex
+	subscriptions map[*Subscription]bool
+	bufferSize    int
+
+	client        *redis.Client
+	cancel        context.CancelFunc
+	remotePartial map[dbModels.IntervalType]bool // partial candles wanted by other replicas
+}
+
+var hubInstance *Hub
+
+// Initialize creates the global hub.
+func Initialize(ctx context.Context) {
+	hubInstance = NewHub(config.GetInt("CANDLE_STREAM_BUFFER_SIZE"))
+
+	r, _ := cache.GetRedis()
+	hubInstance.Connect(ctx, r.Client)
+
+	logging.Info(ctx, "candle hub initialized")
+}
+
+// Finalize drops every subscriber of the global hub.
+func Finalize() {
+	if hubInstance != nil {
+		hubInstance.Close()
+	}
+}
+
+// GetHub returns the global hub.
+func GetHub() *Hub {
+	return hubInstance
+}
+
+func NewHub(bufferSize int) *Hub {
+	if bufferSize <= 0 {
+		bufferSize = 1
+	}
+	return &Hub{
+		subscriptions: map[*Subscription]bool{},
+		bufferSize:    bufferSize,
+		remotePartial: map[dbModels.IntervalType]bool{},
+	}
+}
+
+// Subscribe registers a subscriber, empty productIDs or intervalTypes match all.
+func (h *Hub) Subscribe(productIDs []uint64, intervalTypes []dbModels.IntervalType, includePartial bool) *Subscription {
+
+	s := &Subscription{
+		Events:         make(chan *Event, h.bufferSize),
+		Dropped:        make(chan struct{}),
+		productIDs:     map[uint64]bool{},
+		intervalTypes:  map[dbModels.IntervalType]bool{},
+		includePartial: includePartial,
+	}
+	for _, id := range productIDs {
+		s.productIDs[id] = true
+	}
+	for _, i := range intervalTypes {
+		s.intervalTypes[i] = true
+	}
+
+	h.lock.Lock()
+	h.subscriptions[s] = true
+	h.lock.Unlock()
+
+	return s
+}
+
+func (h *Hub) Unsubscribe(s *Subscription) {
+	h.lock.Lock()
+	delete(h.subscriptions, s)
+	h.lock.Unlock()
+}
+
+// WantsPartial reports whether anyone, on any replica, subscribed to
+// in-progress candles of intervalType.
+func (h *Hub) WantsPartial(intervalType dbModels.IntervalType) bool {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	if h.remotePartial[intervalType] {
+		return true
+	}
+	return h.wantsPartial(intervalType)
+}
+
+func (h *Hub) wantsPartial(intervalType dbModels.IntervalType) bool {
+	for s := range h.subscriptions {
+		if s.includePartial && (len(s.intervalTypes) == 0 || s.intervalTypes[intervalType]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Publish sends the candles to the subscribers of every replica, or only to
+// the local ones if the hub is not connected or Redis fails.
+func (h *Hub) Publish(models []*dbModels.CandleModel, complete bool) {
+
+	if len(models) == 0 {
+		return
+	}
+	h.lock.RLock()
+	client := h.client
+	h.lock.RUnlock()
+
+	if client != nil {
+		if err := h.publishRemote(context.Background(), client, models, complete); err == nil {
+			return
+		}
+	}
+	h.dispatch(models, complete)
+}
+
+// dispatch never blocks: a subscriber whose buffer is full is dropped.
+func (h *Hub) dispatch(models []*dbModels.CandleModel, complete bool) {
+
+	dropped := []*Subscription{}
+
+	h.lock.RLock()
+	for s := range h.subscriptions {
+		if !s.deliver(models, complete) {
+			dropped = append(dropped, s)
+		}
+	}
+	h.lock.RUnlock()
+
+	if len(dropped) == 0 {
+		return
+	}
+
+	h.lock.Lock()
+	for _, s := range dropped {
+		if h.subscriptions[s] {
+			delete(h.subscriptions, s)
+			close(s.Dropped)
+		}
+	}
+	h.lock.Unlock()
+}
+
+// Close disconnects from Redis and drops every subscriber.
+func (h *Hub) Close() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.cancel != nil {
+		h.cancel()
+		h.cancel = nil
+		h.client = nil
+	}
+
+	for s := range h.subscriptions {
+		delete(h.subscriptions, s)
+		close(s.Dropped)
+	}
+}
+
+// deliver returns false if the buffer is full
+func (s *Subscription) deliver(models []*dbModels.CandleModel, complete bool) bool {
+	for _, m := range models {
+		if !s.match(m, complete) {
+			continue
+		}
+		select {
+		case s.Events <- &Event{Candle: m, Complete: complete}:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Subscription) match(m *dbModels.CandleModel, complete bool) bool {
+	if !complete && !s.includePartial {
+		return false
+	}
+	if len(s.productIDs) > 0 && !s.productIDs[m.ProductID] {
+		return false
+	}
+	if len(s.intervalTypes) > 0 && !s.intervalTypes[m.IntervalType] {
+		return false
+	}
+	return true
+}
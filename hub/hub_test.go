@@ -0,0 +1,77 @@
+package hub
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redismock/v8"
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+)
+
+func TestPublishWithoutRedisDeliversLocally(t *testing.T) {
+	h := NewHub(2)
+	all := h.Subscribe(nil, nil, true)
+	completeOnly := h.Subscribe([]uint64{1}, []dbModels.IntervalType{dbModels.IntervalType_1MI}, false)
+
+	h.Publish([]*dbModels.CandleModel{{ProductID: 1, IntervalType: dbModels.IntervalType_1MI}}, true)
+	h.Publish([]*dbModels.CandleModel{{ProductID: 1, IntervalType: dbModels.IntervalType_1MI}}, false)
+
+	if len(all.Events) != 2 {
+		t.Fatalf("got %d events, want 2", len(all.Events))
+	}
+	if len(completeOnly.Events) != 1 {
+		t.Fatalf("got %d events, want 1", len(completeOnly.Events))
+	}
+	if e := <-completeOnly.Events; !e.Complete {
+		t.Fatal("partial candle delivered to a complete only subscriber")
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	h := NewHub(1)
+	s := h.Subscribe(nil, nil, false)
+
+	models := []*dbModels.CandleModel{{ProductID: 1}, {ProductID: 2}}
+	h.Publish(models, true)
+
+	select {
+	case <-s.Dropped:
+	default:
+		t.Fatal("subscriber not dropped")
+	}
+}
+
+func TestSyncPartialSharesDemand(t *testing.T) {
+	client, mock := redismock.NewClientMock()
+	now := time.Unix(1_800_000_000, 0)
+
+	h := NewHub(1)
+	h.client = client
+	h.Subscribe(nil, []dbModels.IntervalType{dbModels.IntervalType_1HR}, true)
+
+	mock.ExpectHSet(partialKey, strconv.Itoa(int(dbModels.IntervalType_1HR)), strconv.FormatInt(now.Add(partialTTL).Unix(), 10)).SetVal(1)
+	mock.ExpectHGetAll(partialKey).SetVal(map[string]string{
+		strconv.Itoa(int(dbModels.IntervalType_1HR)): strconv.FormatInt(now.Add(partialTTL).Unix(), 10),
+		strconv.Itoa(int(dbModels.IntervalType_1DY)): strconv.FormatInt(now.Add(time.Second).Unix(), 10),
+		strconv.Itoa(int(dbModels.IntervalType_1WK)): strconv.FormatInt(now.Add(-time.Second).Unix(), 10),
+	})
+
+	if err := h.syncPartial(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !h.WantsPartial(dbModels.IntervalType_1DY) {
+		t.Error("1DY wanted by another replica")
+	}
+	if h.WantsPartial(dbModels.IntervalType_1WK) {
+		t.Error("1WK demand expired")
+	}
+	if h.WantsPartial(dbModels.IntervalType_5MI) {
+		t.Error("5MI wanted by nobody")
+	}
+}
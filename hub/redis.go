@@ -0,0 +1,158 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	"github.com/paper-trade-chatbot/be-common/logging"
+)
+
+const (
+	// candleChannel carries every published message to the hub of every replica
+	candleChannel = "candle:hub:candles"
+	// partialKey maps the interval types someone subscribed to in-progress
+	// candles of to the unix time the demand expires at
+	partialKey      = "candle:hub:partial"
+	partialInterval = time.Second * 10
+	partialTTL      = partialInterval * 3
+)
+
+type message struct {
+	Candles  []*dbModels.CandleModel `json:"candles"`
+	Complete bool                    `json:"complete"`
+}
+
+// Connect publishes through client from now on and delivers what any replica
+// publishes to the local subscribers until ctx is done or the hub is closed.
+func (h *Hub) Connect(ctx context.Context, client *redis.Client) {
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	// subscribe before publishing through Redis so that no message of this replica is lost
+	sub := client.Subscribe(ctx, candleChannel)
+	if _, err := sub.Receive(ctx); err != nil {
+		logging.Error(ctx, "[Connect] subscribe err: %v", err)
+		sub.Close()
+		cancel()
+		return
+	}
+
+	h.lock.Lock()
+	h.client = client
+	h.cancel = cancel
+	h.lock.Unlock()
+
+	go h.receive(ctx, sub)
+	go h.sharePartial(ctx)
+}
+
+func (h *Hub) publishRemote(ctx context.Context, client *redis.Client, models []*dbModels.CandleModel, complete bool) error {
+
+	payload, err := json.Marshal(&message{Candles: models, Complete: complete})
+	if err != nil {
+		logging.Error(ctx, "[Publish] marshal err: %v", err)
+		return err
+	}
+	if err := client.Publish(ctx, candleChannel, payload).Err(); err != nil {
+		logging.Error(ctx, "[Publish] redis err: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (h *Hub) receive(ctx context.Context, sub *redis.PubSub) {
+
+	defer sub.Close()
+
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			m := &message{}
+			if err := json.Unmarshal([]byte(msg.Payload), m); err != nil {
+				logging.Error(ctx, "[Hub] unmarshal err: %v", err)
+				continue
+			}
+			h.dispatch(m.Candles, m.Complete)
+		}
+	}
+}
+
+// sharePartial periodically records the partial candles the local
+// subscribers want and reads those of the other replicas, so that the
+// replica generating them publishes them.
+func (h *Hub) sharePartial(ctx context.Context) {
+
+	ticker := time.NewTicker(partialInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := h.syncPartial(ctx, time.Now()); err != nil {
+			logging.Warn(ctx, "[Hub] sync partial err: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *Hub) syncPartial(ctx context.Context, now time.Time) error {
+
+	h.lock.RLock()
+	client := h.client
+	h.lock.RUnlock()
+	if client == nil {
+		return nil
+	}
+
+	deadline := strconv.FormatInt(now.Add(partialTTL).Unix(), 10)
+
+	wanted := map[string]interface{}{}
+	h.lock.RLock()
+	for _, intervalType := range dbModels.IntervalTypes {
+		if h.wantsPartial(intervalType) {
+			wanted[strconv.Itoa(int(intervalType))] = deadline
+		}
+	}
+	h.lock.RUnlock()
+
+	if len(wanted) > 0 {
+		if err := client.HSet(ctx, partialKey, wanted).Err(); err != nil {
+			return err
+		}
+	}
+
+	all, err := client.HGetAll(ctx, partialKey).Result()
+	if err != nil {
+		return err
+	}
+
+	remote := map[dbModels.IntervalType]bool{}
+	for field, value := range all {
+		intervalType, err := strconv.Atoi(field)
+		if err != nil {
+			continue
+		}
+		if until, err := strconv.ParseInt(value, 10, 64); err == nil && until > now.Unix() {
+			remote[dbModels.IntervalType(intervalType)] = true
+		}
+	}
+
+	h.lock.Lock()
+	h.remotePartial = remote
+	h.lock.Unlock()
+
+	return nil
+}
@@ -0,0 +1,297 @@
+package indicator
+
+import (
+	"errors"
+
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	"github.com/shopspring/decimal"
+)
+
+// precision of divisions, same as decimal.DivisionPrecision
+const precision = 16
+
+type Type string
+
+const (
+	Type_SMA  Type = "SMA"
+	Type_EMA  Type = "EMA"
+	Type_RSI  Type = "RSI"
+	Type_MACD Type = "MACD"
+	Type_BB   Type = "BB"
+	Type_ATR  Type = "ATR"
+)
+
+// MaxPeriod bounds every period of a spec, which bounds the warm-up read
+// before the window to MaxPeriod*4 candles
+const MaxPeriod = 1000
+
+var ErrInvalidSpec = errors.New("invalid indicator spec")
+
+// Spec is one requested indicator. Period is used by SMA, EMA, RSI, BB and
+// ATR, Fast/Slow/Signal by MACD and StdDev (default 2) by BB.
+type Spec struct {
+	Type   Type   `json:"type"`
+	Period int    `json:"period,omitempty"`
+	Fast   int    `json:"fast,omitempty"`
+	Slow   int    `json:"slow,omitempty"`
+	Signal int    `json:"signal,omitempty"`
+	StdDev string `json:"stdDev,omitempty"`
+}
+
+// Series maps output line names to values aligned with the input candles,
+// nil where the indicator is not defined yet.
+type Series map[string][]*decimal.Decimal
+
+func (s Spec) Validate() error {
+	switch s.Type {
+	case Type_SMA, Type_EMA, Type_RSI, Type_BB, Type_ATR:
+		if s.Period <= 0 || s.Period > MaxPeriod {
+			return ErrInvalidSpec
+		}
+	case Type_MACD:
+		if s.Fast <= 0 || s.Slow <= s.Fast || s.Slow > MaxPeriod || s.Signal <= 0 || s.Signal > MaxPeriod {
+			return ErrInvalidSpec
+		}
+	default:
+		return ErrInvalidSpec
+	}
+	if s.StdDev != "" {
+		if _, err := decimal.NewFromString(s.StdDev); err != nil {
+			return ErrInvalidSpec
+		}
+	}
+	return nil
+}
+
+// WarmUp returns how many candles before the first output are needed.
+// Exponential indicators get three periods so that the seed has faded out.
+func (s Spec) WarmUp() int {
+	switch s.Type {
+	case Type_SMA, Type_BB:
+		return s.Period - 1
+	case Type_EMA, Type_RSI, Type_ATR:
+		return s.Period * 3
+	case Type_MACD:
+		return s.Slow*3 + s.Signal
+	}
+	return 0
+}
+
+// Compute calculates the indicator over candles sorted by start.
+func Compute(s Spec, candles []dbModels.CandleModel) (Series, error) {
+
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
+	closes := make([]decimal.Decimal, len(candles))
+	for i, c := range candles {
+		closes[i] = c.Close
+	}
+
+	switch s.Type {
+	case Type_SMA:
+		return Series{"sma": sma(closes, s.Period)}, nil
+	case Type_EMA:
+		return Series{"ema": ema(closes, s.Period)}, nil
+	case Type_RSI:
+		return Series{"rsi": rsi(closes, s.Period)}, nil
+	case Type_MACD:
+		return macd(closes, s.Fast, s.Slow, s.Signal), nil
+	case Type_BB:
+		k := decimal.NewFromInt(2)
+		if s.StdDev != "" {
+			k, _ = decimal.NewFromString(s.StdDev)
+		}
+		return bollinger(closes, s.Period, k), nil
+	case Type_ATR:
+		return Series{"atr": atr(candles, s.Period)}, nil
+	}
+	return nil, ErrInvalidSpec
+}
+
+func sma(values []decimal.Decimal, period int) []*decimal.Decimal {
+	result := make([]*decimal.Decimal, len(values))
+	n := decimal.NewFromInt(int64(period))
+	sum := decimal.Zero
+	for i, v := range values {
+		sum = sum.Add(v)
+		if i >= period {
+			sum = sum.Sub(values[i-period])
+		}
+		if i >= period-1 {
+			avg := sum.DivRound(n, precision)
+			result[i] = &avg
+		}
+	}
+	return result
+}
+
+// ema is seeded with the SMA of the first period values
+func ema(values []decimal.Decimal, period int) []*decimal.Decimal {
+	result := make([]*decimal.Decimal, len(values))
+	if len(values) < period {
+		return result
+	}
+
+	alpha := decimal.NewFromInt(2).DivRound(decimal.NewFromInt(int64(period+1)), precision)
+	result[period-1] = sma(values[:period], period)[period-1]
+	prev := *result[period-1]
+	for i := period; i < len(values); i++ {
+		next := values[i].Sub(prev).Mul(alpha).Add(prev).Round(precision)
+		result[i] = &next
+		prev = next
+	}
+	return result
+}
+
+// wilder is the smoothed moving average used by RSI and ATR
+func wilder(values []decimal.Decimal, period int) []*decimal.Decimal {
+	result := make([]*decimal.Decimal, len(values))
+	if len(values) < period {
+		return result
+	}
+
+	n := decimal.NewFromInt(int64(period))
+	result[period-1] = sma(values[:period], period)[period-1]
+	prev := *result[period-1]
+	for i := period; i < len(values); i++ {
+		next := prev.Mul(n.Sub(decimal.NewFromInt(1))).Add(values[i]).DivRound(n, precision)
+		result[i] = &next
+		prev = next
+	}
+	return result
+}
+
+func rsi(values []decimal.Decimal, period int) []*decimal.Decimal {
+	result := make([]*decimal.Decimal, len(values))
+	if len(values) <= period {
+		return result
+	}
+
+	gains := make([]decimal.Decimal, len(values)-1)
+	losses := make([]decimal.Decimal, len(values)-1)
+	for i := 1; i < len(values); i++ {
+		change := values[i].Sub(values[i-1])
+		if change.IsPositive() {
+			gains[i-1] = change
+		} else {
+			losses[i-1] = change.Neg()
+		}
+	}
+
+	hundred := decimal.NewFromInt(100)
+	avgGains := wilder(gains, period)
+	avgLosses := wilder(losses, period)
+	for i := range gains {
+		if avgGains[i] == nil {
+			continue
+		}
+		v := hundred
+		if !avgLosses[i].IsZero() {
+			rs := avgGains[i].DivRound(*avgLosses[i], precision)
+			v = hundred.Sub(hundred.DivRound(rs.Add(decimal.NewFromInt(1)), precision))
+		}
+		result[i+1] = &v
+	}
+	return result
+}
+
+func macd(values []decimal.Decimal, fast, slow, signal int) Series {
+	line := make([]*decimal.Decimal, len(values))
+	signalLine := make([]*decimal.Decimal, len(values))
+	histogram := make([]*decimal.Decimal, len(values))
+
+	fastEMA := ema(values, fast)
+	slowEMA := ema(values, slow)
+
+	defined := []decimal.Decimal{}
+	for i := range values {
+		if fastEMA[i] == nil || slowEMA[i] == nil {
+			continue
+		}
+		v := fastEMA[i].Sub(*slowEMA[i])
+		line[i] = &v
+		defined = append(defined, v)
+	}
+
+	// the signal line is the EMA of the defined part of the MACD line
+	offset := len(values) - len(defined)
+	for j, v := range ema(defined, signal) {
+		if v == nil {
+			continue
+		}
+		signalLine[offset+j] = v
+		h := line[offset+j].Sub(*v)
+		histogram[offset+j] = &h
+	}
+
+	return Series{
+		"macd":      line,
+		"signal":    signalLine,
+		"histogram": histogram,
+	}
+}
+
+func bollinger(values []decimal.Decimal, period int, k decimal.Decimal) Series {
+	upper := make([]*decimal.Decimal, len(values))
+	lower := make([]*decimal.Decimal, len(values))
+	middle := sma(values, period)
+
+	n := decimal.NewFromInt(int64(period))
+	for i := range values {
+		if middle[i] == nil {
+			continue
+		}
+		variance := decimal.Zero
+		for _, v := range values[i-period+1 : i+1] {
+			d := v.Sub(*middle[i])
+			variance = variance.Add(d.Mul(d))
+		}
+		width := sqrt(variance.DivRound(n, precision)).Mul(k)
+		u := middle[i].Add(width)
+		l := middle[i].Sub(width)
+		upper[i] = &u
+		lower[i] = &l
+	}
+
+	return Series{
+		"upper":  upper,
+		"middle": middle,
+		"lower":  lower,
+	}
+}
+
+func atr(candles []dbModels.CandleModel, period int) []*decimal.Decimal {
+	trueRanges := make([]decimal.Decimal, len(candles))
+	for i, c := range candles {
+		tr := c.High.Sub(c.Low)
+		if i > 0 {
+			prevClose := candles[i-1].Close
+			tr = decimal.Max(tr, c.High.Sub(prevClose).Abs(), c.Low.Sub(prevClose).Abs())
+		}
+		trueRanges[i] = tr
+	}
+	return wilder(trueRanges, period)
+}
+
+// sqrt by Newton's method, decimal has no square root
+func sqrt(d decimal.Decimal) decimal.Decimal {
+	if !d.IsPositive() {
+		return decimal.Zero
+	}
+
+	two := decimal.NewFromInt(2)
+	x := d
+	if d.GreaterThan(decimal.NewFromInt(1)) {
+		x = d.DivRound(two, precision)
+	}
+	for i := 0; i < 100; i++ {
+		next := x.Add(d.DivRound(x, precision)).DivRound(two, precision)
+		if next.Equal(x) {
+			break
+		}
+		x = next
+	}
+	return x
+}
@@ -0,0 +1,199 @@
+package ingest
+
+import (
+	"time"
+
+	"github.com/paper-trade-chatbot/be-candle/calendar"
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	"github.com/shopspring/decimal"
+)
+
+// bucket is the closed minutes of the forming bucket of a coarser interval,
+// candle is nil until one of them closed.
+type bucket struct {
+	start  time.Time
+	candle *dbModels.CandleModel
+}
+
+// builder keeps the forming candles of one product. Like quotes, a 1MI candle
+// covers the ticks within (start, start+1m].
+type builder struct {
+	productID uint64
+
+	minute     *dbModels.CandleModel // forming 1MI
+	ids        []string              // messages of minute
+	nextMinute time.Time             // the minute after the last closed one
+	lastClose  *decimal.Decimal
+
+	buckets map[dbModels.IntervalType]*bucket
+}
+
+func newBuilder(productID uint64) *builder {
+	return &builder{
+		productID: productID,
+		buckets:   map[dbModels.IntervalType]*bucket{},
+	}
+}
+
+func candleStart(at time.Time) time.Time {
+	return at.Add(-time.Nanosecond).Truncate(time.Minute)
+}
+
+// isLate reports whether the minute of t already closed.
+func (b *builder) isLate(t *Tick) bool {
+	start := candleStart(t.At)
+	if b.minute != nil {
+		return start.Before(b.minute.Start)
+	}
+	return start.Before(b.nextMinute)
+}
+
+// add applies t to the forming minute, which must be the minute of t or not exist.
+func (b *builder) add(id string, t *Tick) {
+	if b.minute == nil {
+		b.minute = &dbModels.CandleModel{
+			ProductID:    b.productID,
+			IntervalType: dbModels.IntervalType_1MI,
+			Start:        candleStart(t.At),
+			Open:         t.Price,
+			Close:        t.Price,
+			High:         t.Price,
+			Low:          t.Price,
+		}
+	}
+	merge(b.minute, &dbModels.CandleModel{
+		Close:  t.Price,
+		High:   t.Price,
+		Low:    t.Price,
+		Volume: t.Size,
+	})
+	b.ids = append(b.ids, id)
+	price := t.Price
+	b.lastClose = &price
+}
+
+// close takes the candles ending by until: the forming minute and, while the
+// exchange trades, flat minutes at the last close after it, together with the
+// buckets of the tracked intervals they complete.
+func (b *builder) close(until time.Time, c *calendar.Calendar) (models, completed []*dbModels.CandleModel, ids []string) {
+
+	models = []*dbModels.CandleModel{}
+	completed = []*dbModels.CandleModel{}
+	if b.minute != nil {
+		if b.minute.Start.Add(time.Minute).After(until) {
+			return models, completed, nil
+		}
+		models = append(models, b.minute)
+		ids = b.ids
+		b.nextMinute = b.minute.Start.Add(time.Minute)
+		b.minute = nil
+		b.ids = nil
+	}
+
+	if b.lastClose != nil && !b.nextMinute.IsZero() {
+		m := b.nextMinute
+		for ; !m.Add(time.Minute).After(until); m = m.Add(time.Minute) {
+			if c.IsOpen(m) {
+				models = append(models, &dbModels.CandleModel{
+					ProductID:    b.productID,
+					IntervalType: dbModels.IntervalType_1MI,
+					Start:        m,
+					Open:         *b.lastClose,
+					Close:        *b.lastClose,
+					High:         *b.lastClose,
+					Low:          *b.lastClose,
+				})
+			}
+		}
+		b.nextMinute = m
+	}
+
+	for _, m := range models {
+		completed = append(completed, b.closeInBuckets(m, c.Anchor)...)
+	}
+	return models, completed, ids
+}
+
+// closeInBuckets adds a closed minute to the bucket of every tracked interval,
+// returning the buckets completed: by their last minute, or by a minute of a
+// later bucket if the exchange stopped trading before their end. A tracked
+// bucket holds every closed minute since it was seeded or opened, so these
+// are whole.
+func (b *builder) closeInBuckets(m *dbModels.CandleModel, anchor dbModels.Anchor) []*dbModels.CandleModel {
+
+	completed := []*dbModels.CandleModel{}
+	for intervalType, bk := range b.buckets {
+		start := anchor.Truncate(intervalType, m.Start)
+		if !bk.start.Equal(start) {
+			if bk.candle != nil {
+				completed = append(completed, bk.candle)
+			}
+			bk.start = start
+			bk.candle = nil
+		}
+		if bk.candle == nil {
+			c := *m
+			c.IntervalType = intervalType
+			c.Start = start
+			bk.candle = &c
+		} else {
+			merge(bk.candle, m)
+		}
+
+		if !anchor.Next(intervalType, start).After(m.Start.Add(time.Minute)) {
+			completed = append(completed, bk.candle)
+			bk.candle = nil
+		}
+	}
+	return completed
+}
+
+// forming returns the forming candle of intervalType, ok is false if its
+// bucket has to be seeded with the minutes closed before tracking began.
+func (b *builder) forming(intervalType dbModels.IntervalType, anchor dbModels.Anchor) (candle *dbModels.CandleModel, ok bool) {
+
+	if b.minute == nil {
+		return nil, true
+	}
+	if intervalType == dbModels.IntervalType_1MI {
+		c := *b.minute
+		return &c, true
+	}
+
+	start := anchor.Truncate(intervalType, b.minute.Start)
+	bk, tracked := b.buckets[intervalType]
+	if !tracked || !bk.start.Equal(start) {
+		if !start.Equal(b.minute.Start) {
+			return nil, false
+		}
+		// the bucket opens with this minute
+		bk = &bucket{start: start}
+		b.buckets[intervalType] = bk
+	}
+
+	c := *b.minute
+	c.IntervalType = intervalType
+	c.Start = start
+	if bk.candle != nil {
+		c = *bk.candle
+		merge(&c, b.minute)
+	}
+	return &c, true
+}
+
+// seed starts tracking the bucket of intervalType with its closed minutes so far.
+func (b *builder) seed(intervalType dbModels.IntervalType, start time.Time, closed *dbModels.CandleModel) {
+	b.buckets[intervalType] = &bucket{start: start, candle: closed}
+}
+
+// merge adds the later candle next onto c.
+func merge(c, next *dbModels.CandleModel) {
+	c.Close = next.Close
+	if next.High.GreaterThan(c.High) {
+		c.High = next.High
+	}
+	if next.Low.LessThan(c.Low) {
+		c.Low = next.Low
+	}
+	c.Volume = c.Volume.Add(next.Volume)
+}
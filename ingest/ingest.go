@@ -0,0 +1,390 @@
+package ingest
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/paper-trade-chatbot/be-candle/aggregation"
+	"github.com/paper-trade-chatbot/be-candle/calendar"
+	"github.com/paper-trade-chatbot/be-candle/correction"
+	"github.com/paper-trade-chatbot/be-candle/cronjob/lease"
+	"github.com/paper-trade-chatbot/be-candle/dao/candleDao"
+	"github.com/paper-trade-chatbot/be-candle/hub"
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	"github.com/paper-trade-chatbot/be-candle/seriesCache"
+	"github.com/paper-trade-chatbot/be-common/config"
+	"github.com/paper-trade-chatbot/be-common/logging"
+)
+
+const (
+	Mode_Poll   = "poll"   // the generate1MICandle cronjob polls the quote service
+	Mode_Stream = "stream" // the Ingestor consumes the tick stream
+
+	// ticks may arrive this late before their minute is closed
+	grace     = time.Second * 2
+	readCount = 1000
+	readBlock = time.Second
+
+	// one instance consumes the stream at a time
+	leaderKey        = "candle:ingest:leader"
+	leaderFencingKey = "candle:ingest:fencing"
+	leaderTTL        = time.Second * 10
+	// a fixed consumer name lets the next leader read what the last one left pending
+	consumerName = "be-candle"
+	retryDelay   = time.Second * 5
+)
+
+// Ingestor builds candles from a tick stream. Closed 1MI candles are stored
+// and their messages acked only then, so after a restart the ticks of every
+// minute not stored yet are delivered again and the minute is rebuilt whole.
+// The forming candles of coarser intervals someone subscribed to are published
+// to the hub as ticks come in, and stored once their bucket completes; every
+// coarser interval is stored by the generateAggregatedCandle cronjob as well.
+// Minutes without ticks get a flat candle at the last close while the exchange
+// trades, once the product ticked since the start.
+// Ticks of a minute already closed extend the stored candle through the
+// corrector if the minute is still within its grace window, and are dropped
+// otherwise.
+type Ingestor struct {
+	Source        TickSource
+	CatchUpWindow time.Duration
+	Corrector     *correction.Corrector
+	Store         candleDao.CandleStore
+
+	builders  map[uint64]*builder
+	closed    []*dbModels.CandleModel
+	completed []*dbModels.CandleModel // coarser buckets
+	ackIDs    []string
+	late      []*correction.Tick
+	lateIDs   []string
+}
+
+var ingestorInstance *Ingestor
+var cancelIngest context.CancelFunc
+
+// Initialize starts consuming CANDLE_INGEST_STREAM if CANDLE_INGEST_MODE is stream.
+// The generate1MICandle cronjob should be disabled then.
+func Initialize(ctx context.Context, store candleDao.CandleStore) {
+
+	mode := config.GetString("CANDLE_INGEST_MODE")
+	if mode != Mode_Stream {
+		logging.Info(ctx, "candle ingest mode: %s", mode)
+		return
+	}
+
+	source := NewRedisStreamSource(
+		config.GetString("CANDLE_INGEST_STREAM"),
+		config.GetString("CANDLE_INGEST_GROUP"),
+		consumerName,
+	)
+	ingestorInstance = New(source, time.Duration(config.GetInt("CANDLE_CATCH_UP_MINUTES"))*time.Minute, correction.GetCorrector(), store)
+
+	var ingestCtx context.Context
+	ingestCtx, cancelIngest = context.WithCancel(context.Background())
+	go ingestorInstance.Run(ingestCtx)
+	logging.Info(ctx, "candle ingest mode: %s", mode)
+}
+
+// Finalize stops consuming.
+func Finalize() {
+	if cancelIngest != nil {
+		cancelIngest()
+	}
+}
+
+// GetIngestor returns the global ingestor, nil unless in stream mode.
+func GetIngestor() *Ingestor {
+	return ingestorInstance
+}
+
+func New(source TickSource, catchUpWindow time.Duration, corrector *correction.Corrector, store candleDao.CandleStore) *Ingestor {
+	return &Ingestor{
+		Source:        source,
+		CatchUpWindow: catchUpWindow,
+		Corrector:     corrector,
+		Store:         store,
+	}
+}
+
+// Run consumes the stream while holding the leader lease, until ctx is done.
+// Any error drops the in-memory state and resumes from the last ack.
+func (i *Ingestor) Run(ctx context.Context) {
+
+	owner, _ := uuid.NewV4()
+	runCtx := context.WithValue(ctx, logging.ContextKeyRequestId, owner.String())
+
+	for runCtx.Err() == nil {
+		l, err := lease.Acquire(runCtx, leaderKey, leaderFencingKey, owner.String(), leaderTTL)
+		if err != nil {
+			logging.Error(runCtx, "[Ingestor] acquire lease error: %v", err)
+		}
+		if l == nil {
+			sleep(runCtx, leaderTTL/3)
+			continue
+		}
+
+		logging.Info(runCtx, "[Ingestor] leading with token %d", l.Token)
+		leaderCtx, cancel := context.WithCancel(lease.WithLease(runCtx, l))
+		go l.Keep(leaderCtx, cancel)
+
+		err = i.consume(leaderCtx)
+		cancel()
+		if err := l.Release(runCtx, 0); err != nil {
+			logging.Warn(runCtx, "[Ingestor] release lease error: %v", err)
+		}
+		if err != nil && runCtx.Err() == nil {
+			logging.Error(runCtx, "[Ingestor] consume error: %v", err)
+			sleep(runCtx, retryDelay)
+		}
+	}
+}
+
+func (i *Ingestor) consume(ctx context.Context) error {
+
+	i.builders = map[uint64]*builder{}
+	i.closed = nil
+	i.completed = nil
+	i.ackIDs = nil
+	i.late = nil
+	i.lateIDs = nil
+
+	// the messages read before an error were dropped with the builders
+	i.Source.Reset()
+
+	for ctx.Err() == nil {
+		messages, err := i.Source.Read(ctx, readCount, readBlock)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		calendars, err := calendar.GetProductCalendars(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range messages {
+			if err := i.apply(ctx, m, calendars); err != nil {
+				return err
+			}
+		}
+
+		until := time.Now().Add(-grace)
+		for productID, b := range i.builders {
+			models, completed, ids := b.close(until, calendar.Of(calendars, productID))
+			i.closed = append(i.closed, models...)
+			i.completed = append(i.completed, completed...)
+			i.ackIDs = append(i.ackIDs, ids...)
+		}
+
+		if err := i.store(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i *Ingestor) apply(ctx context.Context, m *Message, calendars map[uint64]*calendar.Calendar) error {
+
+	if m.Tick == nil {
+		logging.Warn(ctx, "[Ingestor] drop invalid message %s", m.ID)
+		i.ackIDs = append(i.ackIDs, m.ID)
+		return nil
+	}
+
+	c := calendar.Of(calendars, m.Tick.ProductID)
+	b, err := i.builder(m.Tick.ProductID)
+	if err != nil {
+		return err
+	}
+
+	if b.isLate(m.Tick) {
+		i.addLate(ctx, m)
+		return nil
+	}
+
+	// a tick of a later minute closes the forming one
+	models, completed, ids := b.close(candleStart(m.Tick.At), c)
+	i.closed = append(i.closed, models...)
+	i.completed = append(i.completed, completed...)
+	i.ackIDs = append(i.ackIDs, ids...)
+
+	b.add(m.ID, m.Tick)
+	return i.publishForming(ctx, b, c)
+}
+
+// addLate keeps a tick of a closed minute for correction, if still possible.
+func (i *Ingestor) addLate(ctx context.Context, m *Message) {
+
+	start := candleStart(m.Tick.At)
+	if i.Corrector == nil || !i.Corrector.Within(start, time.Now()) {
+		logging.Warn(ctx, "[Ingestor] drop late tick %s of product %d at %v", m.ID, m.Tick.ProductID, m.Tick.At)
+		i.ackIDs = append(i.ackIDs, m.ID)
+		return
+	}
+
+	i.late = append(i.late, &correction.Tick{
+		ProductID: m.Tick.ProductID,
+		At:        m.Tick.At.UnixMilli(),
+		Price:     m.Tick.Price,
+		Size:      m.Tick.Size,
+	})
+	i.lateIDs = append(i.lateIDs, m.ID)
+}
+
+// builder returns the builder of productID, resuming after its last stored
+// 1MI candle within the catch-up window.
+func (i *Ingestor) builder(productID uint64) (*builder, error) {
+
+	if b, ok := i.builders[productID]; ok {
+		return b, nil
+	}
+
+	b := newBuilder(productID)
+	latest, err := i.Store.Get(&candleDao.QueryModel{
+		ProductID:    productID,
+		IntervalType: dbModels.IntervalType_1MI,
+		OrderBy: []*candleDao.Order{
+			{Column: candleDao.OrderColumn_Start, Direction: candleDao.OrderDirection_DESC},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if latest != nil {
+		b.nextMinute = latest.Start.Add(time.Minute)
+		if earliest := time.Now().Truncate(time.Minute).Add(-i.CatchUpWindow); b.nextMinute.Before(earliest) {
+			b.nextMinute = earliest
+		}
+		lastClose := latest.Close
+		b.lastClose = &lastClose
+	}
+
+	i.builders[productID] = b
+	return b, nil
+}
+
+// publishForming pushes the forming candles of the intervals subscribed to.
+func (i *Ingestor) publishForming(ctx context.Context, b *builder, c *calendar.Calendar) error {
+
+	h := hub.GetHub()
+	models := []*dbModels.CandleModel{}
+
+	for _, intervalType := range dbModels.IntervalTypes {
+		if !h.WantsPartial(intervalType) {
+			continue
+		}
+
+		forming, ok := b.forming(intervalType, c.Anchor)
+		if !ok {
+			if err := i.seed(ctx, b, intervalType, c.Anchor); err != nil {
+				return err
+			}
+			forming, _ = b.forming(intervalType, c.Anchor)
+		}
+		if forming != nil {
+			models = append(models, forming)
+		}
+	}
+
+	if len(models) > 0 {
+		h.Publish(models, false)
+	}
+	return nil
+}
+
+// seed loads the minutes of the forming bucket closed before tracking began,
+// storing the closed candles first so that they are included.
+func (i *Ingestor) seed(ctx context.Context, b *builder, intervalType dbModels.IntervalType, anchor dbModels.Anchor) error {
+
+	if err := i.store(ctx); err != nil {
+		return err
+	}
+
+	now := b.minute.Start
+	partials, err := aggregation.Partials(now, anchor, []dbModels.IntervalType{intervalType}, nil,
+		func(source dbModels.IntervalType, from, to time.Time) ([]dbModels.CandleModel, error) {
+			startTo := to.Add(-time.Second)
+			return i.Store.Gets(&candleDao.QueryModel{
+				ProductID:    b.productID,
+				IntervalType: source,
+				StartFrom:    &from,
+				StartTo:      &startTo,
+			})
+		},
+	)
+	if err != nil {
+		logging.Error(ctx, "[Ingestor] seed %d error: %v", intervalType, err)
+		return err
+	}
+
+	var closed *dbModels.CandleModel
+	if p := partials[intervalType]; len(p) > 0 {
+		closed = &p[0]
+	}
+	b.seed(intervalType, anchor.Truncate(intervalType, now), closed)
+	return nil
+}
+
+// store writes the closed 1MI candles and the completed coarser buckets and
+// corrects the minutes of late ticks, then acks their messages.
+func (i *Ingestor) store(ctx context.Context) error {
+
+	// a leader which lost the lease must not overwrite the candles of the next one
+	if err := lease.CheckFencing(ctx); err != nil {
+		logging.Error(ctx, "[Ingestor] CheckFencing err: %v", err)
+		return err
+	}
+
+	if len(i.closed) > 0 {
+		result, err := i.Store.Upserts(i.closed, candleDao.ConflictMode_Overwrite)
+		if err != nil {
+			logging.Error(ctx, "[Ingestor] upserts error: %v", err)
+			return err
+		}
+		seriesCache.GetCache().Stored(ctx, i.closed, candleDao.ConflictMode_Overwrite, result)
+		hub.GetHub().Publish(i.closed, true)
+		i.closed = nil
+	}
+
+	if len(i.completed) > 0 {
+		result, err := i.Store.Upserts(i.completed, candleDao.ConflictMode_Overwrite)
+		if err != nil {
+			logging.Error(ctx, "[Ingestor] upserts buckets error: %v", err)
+			return err
+		}
+		seriesCache.GetCache().Stored(ctx, i.completed, candleDao.ConflictMode_Overwrite, result)
+		hub.GetHub().Publish(i.completed, true)
+		i.completed = nil
+	}
+
+	if len(i.late) > 0 {
+		models := correction.MinutesOfTicks(i.late)
+		if _, err := i.Corrector.Correct(ctx, i.Store, models, candleDao.ConflictMode_Extend); err != nil {
+			logging.Error(ctx, "[Ingestor] correct error: %v", err)
+			return err
+		}
+		i.ackIDs = append(i.ackIDs, i.lateIDs...)
+		i.late = nil
+		i.lateIDs = nil
+	}
+
+	if len(i.ackIDs) > 0 {
+		if err := i.Source.Ack(ctx, i.ackIDs); err != nil {
+			logging.Error(ctx, "[Ingestor] ack error: %v", err)
+			return err
+		}
+		i.ackIDs = nil
+	}
+	return nil
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
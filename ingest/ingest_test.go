@@ -0,0 +1,219 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-candle/dao/candleDao"
+	"github.com/paper-trade-chatbot/be-candle/hub"
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	"github.com/paper-trade-chatbot/be-candle/seriesCache"
+	"github.com/paper-trade-chatbot/be-candle/service"
+	productService "github.com/paper-trade-chatbot/be-candle/service/product"
+	"github.com/paper-trade-chatbot/be-common/cache"
+	"github.com/paper-trade-chatbot/be-proto/product"
+	"github.com/shopspring/decimal"
+)
+
+// products of no exchange trade all day on UTC days
+type noExchanges struct {
+	productService.ProductIntf
+}
+
+func (noExchanges) GetExchanges(ctx context.Context, in *product.GetExchangesReq) (*product.GetExchangesRes, error) {
+	return &product.GetExchangesRes{}, nil
+}
+
+func (noExchanges) GetProducts(ctx context.Context, in *product.GetProductsReq) (*product.GetProductsRes, error) {
+	return &product.GetProductsRes{}, nil
+}
+
+var errUnavailable = errors.New("store unavailable")
+
+// failingStore fails the first Upserts, like a database going away mid-run.
+type failingStore struct {
+	candleDao.CandleStore
+	failed bool
+}
+
+func (s *failingStore) Upserts(m []*dbModels.CandleModel, mode candleDao.ConflictMode) (*candleDao.UpsertResult, error) {
+	if !s.failed {
+		s.failed = true
+		return nil, errUnavailable
+	}
+	return s.CandleStore.Upserts(m, mode)
+}
+
+func setUp(t *testing.T) {
+	t.Helper()
+	t.Setenv("CANDLE_CACHE_SIZE", "0")
+	t.Setenv("CANDLE_STREAM_BUFFER_SIZE", "1000")
+	t.Setenv("CANDLE_ANCHORS", "")
+
+	_, closeRedis := cache.SetRedisMock()
+	t.Cleanup(closeRedis)
+
+	ctx := context.Background()
+	service.Impl.ProductIntf = noExchanges{}
+	seriesCache.Initialize(ctx)
+	hub.Initialize(ctx)
+	t.Cleanup(hub.Finalize)
+}
+
+func tick(productID uint64, at time.Time, price, size int64) *Tick {
+	return &Tick{ProductID: productID, At: at, Price: decimal.NewFromInt(price), Size: decimal.NewFromInt(size)}
+}
+
+// consumeUntil runs i until done reports true or the deadline, returning the
+// error consume ended with.
+func consumeUntil(t *testing.T, i *Ingestor, done func() bool) error {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() { result <- i.consume(ctx) }()
+
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case err := <-result:
+			cancel()
+			return err
+		case <-deadline:
+			cancel()
+			t.Fatal("consume did not finish")
+		case <-time.After(10 * time.Millisecond):
+		}
+		if done() {
+			cancel()
+			return <-result
+		}
+	}
+}
+
+func stored(t *testing.T, store candleDao.CandleStore, productID uint64, intervalType dbModels.IntervalType, start time.Time) *dbModels.CandleModel {
+	t.Helper()
+	m, err := store.Get(&candleDao.QueryModel{ProductID: productID, IntervalType: intervalType, Start: &start})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func assertCandle(t *testing.T, m *dbModels.CandleModel, open, close, high, low, volume int64) {
+	t.Helper()
+	if m == nil {
+		t.Fatal("candle not stored")
+	}
+	if !m.Open.Equal(decimal.NewFromInt(open)) || !m.Close.Equal(decimal.NewFromInt(close)) || !m.High.Equal(decimal.NewFromInt(high)) ||
+		!m.Low.Equal(decimal.NewFromInt(low)) || !m.Volume.Equal(decimal.NewFromInt(volume)) {
+		t.Fatalf("candle %v: %s %s %s %s %s, want %d %d %d %d %d", m.Start, m.Open, m.Close, m.High, m.Low, m.Volume, open, close, high, low, volume)
+	}
+}
+
+func (s *MemorySource) pending() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.unacked) + len(s.messages)
+}
+
+func TestIngestorStoresClosedCandles(t *testing.T) {
+	setUp(t)
+
+	store := candleDao.NewMemoryStore()
+	source := NewMemorySource(100)
+	i := New(source, time.Hour, nil, store)
+
+	// a bucket of 5 minutes ended well before now
+	bucket := time.Now().UTC().Truncate(5 * time.Minute).Add(-10 * time.Minute)
+	subscription := hub.GetHub().Subscribe(nil, []dbModels.IntervalType{dbModels.IntervalType_5MI}, true)
+	defer hub.GetHub().Unsubscribe(subscription)
+
+	// a candle covers (start, start+1m]
+	source.Push(
+		tick(1, bucket.Add(10*time.Second), 10, 1),
+		tick(1, bucket.Add(40*time.Second), 12, 2),
+		tick(1, bucket.Add(time.Minute), 9, 1),
+		tick(1, bucket.Add(2*time.Minute+30*time.Second), 11, 3),
+	)
+
+	err := consumeUntil(t, i, func() bool {
+		return source.pending() == 0 && stored(t, store, 1, dbModels.IntervalType_5MI, bucket) != nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertCandle(t, stored(t, store, 1, dbModels.IntervalType_1MI, bucket), 10, 9, 12, 9, 4)
+	assertCandle(t, stored(t, store, 1, dbModels.IntervalType_1MI, bucket.Add(time.Minute)), 9, 9, 9, 9, 0) // flat at the last close
+	assertCandle(t, stored(t, store, 1, dbModels.IntervalType_1MI, bucket.Add(2*time.Minute)), 11, 11, 11, 11, 3)
+	assertCandle(t, stored(t, store, 1, dbModels.IntervalType_1MI, bucket.Add(4*time.Minute)), 11, 11, 11, 11, 0)
+	// the 5MI bucket followed from its first minute is stored once complete
+	assertCandle(t, stored(t, store, 1, dbModels.IntervalType_5MI, bucket), 10, 11, 12, 9, 7)
+}
+
+func TestIngestorRedeliversAfterFailure(t *testing.T) {
+	setUp(t)
+
+	store := &failingStore{CandleStore: candleDao.NewMemoryStore()}
+	source := NewMemorySource(100)
+	i := New(source, time.Hour, nil, store)
+
+	minute := time.Now().UTC().Truncate(time.Minute).Add(-5 * time.Minute)
+	source.Push(
+		tick(1, minute.Add(10*time.Second), 10, 1),
+		tick(1, minute.Add(50*time.Second), 14, 1),
+		tick(2, minute.Add(20*time.Second), 100, 5),
+	)
+
+	// the first run reads every tick but cannot store their minute
+	if err := consumeUntil(t, i, func() bool { return false }); !errors.Is(err, errUnavailable) {
+		t.Fatalf("consume = %v, want %v", err, errUnavailable)
+	}
+	if got := source.pending(); got != 3 {
+		t.Fatalf("%d messages pending, want 3", got)
+	}
+
+	// like after a restart, the next run starts over from the messages not acked
+	err := consumeUntil(t, i, func() bool {
+		return source.pending() == 0 && stored(t, store, 2, dbModels.IntervalType_1MI, minute) != nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertCandle(t, stored(t, store, 1, dbModels.IntervalType_1MI, minute), 10, 14, 14, 10, 2)
+	assertCandle(t, stored(t, store, 2, dbModels.IntervalType_1MI, minute), 100, 100, 100, 100, 5)
+}
+
+// TestIngestorReadsPendingOnce restarts with ticks of the forming minute
+// pending: they are applied once, not again on every read until acked.
+func TestIngestorReadsPendingOnce(t *testing.T) {
+	setUp(t)
+	stream := startStream(t)
+
+	store := candleDao.NewMemoryStore()
+	at := time.Now()
+	stream.add(tick(1, at, 10, 1), tick(1, at, 12, 2))
+
+	// the last leader read the ticks, their minute is still forming
+	before := NewRedisStreamSource(testStream, testGroup, consumerName)
+	readIDs(t, before, 10)
+	readIDs(t, before, 10)
+
+	i := New(NewRedisStreamSource(testStream, testGroup, consumerName), time.Hour, nil, store)
+	deadline := time.Now().Add(200 * time.Millisecond)
+	if err := consumeUntil(t, i, func() bool { return time.Now().After(deadline) }); err != nil {
+		t.Fatal(err)
+	}
+
+	b := i.builders[1]
+	if b == nil || b.minute == nil {
+		t.Fatal("forming minute not built")
+	}
+	if !b.minute.Volume.Equal(decimal.NewFromInt(3)) || len(b.ids) != 2 {
+		t.Fatalf("forming minute volume %s of %d messages, want 3 of 2", b.minute.Volume, len(b.ids))
+	}
+}
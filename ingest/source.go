@@ -0,0 +1,280 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/paper-trade-chatbot/be-common/cache"
+	"github.com/shopspring/decimal"
+)
+
+var ErrInvalidTick = errors.New("invalid tick")
+
+// streamClient is the part of the Redis client RedisStreamSource reads with.
+type streamClient interface {
+	XGroupCreateMkStream(ctx context.Context, stream, group, start string) *redis.StatusCmd
+	XReadGroup(ctx context.Context, a *redis.XReadGroupArgs) *redis.XStreamSliceCmd
+	XAck(ctx context.Context, stream, group string, ids ...string) *redis.IntCmd
+}
+
+// getRedis returns the client the stream is read with, replaced in tests
+var getRedis = func() streamClient {
+	r, _ := cache.GetRedis()
+	return r.Client
+}
+
+// Tick is a trade or price update of the quote tick stream.
+type Tick struct {
+	ProductID uint64
+	At        time.Time
+	Price     decimal.Decimal
+	Size      decimal.Decimal
+}
+
+// Message is a delivered tick, Tick is nil if the message could not be parsed.
+type Message struct {
+	ID   string
+	Tick *Tick
+}
+
+// TickSource delivers every tick at least once: a message is delivered again,
+// also after a restart, until it is acked.
+type TickSource interface {
+	// Read returns up to count messages, waiting at most block for the first one.
+	Read(ctx context.Context, count int, block time.Duration) ([]*Message, error)
+	Ack(ctx context.Context, ids []string) error
+	// Reset starts over from the messages delivered but not acked, which the
+	// reader dropped with its in-memory state.
+	Reset()
+}
+
+// RedisStreamSource reads a Redis stream through a consumer group. The
+// messages still pending for Consumer, i.e. read but not acked before a
+// restart, are read again first, page by page, before the new ones.
+//
+// Each stream entry holds the fields productID, at (unix milliseconds), price
+// and optionally size.
+type RedisStreamSource struct {
+	Stream   string
+	Group    string
+	Consumer string
+
+	groupCreated bool
+	pendingRead  bool
+	// lastPending is the id of the last pending message read, the pending
+	// list is read on after it
+	lastPending string
+}
+
+func NewRedisStreamSource(stream, group, consumer string) TickSource {
+	return &RedisStreamSource{
+		Stream:   stream,
+		Group:    group,
+		Consumer: consumer,
+	}
+}
+
+func (s *RedisStreamSource) Read(ctx context.Context, count int, block time.Duration) ([]*Message, error) {
+
+	r := getRedis()
+
+	if !s.groupCreated {
+		err := r.XGroupCreateMkStream(ctx, s.Stream, s.Group, "0").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return nil, err
+		}
+		s.groupCreated = true
+	}
+
+	// an id reads the pending messages of the consumer after it, ">" the new ones
+	id := ">"
+	if !s.pendingRead {
+		id = s.lastPending
+		if id == "" {
+			id = "0"
+		}
+		block = -1
+	}
+
+	streams, err := r.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    s.Group,
+		Consumer: s.Consumer,
+		Streams:  []string{s.Stream, id},
+		Count:    int64(count),
+		Block:    block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return []*Message{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	messages := []*Message{}
+	for _, stream := range streams {
+		for _, m := range stream.Messages {
+			tick, err := parseTick(m.Values)
+			if err != nil {
+				tick = nil
+			}
+			messages = append(messages, &Message{ID: m.ID, Tick: tick})
+		}
+	}
+	if !s.pendingRead {
+		if len(messages) == 0 {
+			s.pendingRead = true
+		} else {
+			s.lastPending = messages[len(messages)-1].ID
+		}
+	}
+
+	return messages, nil
+}
+
+// Reset reads the pending messages of Consumer again before the new ones.
+func (s *RedisStreamSource) Reset() {
+	s.pendingRead = false
+	s.lastPending = ""
+}
+
+func (s *RedisStreamSource) Ack(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return getRedis().XAck(ctx, s.Stream, s.Group, ids...).Err()
+}
+
+func parseTick(values map[string]interface{}) (*Tick, error) {
+
+	field := func(name string) string {
+		v, _ := values[name].(string)
+		return v
+	}
+
+	productID, err := strconv.ParseUint(field("productID"), 10, 64)
+	if err != nil || productID == 0 {
+		return nil, ErrInvalidTick
+	}
+	at, err := strconv.ParseInt(field("at"), 10, 64)
+	if err != nil {
+		return nil, ErrInvalidTick
+	}
+	price, err := decimal.NewFromString(field("price"))
+	if err != nil || !price.IsPositive() {
+		return nil, ErrInvalidTick
+	}
+	size := decimal.Zero
+	if raw := field("size"); raw != "" {
+		if size, err = decimal.NewFromString(raw); err != nil || size.IsNegative() {
+			return nil, ErrInvalidTick
+		}
+	}
+
+	return &Tick{
+		ProductID: productID,
+		At:        time.UnixMilli(at),
+		Price:     price,
+		Size:      size,
+	}, nil
+}
+
+// MemorySource is an in-process TickSource for local runs and tests. Messages
+// not acked are delivered again after Redeliver, like after a restart.
+type MemorySource struct {
+	lock     sync.Mutex
+	messages chan *Message
+	unacked  map[string]*Message
+	order    []string
+	nextID   int64
+}
+
+func NewMemorySource(bufferSize int) *MemorySource {
+	return &MemorySource{
+		messages: make(chan *Message, bufferSize),
+		unacked:  map[string]*Message{},
+	}
+}
+
+// Push queues ticks, blocking while the buffer is full.
+func (s *MemorySource) Push(ticks ...*Tick) {
+	for _, t := range ticks {
+		s.lock.Lock()
+		s.nextID++
+		m := &Message{ID: strconv.FormatInt(s.nextID, 10), Tick: t}
+		s.lock.Unlock()
+		s.messages <- m
+	}
+}
+
+func (s *MemorySource) Read(ctx context.Context, count int, block time.Duration) ([]*Message, error) {
+
+	messages := []*Message{}
+	timer := time.NewTimer(block)
+	defer timer.Stop()
+
+	for len(messages) < count {
+		var m *Message
+		if len(messages) == 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-timer.C:
+				return messages, nil
+			case m = <-s.messages:
+			}
+		} else {
+			select {
+			case m = <-s.messages:
+			default:
+				return messages, nil
+			}
+		}
+
+		s.lock.Lock()
+		if _, ok := s.unacked[m.ID]; !ok {
+			s.order = append(s.order, m.ID)
+		}
+		s.unacked[m.ID] = m
+		s.lock.Unlock()
+		messages = append(messages, m)
+	}
+	return messages, nil
+}
+
+func (s *MemorySource) Ack(ctx context.Context, ids []string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, id := range ids {
+		delete(s.unacked, id)
+	}
+	return nil
+}
+
+// Reset delivers the messages not acked yet again, see Redeliver.
+func (s *MemorySource) Reset() {
+	s.Redeliver()
+}
+
+// Redeliver queues every message not acked yet again, in delivery order.
+func (s *MemorySource) Redeliver() {
+	s.lock.Lock()
+	pending := []*Message{}
+	order := []string{}
+	for _, id := range s.order {
+		if m, ok := s.unacked[id]; ok {
+			pending = append(pending, m)
+			order = append(order, id)
+		}
+	}
+	s.order = order
+	s.lock.Unlock()
+
+	for _, m := range pending {
+		s.messages <- m
+	}
+}
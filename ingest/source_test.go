@@ -0,0 +1,185 @@
+package ingest
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	testStream = "ticks"
+	testGroup  = "be-candle"
+)
+
+// fakeStream is a stream with one consumer group following XREADGROUP: ">"
+// delivers the new entries and keeps them pending until acked, an id delivers
+// again the pending entries after it, both at most Count at a time.
+type fakeStream struct {
+	lock      sync.Mutex
+	entries   []redis.XMessage
+	delivered int      // entries delivered to the group
+	pending   []string // in id order
+	nextID    int64
+}
+
+var _ streamClient = (*fakeStream)(nil)
+
+// startStream reads RedisStreamSource from a new fakeStream.
+func startStream(t *testing.T) *fakeStream {
+	t.Helper()
+	s := &fakeStream{}
+	getRedis = func() streamClient { return s }
+	return s
+}
+
+func streamSeq(id string) int64 {
+	seq, _ := strconv.ParseInt(strings.SplitN(id, "-", 2)[0], 10, 64)
+	return seq
+}
+
+func (s *fakeStream) add(ticks ...*Tick) []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ids := []string{}
+	for _, tick := range ticks {
+		s.nextID++
+		id := strconv.FormatInt(s.nextID, 10) + "-0"
+		s.entries = append(s.entries, redis.XMessage{
+			ID: id,
+			Values: map[string]interface{}{
+				"productID": strconv.FormatUint(tick.ProductID, 10),
+				"at":        strconv.FormatInt(tick.At.UnixMilli(), 10),
+				"price":     tick.Price.String(),
+				"size":      tick.Size.String(),
+			},
+		})
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (s *fakeStream) XGroupCreateMkStream(ctx context.Context, stream, group, start string) *redis.StatusCmd {
+	return redis.NewStatusResult("OK", nil)
+}
+
+func (s *fakeStream) XReadGroup(ctx context.Context, a *redis.XReadGroupArgs) *redis.XStreamSliceCmd {
+
+	s.lock.Lock()
+	messages := []redis.XMessage{}
+	if id := a.Streams[1]; id != ">" {
+		after := streamSeq(id)
+		for _, p := range s.pending {
+			if streamSeq(p) > after && (a.Count <= 0 || int64(len(messages)) < a.Count) {
+				messages = append(messages, s.entries[streamSeq(p)-1])
+			}
+		}
+		s.lock.Unlock()
+		return redis.NewXStreamSliceCmdResult([]redis.XStream{{Stream: a.Streams[0], Messages: messages}}, nil)
+	}
+
+	for s.delivered < len(s.entries) && (a.Count <= 0 || int64(len(messages)) < a.Count) {
+		m := s.entries[s.delivered]
+		messages = append(messages, m)
+		s.pending = append(s.pending, m.ID)
+		s.delivered++
+	}
+	s.lock.Unlock()
+
+	if len(messages) > 0 {
+		return redis.NewXStreamSliceCmdResult([]redis.XStream{{Stream: a.Streams[0], Messages: messages}}, nil)
+	}
+	if a.Block > 0 {
+		select {
+		case <-ctx.Done():
+			return redis.NewXStreamSliceCmdResult(nil, ctx.Err())
+		case <-time.After(a.Block):
+		}
+	}
+	return redis.NewXStreamSliceCmdResult(nil, redis.Nil)
+}
+
+func (s *fakeStream) XAck(ctx context.Context, stream, group string, ids ...string) *redis.IntCmd {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	acked := map[string]bool{}
+	for _, id := range ids {
+		acked[id] = true
+	}
+	pending := []string{}
+	for _, p := range s.pending {
+		if !acked[p] {
+			pending = append(pending, p)
+		}
+	}
+	n := len(s.pending) - len(pending)
+	s.pending = pending
+	return redis.NewIntResult(int64(n), nil)
+}
+
+func readIDs(t *testing.T, source TickSource, count int) []string {
+	t.Helper()
+	messages, err := source.Read(context.Background(), count, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, m := range messages {
+		if m.Tick == nil {
+			t.Fatalf("message %s not parsed", m.ID)
+		}
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
+
+func assertIDs(t *testing.T, got, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("read %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("read %v, want %v", got, want)
+		}
+	}
+}
+
+// TestRedisStreamSourcePending leaves more messages pending than a read
+// returns: the next consumer pages through them once, then reads new ones.
+func TestRedisStreamSourcePending(t *testing.T) {
+	stream := startStream(t)
+
+	at := time.Now()
+	ids := stream.add(tick(1, at, 10, 1), tick(1, at, 11, 1), tick(1, at, 12, 1), tick(1, at, 13, 1), tick(1, at, 14, 1))
+
+	// the last leader read everything and acked nothing
+	before := NewRedisStreamSource(testStream, testGroup, consumerName)
+	assertIDs(t, readIDs(t, before, 10), []string{})
+	assertIDs(t, readIDs(t, before, 10), ids)
+
+	source := NewRedisStreamSource(testStream, testGroup, consumerName)
+	assertIDs(t, readIDs(t, source, 2), ids[:2])
+	assertIDs(t, readIDs(t, source, 2), ids[2:4])
+	assertIDs(t, readIDs(t, source, 2), ids[4:])
+	// the pending list is through
+	assertIDs(t, readIDs(t, source, 2), []string{})
+	assertIDs(t, readIDs(t, source, 2), []string{})
+
+	added := stream.add(tick(1, at, 15, 1))
+	assertIDs(t, readIDs(t, source, 2), added)
+
+	// after a reset the messages not acked are read again
+	if err := source.Ack(context.Background(), ids[:3]); err != nil {
+		t.Fatal(err)
+	}
+	source.Reset()
+	assertIDs(t, readIDs(t, source, 10), append(ids[3:], added...))
+	assertIDs(t, readIDs(t, source, 10), []string{})
+}
@@ -5,9 +5,20 @@ import (
 	"fmt"
 	"runtime/debug"
 
+	"github.com/paper-trade-chatbot/be-candle/api"
+	"github.com/paper-trade-chatbot/be-candle/correction"
 	"github.com/paper-trade-chatbot/be-candle/cronjob"
+	"github.com/paper-trade-chatbot/be-candle/dao/candleDao"
+	"github.com/paper-trade-chatbot/be-candle/hub"
+	"github.com/paper-trade-chatbot/be-candle/ingest"
+	"github.com/paper-trade-chatbot/be-candle/retention"
+	"github.com/paper-trade-chatbot/be-candle/seriesCache"
 	"github.com/paper-trade-chatbot/be-candle/service"
+	"github.com/paper-trade-chatbot/be-candle/service/backfill"
 	"github.com/paper-trade-chatbot/be-candle/service/candle"
+	"github.com/paper-trade-chatbot/be-candle/service/indicator"
+	"github.com/paper-trade-chatbot/be-candle/service/readiness"
+	"github.com/paper-trade-chatbot/be-candle/service/volume"
 	"github.com/paper-trade-chatbot/be-common/cache"
 	"github.com/paper-trade-chatbot/be-common/database"
 	candleGrpc "github.com/paper-trade-chatbot/be-proto/candle"
@@ -41,9 +52,30 @@ func main() {
 	database.Initialize(ctx)
 	defer database.Finalize()
 
+	// candles are read and written through the store
+	store := candleDao.NewGormStore(database.GetDB())
+
 	service.Initialize(ctx)
 	defer service.Finalize(ctx)
 
+	hub.Initialize(ctx)
+	defer hub.Finalize()
+
+	volume.Initialize(ctx)
+
+	seriesCache.Initialize(ctx)
+
+	readiness.Initialize(ctx)
+
+	correction.Initialize(ctx)
+
+	retention.Initialize(ctx, store)
+
+	ingest.Initialize(ctx, store)
+	defer ingest.Finalize()
+
+	cronjob.Initialize(ctx, store)
+
 	initConfig()
 
 	grpcAddress := fmt.Sprintf("%s:%s",
@@ -67,8 +99,15 @@ func main() {
 	)
 	reflection.Register(grpc)
 
-	candleInstance := candle.New()
+	candleInstance := candle.New(store)
 	candleGrpc.RegisterCandleServiceServer(grpc, candleInstance)
+	candle.RegisterCandleStreamServiceServer(grpc, candleInstance)
+	candle.RegisterCandleAdminServiceServer(grpc, candleInstance)
+
+	backfillInstance := backfill.New(store)
+	indicatorInstance := indicator.New(store)
+	indicator.RegisterCandleIndicatorServiceServer(grpc, indicatorInstance)
+	api.Initialize(ctx, candleInstance, backfillInstance, indicatorInstance, volume.GetVolume(), seriesCache.GetCache(), cronjob.GetRegistry(), correction.GetCorrector(), store, retention.GetRetainer())
 
 	address := fmt.Sprintf("%s:%s",
 		config.GetString("SERVER_LISTEN_ADDRESS"),
@@ -0,0 +1,82 @@
+package dbModels
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type AuditAction string
+
+const (
+	AuditAction_Modify    AuditAction = "modify"
+	AuditAction_Delete    AuditAction = "delete"
+	AuditAction_Recompute AuditAction = "recompute" // an aggregated candle following a modify or delete
+)
+
+// CandleAuditModel records a change of a stored candle, the old values are
+// null for a candle created and the new ones for a candle deleted.
+type CandleAuditModel struct {
+	ID           uint64              `gorm:"column:id;primaryKey"`
+	ProductID    uint64              `gorm:"column:product_id"`
+	IntervalType IntervalType        `gorm:"column:interval_type"`
+	Start        time.Time           `gorm:"column:start"`
+	Action       AuditAction         `gorm:"column:action"`
+	OldOpen      decimal.NullDecimal `gorm:"column:old_open"`
+	OldClose     decimal.NullDecimal `gorm:"column:old_close"`
+	OldHigh      decimal.NullDecimal `gorm:"column:old_high"`
+	OldLow       decimal.NullDecimal `gorm:"column:old_low"`
+	OldVolume    decimal.NullDecimal `gorm:"column:old_volume"`
+	OldRevision  *uint32             `gorm:"column:old_revision"`
+	NewOpen      decimal.NullDecimal `gorm:"column:new_open"`
+	NewClose     decimal.NullDecimal `gorm:"column:new_close"`
+	NewHigh      decimal.NullDecimal `gorm:"column:new_high"`
+	NewLow       decimal.NullDecimal `gorm:"column:new_low"`
+	NewVolume    decimal.NullDecimal `gorm:"column:new_volume"`
+	NewRevision  *uint32             `gorm:"column:new_revision"`
+	RequestID    string              `gorm:"column:request_id"`
+	Account      string              `gorm:"column:account"`
+	CreatedAt    time.Time           `gorm:"column:created_at;autoCreateTime"`
+}
+
+// NewCandleAuditModel records old becoming new, either may be nil.
+func NewCandleAuditModel(action AuditAction, old, new *CandleModel, requestID, account string) *CandleAuditModel {
+
+	m := &CandleAuditModel{
+		Action:    action,
+		RequestID: requestID,
+		Account:   account,
+	}
+
+	key := old
+	if key == nil {
+		key = new
+	}
+	m.ProductID = key.ProductID
+	m.IntervalType = key.IntervalType
+	m.Start = key.Start
+
+	if old != nil {
+		revision := old.Revision
+		m.OldOpen = nullDecimal(old.Open)
+		m.OldClose = nullDecimal(old.Close)
+		m.OldHigh = nullDecimal(old.High)
+		m.OldLow = nullDecimal(old.Low)
+		m.OldVolume = nullDecimal(old.Volume)
+		m.OldRevision = &revision
+	}
+	if new != nil {
+		revision := new.Revision
+		m.NewOpen = nullDecimal(new.Open)
+		m.NewClose = nullDecimal(new.Close)
+		m.NewHigh = nullDecimal(new.High)
+		m.NewLow = nullDecimal(new.Low)
+		m.NewVolume = nullDecimal(new.Volume)
+		m.NewRevision = &revision
+	}
+	return m
+}
+
+func nullDecimal(d decimal.Decimal) decimal.NullDecimal {
+	return decimal.NullDecimal{Decimal: d, Valid: true}
+}
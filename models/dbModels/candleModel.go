@@ -33,4 +33,5 @@ type CandleModel struct {
 	High         decimal.Decimal `gorm:"column:high"`
 	Low          decimal.Decimal `gorm:"column:low"`
 	Volume       decimal.Decimal `gorm:"column:volume"`
+	Revision     uint32          `gorm:"column:revision"` // times the stored candle was corrected
 }
@@ -0,0 +1,226 @@
+package dbModels
+
+import (
+	"time"
+)
+
+// IntervalTypes lists every supported interval from the finest to the coarsest.
+var IntervalTypes = []IntervalType{
+	IntervalType_1MI,
+	IntervalType_2MI,
+	IntervalType_5MI,
+	IntervalType_10MI,
+	IntervalType_15MI,
+	IntervalType_30MI,
+	IntervalType_1HR,
+	IntervalType_1DY,
+	IntervalType_5DY,
+	IntervalType_1WK,
+	IntervalType_1MO,
+	IntervalType_1YR,
+}
+
+// intervalSource is the finer interval each interval is rolled up from.
+var intervalSource = map[IntervalType]IntervalType{
+	IntervalType_2MI:  IntervalType_1MI,
+	IntervalType_5MI:  IntervalType_1MI,
+	IntervalType_10MI: IntervalType_5MI,
+	IntervalType_15MI: IntervalType_5MI,
+	IntervalType_30MI: IntervalType_15MI,
+	IntervalType_1HR:  IntervalType_30MI,
+	IntervalType_1DY:  IntervalType_15MI, // local midnight is a multiple of 15 minutes in every timezone
+	IntervalType_5DY:  IntervalType_1DY,
+	IntervalType_1WK:  IntervalType_1DY,
+	IntervalType_1MO:  IntervalType_1DY,
+	IntervalType_1YR:  IntervalType_1MO,
+}
+
+var intervalNames = map[IntervalType]string{
+	IntervalType_1MI:  "1MI",
+	IntervalType_2MI:  "2MI",
+	IntervalType_5MI:  "5MI",
+	IntervalType_10MI: "10MI",
+	IntervalType_15MI: "15MI",
+	IntervalType_30MI: "30MI",
+	IntervalType_1HR:  "1HR",
+	IntervalType_1DY:  "1DY",
+	IntervalType_5DY:  "5DY",
+	IntervalType_1WK:  "1WK",
+	IntervalType_1MO:  "1MO",
+	IntervalType_1YR:  "1YR",
+}
+
+var intervalDuration = map[IntervalType]time.Duration{
+	IntervalType_1MI:  time.Minute,
+	IntervalType_2MI:  time.Minute * 2,
+	IntervalType_5MI:  time.Minute * 5,
+	IntervalType_10MI: time.Minute * 10,
+	IntervalType_15MI: time.Minute * 15,
+	IntervalType_30MI: time.Minute * 30,
+	IntervalType_1HR:  time.Hour,
+}
+
+// Valid reports whether t is one of the declared interval types.
+func (t IntervalType) Valid() bool {
+	for _, i := range IntervalTypes {
+		if i == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Source returns the interval that t is aggregated from, IntervalType_None for 1MI.
+func (t IntervalType) Source() IntervalType {
+	return intervalSource[t]
+}
+
+// Name returns the short name of t, e.g. 1MI, empty if t is not valid.
+func (t IntervalType) Name() string {
+	return intervalNames[t]
+}
+
+// IntervalTypeByName returns the interval named name, e.g. 5MI.
+func IntervalTypeByName(name string) (IntervalType, bool) {
+	for t, n := range intervalNames {
+		if n == name {
+			return t, true
+		}
+	}
+	return IntervalType_None, false
+}
+
+// BuiltFrom reports whether t is aggregated from other, directly or through
+// the sources in between.
+func (t IntervalType) BuiltFrom(other IntervalType) bool {
+	for source := t.Source(); source != IntervalType_None; source = source.Source() {
+		if source == other {
+			return true
+		}
+	}
+	return false
+}
+
+// Duration returns the fixed length of intraday intervals, 0 for calendar intervals.
+func (t IntervalType) Duration() time.Duration {
+	return intervalDuration[t]
+}
+
+// Truncate returns the start of the bucket containing tm.
+// Intraday buckets are aligned to the unix epoch, calendar buckets to midnight
+// in tm's location: 5DY counts 5-day blocks from 1970-01-01, 1WK starts on Monday.
+func (t IntervalType) Truncate(tm time.Time) time.Time {
+	if d := t.Duration(); d > 0 {
+		return tm.Truncate(d)
+	}
+
+	year, month, day := tm.Date()
+	midnight := time.Date(year, month, day, 0, 0, 0, 0, tm.Location())
+
+	switch t {
+	case IntervalType_1DY:
+		return midnight
+	case IntervalType_5DY:
+		epoch := time.Date(1970, 1, 1, 0, 0, 0, 0, tm.Location())
+		days := daysBetween(epoch, midnight)
+		return midnight.AddDate(0, 0, -(days % 5))
+	case IntervalType_1WK:
+		offset := (int(midnight.Weekday()) + 6) % 7 // Monday = 0
+		return midnight.AddDate(0, 0, -offset)
+	case IntervalType_1MO:
+		return time.Date(year, month, 1, 0, 0, 0, 0, tm.Location())
+	case IntervalType_1YR:
+		return time.Date(year, 1, 1, 0, 0, 0, 0, tm.Location())
+	}
+	return tm
+}
+
+// Next returns the start of the bucket following the one starting at start.
+func (t IntervalType) Next(start time.Time) time.Time {
+	if d := t.Duration(); d > 0 {
+		return start.Add(d)
+	}
+
+	switch t {
+	case IntervalType_1DY:
+		return start.AddDate(0, 0, 1)
+	case IntervalType_5DY:
+		return start.AddDate(0, 0, 5)
+	case IntervalType_1WK:
+		return start.AddDate(0, 0, 7)
+	case IntervalType_1MO:
+		return start.AddDate(0, 1, 0)
+	case IntervalType_1YR:
+		return start.AddDate(1, 0, 0)
+	}
+	return start
+}
+
+// Previous returns the start of the bucket right before the one containing tm.
+func (t IntervalType) Previous(tm time.Time) time.Time {
+	return t.Truncate(t.Truncate(tm).Add(-time.Nanosecond))
+}
+
+func daysBetween(from, to time.Time) int {
+	// calendar dates avoid the 23/25 hour days around daylight saving changes
+	fy, fm, fd := from.Date()
+	ty, tm, td := to.Date()
+	f := time.Date(fy, fm, fd, 0, 0, 0, 0, time.UTC)
+	t := time.Date(ty, tm, td, 0, 0, 0, 0, time.UTC)
+	return int(t.Sub(f).Hours() / 24)
+}
+
+// Anchor aligns day and longer buckets: they start Offset past local midnight
+// in Location. Offset is negative for sessions opening the evening before.
+type Anchor struct {
+	Location *time.Location
+	Offset   time.Duration
+}
+
+var UTCAnchor = Anchor{Location: time.UTC}
+
+// Truncate returns the start of the bucket of t containing tm. Intraday
+// buckets ignore the anchor.
+func (a Anchor) Truncate(t IntervalType, tm time.Time) time.Time {
+	if t.Duration() > 0 {
+		return t.Truncate(tm)
+	}
+	shifted := shiftWallClock(tm.In(a.Location), -a.Offset)
+	return shiftWallClock(t.Truncate(shifted), a.Offset)
+}
+
+// Next returns the start of the bucket following the one starting at start.
+// Calendar buckets are counted from the session's own date, e.g. the month
+// opening on the evening of October 31st is followed by the one opening on
+// November 30th.
+func (a Anchor) Next(t IntervalType, start time.Time) time.Time {
+	if t.Duration() > 0 {
+		return t.Next(start)
+	}
+	shifted := shiftWallClock(start.In(a.Location), -a.Offset)
+	return shiftWallClock(t.Next(shifted), a.Offset)
+}
+
+// Previous returns the start of the bucket right before the one containing tm.
+func (a Anchor) Previous(t IntervalType, tm time.Time) time.Time {
+	return a.Truncate(t, a.Truncate(t, tm).Add(-time.Nanosecond))
+}
+
+// String formats the anchor as Location+HH:MM, e.g. Asia/Taipei+00:00.
+func (a Anchor) String() string {
+	sign := "+"
+	offset := a.Offset
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+	return a.Location.String() + sign + time.Time{}.Add(offset).Format("15:04")
+}
+
+// shiftWallClock moves tm by d on the wall clock, so a shift keeps its time of
+// day across daylight saving changes.
+func shiftWallClock(tm time.Time, d time.Duration) time.Time {
+	year, month, day := tm.Date()
+	hour, min, sec := tm.Clock()
+	return time.Date(year, month, day, hour, min, sec+int(d/time.Second), tm.Nanosecond(), tm.Location())
+}
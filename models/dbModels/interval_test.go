@@ -0,0 +1,159 @@
+package dbModels
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func utc(value string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04:05", value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func local(value string, loc *time.Location) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", value, loc)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func loadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("LoadLocation %s: %v", name, err)
+	}
+	return loc
+}
+
+func TestIntervalTypeBoundaries(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval IntervalType
+		tm       string
+		start    string
+		next     string
+		previous string
+	}{
+		{"2MI", IntervalType_2MI, "2026-10-18 10:03:59", "2026-10-18 10:02:00", "2026-10-18 10:04:00", "2026-10-18 10:00:00"},
+		{"2MI on the boundary", IntervalType_2MI, "2026-10-18 10:04:00", "2026-10-18 10:04:00", "2026-10-18 10:06:00", "2026-10-18 10:02:00"},
+		{"5MI", IntervalType_5MI, "2026-10-18 10:09:59", "2026-10-18 10:05:00", "2026-10-18 10:10:00", "2026-10-18 10:00:00"},
+		{"10MI", IntervalType_10MI, "2026-10-18 10:19:00", "2026-10-18 10:10:00", "2026-10-18 10:20:00", "2026-10-18 10:00:00"},
+		{"15MI", IntervalType_15MI, "2026-10-18 10:44:59", "2026-10-18 10:30:00", "2026-10-18 10:45:00", "2026-10-18 10:15:00"},
+		{"30MI", IntervalType_30MI, "2026-10-18 10:29:59", "2026-10-18 10:00:00", "2026-10-18 10:30:00", "2026-10-18 09:30:00"},
+		{"1HR", IntervalType_1HR, "2026-10-18 10:59:59", "2026-10-18 10:00:00", "2026-10-18 11:00:00", "2026-10-18 09:00:00"},
+		{"1HR across month and year", IntervalType_1HR, "2026-12-31 23:30:00", "2026-12-31 23:00:00", "2027-01-01 00:00:00", "2026-12-31 22:00:00"},
+		{"15MI after midnight", IntervalType_15MI, "2027-01-01 00:05:00", "2027-01-01 00:00:00", "2027-01-01 00:15:00", "2026-12-31 23:45:00"},
+		{"1DY", IntervalType_1DY, "2026-10-18 23:59:59", "2026-10-18 00:00:00", "2026-10-19 00:00:00", "2026-10-17 00:00:00"},
+		{"1DY across month", IntervalType_1DY, "2026-10-31 12:00:00", "2026-10-31 00:00:00", "2026-11-01 00:00:00", "2026-10-30 00:00:00"},
+		{"1DY across year", IntervalType_1DY, "2027-01-01 00:00:00", "2027-01-01 00:00:00", "2027-01-02 00:00:00", "2026-12-31 00:00:00"},
+		{"5DY", IntervalType_5DY, "2026-10-18 08:00:00", "2026-10-14 00:00:00", "2026-10-19 00:00:00", "2026-10-09 00:00:00"},
+		{"5DY across year", IntervalType_5DY, "2026-12-31 08:00:00", "2026-12-28 00:00:00", "2027-01-02 00:00:00", "2026-12-23 00:00:00"},
+		{"1WK on Sunday", IntervalType_1WK, "2026-10-18 23:00:00", "2026-10-12 00:00:00", "2026-10-19 00:00:00", "2026-10-05 00:00:00"},
+		{"1WK on Monday", IntervalType_1WK, "2026-10-19 00:00:00", "2026-10-19 00:00:00", "2026-10-26 00:00:00", "2026-10-12 00:00:00"},
+		{"1WK across year", IntervalType_1WK, "2026-12-31 08:00:00", "2026-12-28 00:00:00", "2027-01-04 00:00:00", "2026-12-21 00:00:00"},
+		{"1MO", IntervalType_1MO, "2026-10-18 08:00:00", "2026-10-01 00:00:00", "2026-11-01 00:00:00", "2026-09-01 00:00:00"},
+		{"1MO across year", IntervalType_1MO, "2026-12-31 23:59:59", "2026-12-01 00:00:00", "2027-01-01 00:00:00", "2026-11-01 00:00:00"},
+		{"1MO in January", IntervalType_1MO, "2027-01-15 00:00:00", "2027-01-01 00:00:00", "2027-02-01 00:00:00", "2026-12-01 00:00:00"},
+		{"1MO after a short month", IntervalType_1MO, "2027-02-28 12:00:00", "2027-02-01 00:00:00", "2027-03-01 00:00:00", "2027-01-01 00:00:00"},
+		{"1YR", IntervalType_1YR, "2026-12-31 23:59:59", "2026-01-01 00:00:00", "2027-01-01 00:00:00", "2025-01-01 00:00:00"},
+		{"1YR on the boundary", IntervalType_1YR, "2027-01-01 00:00:00", "2027-01-01 00:00:00", "2028-01-01 00:00:00", "2026-01-01 00:00:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := tt.interval.Truncate(utc(tt.tm))
+			if !start.Equal(utc(tt.start)) {
+				t.Errorf("Truncate = %v, want %s", start, tt.start)
+			}
+			if next := tt.interval.Next(start); !next.Equal(utc(tt.next)) {
+				t.Errorf("Next = %v, want %s", next, tt.next)
+			}
+			if previous := tt.interval.Previous(utc(tt.tm)); !previous.Equal(utc(tt.previous)) {
+				t.Errorf("Previous = %v, want %s", previous, tt.previous)
+			}
+		})
+	}
+}
+
+// every bucket of an interval is covered by whole buckets of its source
+func TestIntervalTypeSourceAlignment(t *testing.T) {
+	for _, interval := range IntervalTypes {
+		source := interval.Source()
+		if source == IntervalType_None {
+			continue
+		}
+		t.Run(interval.Name(), func(t *testing.T) {
+			start := interval.Truncate(utc("2026-12-31 23:59:00"))
+			for i := 0; i < 3; i++ {
+				next := interval.Next(start)
+				if !source.Truncate(start).Equal(start) || !source.Truncate(next).Equal(next) {
+					t.Fatalf("%v ~ %v is not aligned to %s", start, next, source.Name())
+				}
+				start = next
+			}
+		})
+	}
+}
+
+func TestAnchorTruncate(t *testing.T) {
+	taipei := loadLocation(t, "Asia/Taipei")
+	newYork := loadLocation(t, "America/New_York")
+	chicago := loadLocation(t, "America/Chicago")
+	kolkata := loadLocation(t, "Asia/Kolkata")
+
+	tests := []struct {
+		name     string
+		anchor   Anchor
+		interval IntervalType
+		tm       time.Time
+		start    time.Time
+		next     time.Time
+	}{
+		{"UTC", UTCAnchor, IntervalType_1DY, utc("2026-10-18 15:30:00"), utc("2026-10-18 00:00:00"), utc("2026-10-19 00:00:00")},
+		{"Taipei day", Anchor{Location: taipei}, IntervalType_1DY,
+			utc("2026-10-18 15:30:00"), local("2026-10-18 00:00:00", taipei), local("2026-10-19 00:00:00", taipei)},
+		{"Taipei day after local midnight", Anchor{Location: taipei}, IntervalType_1DY,
+			utc("2026-10-18 16:00:00"), local("2026-10-19 00:00:00", taipei), local("2026-10-20 00:00:00", taipei)},
+		{"Taipei month rollover", Anchor{Location: taipei}, IntervalType_1MO,
+			utc("2026-10-31 16:30:00"), local("2026-11-01 00:00:00", taipei), local("2026-12-01 00:00:00", taipei)},
+		{"Taipei year rollover", Anchor{Location: taipei}, IntervalType_1YR,
+			utc("2026-12-31 16:00:00"), local("2027-01-01 00:00:00", taipei), local("2028-01-01 00:00:00", taipei)},
+		{"Taipei week starts on local Monday", Anchor{Location: taipei}, IntervalType_1WK,
+			utc("2026-10-18 16:30:00"), local("2026-10-19 00:00:00", taipei), local("2026-10-26 00:00:00", taipei)},
+		{"New York day after daylight saving ends", Anchor{Location: newYork}, IntervalType_1DY,
+			utc("2026-11-02 15:00:00"), local("2026-11-02 00:00:00", newYork), local("2026-11-03 00:00:00", newYork)},
+		{"New York week across daylight saving", Anchor{Location: newYork}, IntervalType_1WK,
+			utc("2026-11-04 15:00:00"), local("2026-11-02 00:00:00", newYork), local("2026-11-09 00:00:00", newYork)},
+		{"New York 5DY", Anchor{Location: newYork}, IntervalType_5DY,
+			utc("2026-10-18 12:00:00"), local("2026-10-14 00:00:00", newYork), local("2026-10-19 00:00:00", newYork)},
+		{"Chicago session opening the evening before", Anchor{Location: chicago, Offset: -7 * time.Hour}, IntervalType_1DY,
+			utc("2026-10-18 23:30:00"), local("2026-10-18 17:00:00", chicago), local("2026-10-19 17:00:00", chicago)},
+		{"Chicago session before the evening open", Anchor{Location: chicago, Offset: -7 * time.Hour}, IntervalType_1DY,
+			utc("2026-10-18 21:30:00"), local("2026-10-17 17:00:00", chicago), local("2026-10-18 17:00:00", chicago)},
+		{"Chicago month opening the evening before", Anchor{Location: chicago, Offset: -7 * time.Hour}, IntervalType_1MO,
+			utc("2026-10-31 23:00:00"), local("2026-10-31 17:00:00", chicago), local("2026-11-30 17:00:00", chicago)},
+		{"intraday ignores the anchor", Anchor{Location: kolkata, Offset: time.Hour}, IntervalType_1HR,
+			utc("2026-10-18 10:45:00"), utc("2026-10-18 10:00:00"), utc("2026-10-18 11:00:00")},
+		{"half hour zone day", Anchor{Location: kolkata}, IntervalType_1DY,
+			utc("2026-10-18 18:29:00"), local("2026-10-18 00:00:00", kolkata), local("2026-10-19 00:00:00", kolkata)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := tt.anchor.Truncate(tt.interval, tt.tm)
+			if !start.Equal(tt.start) {
+				t.Errorf("Truncate = %v, want %v", start, tt.start)
+			}
+			if next := tt.anchor.Next(tt.interval, start); !next.Equal(tt.next) {
+				t.Errorf("Next = %v, want %v", next, tt.next)
+			}
+			if previous := tt.anchor.Previous(tt.interval, tt.next); !previous.Equal(tt.start) {
+				t.Errorf("Previous of next = %v, want %v", previous, tt.start)
+			}
+		})
+	}
+}
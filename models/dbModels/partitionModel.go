@@ -0,0 +1,29 @@
+package dbModels
+
+import (
+	"strconv"
+	"time"
+)
+
+// PartitionModel is a range partition of a table partitioned by start, from
+// information_schema.PARTITIONS. The partition holds the rows starting before
+// Before and at or after the Before of the previous partition.
+type PartitionModel struct {
+	Name        string `gorm:"column:PARTITION_NAME"`
+	Description string `gorm:"column:PARTITION_DESCRIPTION"` // unix seconds or MAXVALUE
+	Rows        int64  `gorm:"column:TABLE_ROWS"`            // estimated
+}
+
+// Before returns the exclusive upper bound of the partition, false for MAXVALUE.
+func (p *PartitionModel) Before() (time.Time, bool) {
+	before, err := strconv.ParseInt(p.Description, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(before, 0), true
+}
+
+// PartitionName returns the name of the partition holding the month starting at month, e.g. p202611.
+func PartitionName(month time.Time) string {
+	return "p" + month.UTC().Format("200601")
+}
@@ -0,0 +1,43 @@
+package dbModels
+
+import (
+	"github.com/shopspring/decimal"
+)
+
+// PrecisionModel is the number of digits a product's prices and volumes may
+// have, like DECIMAL(precision, scale).
+type PrecisionModel struct {
+	ProductID       uint64 `gorm:"column:product_id"`
+	PricePrecision  int32  `gorm:"column:price_precision"`
+	PriceScale      int32  `gorm:"column:price_scale"`
+	VolumePrecision int32  `gorm:"column:volume_precision"`
+	VolumeScale     int32  `gorm:"column:volume_scale"`
+}
+
+// the candle columns are DECIMAL(36,18)
+const (
+	ColumnPrecision int32 = 36
+	ColumnScale     int32 = 18
+)
+
+// DefaultPrecision is what the candle columns hold, for products without a row.
+func DefaultPrecision(productID uint64) *PrecisionModel {
+	return &PrecisionModel{
+		ProductID:       productID,
+		PricePrecision:  ColumnPrecision,
+		PriceScale:      ColumnScale,
+		VolumePrecision: ColumnPrecision,
+		VolumeScale:     ColumnScale,
+	}
+}
+
+// Fits reports whether d is stored exactly with precision digits, scale of
+// them after the point.
+func Fits(d decimal.Decimal, precision, scale int32) bool {
+	if !d.Round(scale).Equal(d) {
+		return false
+	}
+	// digits before the point
+	integer := d.Abs().Truncate(0)
+	return integer.LessThan(decimal.New(1, precision-scale))
+}
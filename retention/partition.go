@@ -0,0 +1,151 @@
+package retention
+
+import (
+	"context"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-candle/dao/candleDao"
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	"github.com/paper-trade-chatbot/be-candle/seriesCache"
+	"github.com/paper-trade-chatbot/be-common/logging"
+)
+
+// PartitionReport is a month partition whose candles all expired. It is
+// dropped unless some of its candles were not verified or are children of
+// inconsistent candles, then it is kept whole until a later run.
+type PartitionReport struct {
+	Table     string `json:"table"`
+	Partition string `json:"partition"`
+	Rows      int64  `json:"rows"` // estimated
+	Dropped   bool   `json:"dropped"`
+}
+
+// partitionDrop is the expired partitions of a partitioned table. Their rows
+// are verified like any expired candles but not deleted one by one, the
+// partitions are dropped once every interval of the table was verified.
+type partitionDrop struct {
+	table      string
+	intervals  []dbModels.IntervalType
+	before     time.Time // the expired partitions hold the rows starting before
+	partitions []*dbModels.PartitionModel
+	blocked    map[string]bool
+	products   map[uint64]bool
+}
+
+// partitionDrops returns the expired partitions of every partitioned table,
+// by table. A table holding an interval kept forever expires no partition.
+func (r *Retainer) partitionDrops(ctx context.Context, now time.Time) (map[string]*partitionDrop, error) {
+
+	drops := map[string]*partitionDrop{}
+	for _, table := range candleDao.PartitionedTables() {
+
+		d := &partitionDrop{
+			table:    table,
+			blocked:  map[string]bool{},
+			products: map[uint64]bool{},
+		}
+		cutoff := now
+		for _, interval := range dbModels.IntervalTypes {
+			if candleDao.TableOf(interval) != table {
+				continue
+			}
+			keep, ok := r.Policy[interval]
+			if !ok {
+				d.intervals = nil
+				break
+			}
+			d.intervals = append(d.intervals, interval)
+			if now.Add(-keep).Before(cutoff) {
+				cutoff = now.Add(-keep)
+			}
+		}
+		if len(d.intervals) == 0 {
+			continue
+		}
+
+		partitions, err := r.Store.GetPartitions(table)
+		if err != nil {
+			logging.Error(ctx, "[partitionDrops] gets %s error: %v", table, err)
+			return nil, err
+		}
+		for _, p := range partitions {
+			before, ok := p.Before()
+			if !ok || before.After(cutoff) {
+				break
+			}
+			d.partitions = append(d.partitions, p)
+			d.before = before
+		}
+		if len(d.partitions) > 0 {
+			drops[table] = d
+		}
+	}
+
+	return drops, nil
+}
+
+// holds reports whether start is within the expired partitions.
+func (d *partitionDrop) holds(start time.Time) bool {
+	return d != nil && start.Before(d.before)
+}
+
+// block keeps the partition holding start.
+func (d *partitionDrop) block(start time.Time) {
+	if !d.holds(start) {
+		return
+	}
+	for _, p := range d.partitions {
+		if before, _ := p.Before(); start.Before(before) {
+			d.blocked[p.Name] = true
+			return
+		}
+	}
+}
+
+// blockFrom keeps the partitions holding rows starting at or after from.
+func (d *partitionDrop) blockFrom(from time.Time) {
+	if !d.holds(from) {
+		return
+	}
+	for _, p := range d.partitions {
+		if before, _ := p.Before(); before.After(from) {
+			d.blocked[p.Name] = true
+		}
+	}
+}
+
+// drop drops the expired partitions not blocked, reporting every expired partition.
+func (d *partitionDrop) drop(ctx context.Context, store candleDao.CandleStore, dryRun bool) ([]*PartitionReport, error) {
+
+	reports := []*PartitionReport{}
+	names := []string{}
+	for _, p := range d.partitions {
+		dropped := !d.blocked[p.Name]
+		reports = append(reports, &PartitionReport{
+			Table:     d.table,
+			Partition: p.Name,
+			Rows:      p.Rows,
+			Dropped:   dropped,
+		})
+		if dropped {
+			names = append(names, p.Name)
+		}
+	}
+	if dryRun || len(names) == 0 {
+		return reports, nil
+	}
+
+	if err := store.DropPartitions(d.table, names); err != nil {
+		logging.Error(ctx, "[partitionDrop.drop] drops %s %v error: %v", d.table, names, err)
+		return nil, err
+	}
+
+	series := []*dbModels.CandleModel{}
+	for productID := range d.products {
+		for _, interval := range d.intervals {
+			series = append(series, &dbModels.CandleModel{ProductID: productID, IntervalType: interval})
+		}
+	}
+	seriesCache.GetCache().Invalidate(ctx, series)
+	return reports, nil
+}
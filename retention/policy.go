@@ -0,0 +1,68 @@
+package retention
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+)
+
+var ErrInvalidPolicy = errors.New("invalid retention policy")
+
+// Policy is how long the candles of each interval are kept, intervals not
+// listed are kept forever.
+type Policy map[dbModels.IntervalType]time.Duration
+
+// ParsePolicy parses comma separated entries of <interval>=<days>, e.g.
+// 1MI=30,5MI=365 keeps 1MI candles for 30 days, 5MI candles for a year and
+// every other interval forever.
+func ParsePolicy(raw string) (Policy, error) {
+
+	policy := Policy{}
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		keyValue := strings.SplitN(entry, "=", 2)
+		if len(keyValue) != 2 {
+			return nil, ErrInvalidPolicy
+		}
+		interval, ok := dbModels.IntervalTypeByName(strings.TrimSpace(keyValue[0]))
+		if !ok {
+			return nil, ErrInvalidPolicy
+		}
+		days, err := strconv.Atoi(strings.TrimSpace(keyValue[1]))
+		if err != nil || days <= 0 {
+			return nil, ErrInvalidPolicy
+		}
+		policy[interval] = time.Duration(days) * time.Hour * 24
+	}
+
+	return policy, nil
+}
+
+// outlives reports whether t is kept longer than other.
+func (p Policy) outlives(t, other dbModels.IntervalType) bool {
+	keep, ok := p[t]
+	if !ok {
+		return true
+	}
+	otherKeep, ok := p[other]
+	return ok && keep > otherKeep
+}
+
+// verifiers returns the intervals built directly from t which outlive it, the
+// candles of t are deleted only once those hold them.
+func (p Policy) verifiers(t dbModels.IntervalType) []dbModels.IntervalType {
+	verifiers := []dbModels.IntervalType{}
+	for _, i := range dbModels.IntervalTypes {
+		if i.Source() == t && p.outlives(i, t) {
+			verifiers = append(verifiers, i)
+		}
+	}
+	return verifiers
+}
@@ -0,0 +1,422 @@
+package retention
+
+import (
+	"context"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-candle/aggregation"
+	"github.com/paper-trade-chatbot/be-candle/calendar"
+	"github.com/paper-trade-chatbot/be-candle/dao/candleDao"
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	"github.com/paper-trade-chatbot/be-candle/seriesCache"
+	"github.com/paper-trade-chatbot/be-common/config"
+	"github.com/paper-trade-chatbot/be-common/logging"
+)
+
+// IntervalReport is what a run did, or would do in a dry run, to the candles
+// of one interval. Inconsistent counts the coarser candles which differ from
+// the candles they are built from, those are kept for someone to look at.
+type IntervalReport struct {
+	IntervalType dbModels.IntervalType `json:"intervalType"`
+	Name         string                `json:"name"`
+	Cutoff       int64                 `json:"cutoff"` // candles starting before are expired
+	Deleted      int64                 `json:"deleted"`
+	Downsampled  int                   `json:"downsampled"` // coarser candles created before deleting
+	Inconsistent int                   `json:"inconsistent"`
+}
+
+// Report is a run over every interval with a policy. Complete is false if
+// the run stopped early, the next run picks up where it stopped, no partition
+// is dropped then.
+type Report struct {
+	DryRun     bool               `json:"dryRun"`
+	Complete   bool               `json:"complete"`
+	Intervals  []*IntervalReport  `json:"intervals"`
+	Partitions []*PartitionReport `json:"partitions"`
+}
+
+// Retainer deletes the candles older than their Policy, ChunkSize rows at a
+// time with a Pause in between so that the generators keep their pace.
+// Before candles are deleted the candles of the intervals built from them,
+// which are kept longer, are checked: missing ones are aggregated from the
+// expired candles and stored, ones differing from the aggregate keep their
+// children from being deleted.
+// Month partitions of a partitioned table whose candles all expired are
+// dropped instead, after the same checks.
+type Retainer struct {
+	Store     candleDao.CandleStore
+	Policy    Policy
+	DryRun    bool
+	ChunkSize int
+	Pause     time.Duration
+}
+
+var retainerInstance *Retainer
+
+// Initialize creates the global retainer with CANDLE_RETENTION,
+// CANDLE_RETENTION_DRY_RUN, CANDLE_RETENTION_CHUNK_SIZE and
+// CANDLE_RETENTION_PAUSE_MS over store. An invalid policy panics rather than
+// deleting the wrong candles.
+func Initialize(ctx context.Context, store candleDao.CandleStore) {
+
+	policy, err := ParsePolicy(config.GetString("CANDLE_RETENTION"))
+	if err != nil {
+		logging.Error(ctx, "[retention.Initialize] CANDLE_RETENTION err: %v", err)
+		panic(err)
+	}
+
+	retainerInstance = New(
+		store,
+		policy,
+		config.GetBool("CANDLE_RETENTION_DRY_RUN"),
+		config.GetInt("CANDLE_RETENTION_CHUNK_SIZE"),
+		config.GetMilliseconds("CANDLE_RETENTION_PAUSE_MS"),
+	)
+	for _, interval := range dbModels.IntervalTypes {
+		if keep, ok := policy[interval]; ok {
+			logging.Info(ctx, "candle retention %s: %v", interval.Name(), keep)
+		}
+	}
+	logging.Info(ctx, "candle retention dry run: %t, chunk size: %d, pause: %v", retainerInstance.DryRun, retainerInstance.ChunkSize, retainerInstance.Pause)
+}
+
+// GetRetainer returns the global retainer.
+func GetRetainer() *Retainer {
+	return retainerInstance
+}
+
+func New(store candleDao.CandleStore, policy Policy, dryRun bool, chunkSize int, pause time.Duration) *Retainer {
+	return &Retainer{
+		Store:     store,
+		Policy:    policy,
+		DryRun:    dryRun,
+		ChunkSize: chunkSize,
+		Pause:     pause,
+	}
+}
+
+// Apply expires the candles of every interval with a policy, from fine to
+// coarse. A dry run only reports, DryRun of the retainer makes every run dry.
+// If ctx is done Apply stops after the chunk at hand and returns the report
+// so far with ctx's error.
+func (r *Retainer) Apply(ctx context.Context, now time.Time, dryRun bool) (*Report, error) {
+
+	report := &Report{
+		DryRun:     dryRun || r.DryRun,
+		Intervals:  []*IntervalReport{},
+		Partitions: []*PartitionReport{},
+	}
+
+	calendars, err := calendar.GetProductCalendars(ctx)
+	if err != nil {
+		logging.Error(ctx, "[Apply] GetProductCalendars err: %v", err)
+		return nil, err
+	}
+
+	drops, err := r.partitionDrops(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, interval := range dbModels.IntervalTypes {
+		keep, ok := r.Policy[interval]
+		if !ok {
+			continue
+		}
+
+		ir := &IntervalReport{
+			IntervalType: interval,
+			Name:         interval.Name(),
+			Cutoff:       now.Add(-keep).Unix(),
+		}
+		report.Intervals = append(report.Intervals, ir)
+
+		if err := r.expire(ctx, calendars, now.Add(-keep), drops[candleDao.TableOf(interval)], report.DryRun, ir); err != nil {
+			return report, err
+		}
+	}
+
+	for _, table := range candleDao.PartitionedTables() {
+		d, ok := drops[table]
+		if !ok {
+			continue
+		}
+		partitions, err := d.drop(ctx, r.Store, report.DryRun)
+		if err != nil {
+			return report, err
+		}
+		report.Partitions = append(report.Partitions, partitions...)
+	}
+
+	report.Complete = true
+	return report, nil
+}
+
+// expire deletes the candles of ir.IntervalType starting before cutoff,
+// product by product, leaving the ones in expired partitions to drop.
+func (r *Retainer) expire(ctx context.Context, calendars map[uint64]*calendar.Calendar, cutoff time.Time, drop *partitionDrop, dryRun bool, ir *IntervalReport) error {
+
+	interval := ir.IntervalType
+	verifiers := r.Policy.verifiers(interval)
+
+	epoch := time.Unix(0, 0)
+	before := cutoff.Add(-time.Second)
+	productIDs, err := r.Store.GetProductIDs(&candleDao.QueryModel{
+		IntervalType: interval,
+		StartFrom:    &epoch,
+		StartTo:      &before,
+	})
+	if err != nil {
+		logging.Error(ctx, "[expire] GetProductIDs %s error: %v", interval.Name(), err)
+		return err
+	}
+
+	for _, productID := range productIDs {
+		e := &expiry{
+			Retainer:  r,
+			interval:  interval,
+			productID: productID,
+			verifiers: verifiers,
+			anchors:   map[dbModels.IntervalType]dbModels.Anchor{},
+			drop:      drop,
+			dryRun:    dryRun,
+			report:    ir,
+		}
+
+		// only buckets of the verifiers which closed by the cutoff are expired
+		e.boundary = cutoff
+		for _, v := range verifiers {
+			anchor := dbModels.UTCAnchor
+			if v.Duration() == 0 {
+				anchor = calendar.Of(calendars, productID).Anchor
+			}
+			e.anchors[v] = anchor
+			if start := anchor.Truncate(v, cutoff); start.Before(e.boundary) {
+				e.boundary = start
+			}
+		}
+		// the rows from the boundary on are not verified by this run
+		drop.blockFrom(e.boundary)
+
+		if err := e.run(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// expiry expires the candles of an interval of a product starting before boundary.
+type expiry struct {
+	*Retainer
+	interval  dbModels.IntervalType
+	productID uint64
+	verifiers []dbModels.IntervalType
+	anchors   map[dbModels.IntervalType]dbModels.Anchor
+	boundary  time.Time
+	drop      *partitionDrop
+	dryRun    bool
+	report    *IntervalReport
+}
+
+func (e *expiry) run(ctx context.Context) error {
+
+	epoch := time.Unix(0, 0)
+	to := e.boundary.Add(-time.Second)
+	query := &candleDao.QueryModel{
+		ProductID:    e.productID,
+		IntervalType: e.interval,
+		StartFrom:    &epoch,
+		StartTo:      &to,
+	}
+
+	var cursor *candleDao.Cursor
+	carried := []dbModels.CandleModel{}
+	for {
+		rows, next, err := e.Store.GetsByKeyset(query, cursor, e.ChunkSize)
+		if err != nil {
+			logging.Error(ctx, "[expiry.run] GetsByKeyset %s error: %v", e.interval.Name(), err)
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		rows = append(carried, rows...)
+
+		// rows are complete up to the last one, or up to the boundary on the last page
+		completeTo := e.boundary
+		if next != nil {
+			completeTo = rows[len(rows)-1].Start
+		}
+		settled := e.settled(rows, completeTo)
+		carried = append([]dbModels.CandleModel{}, rows[settled:]...)
+
+		expired, err := e.verify(ctx, rows[:settled])
+		if err != nil {
+			return err
+		}
+		if err := e.delete(ctx, expired); err != nil {
+			return err
+		}
+
+		if next == nil {
+			// left for a later run, whose boundary settles them
+			for i := range carried {
+				e.drop.block(carried[i].Start)
+			}
+			return nil
+		}
+		cursor = next
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !e.dryRun && e.Pause > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(e.Pause):
+			}
+		}
+	}
+}
+
+// settled returns how many of rows, in start order, belong to buckets of
+// every verifier which end by completeTo, i.e. are all within rows. No bucket
+// of a verifier is split between the settled rows and the rest.
+func (e *expiry) settled(rows []dbModels.CandleModel, completeTo time.Time) int {
+	for i := range rows {
+		for _, v := range e.verifiers {
+			anchor := e.anchors[v]
+			if anchor.Next(v, anchor.Truncate(v, rows[i].Start)).After(completeTo) {
+				return e.before(rows, rows[i].Start)
+			}
+		}
+	}
+	return len(rows)
+}
+
+// before returns how many of rows start before the first bucket boundary of
+// every verifier at or before cut.
+func (e *expiry) before(rows []dbModels.CandleModel, cut time.Time) int {
+	for moved := true; moved; {
+		moved = false
+		for _, v := range e.verifiers {
+			if start := e.anchors[v].Truncate(v, cut); start.Before(cut) {
+				cut = start
+				moved = true
+			}
+		}
+	}
+	for i := range rows {
+		if !rows[i].Start.Before(cut) {
+			return i
+		}
+	}
+	return len(rows)
+}
+
+// verify checks the candles of every verifier built from rows, storing the
+// missing ones. Returns the rows which may be deleted, all but the children of
+// inconsistent candles.
+func (e *expiry) verify(ctx context.Context, rows []dbModels.CandleModel) ([]*dbModels.CandleModel, error) {
+
+	kept := map[int64]bool{}
+	for _, v := range e.verifiers {
+		anchor := e.anchors[v]
+		aggregated := aggregation.Aggregate(v, rows, anchor)
+		if len(aggregated) == 0 {
+			continue
+		}
+
+		stored, err := e.Store.GetsByKeys(aggregated)
+		if err != nil {
+			logging.Error(ctx, "[expiry.verify] GetsByKeys %s error: %v", v.Name(), err)
+			return nil, err
+		}
+		byStart := map[int64]*dbModels.CandleModel{}
+		for _, s := range stored {
+			byStart[s.Start.Unix()] = s
+		}
+
+		missing := []*dbModels.CandleModel{}
+		for _, a := range aggregated {
+			s, ok := byStart[a.Start.Unix()]
+			if !ok {
+				missing = append(missing, a)
+				continue
+			}
+			if !sameValues(a, s) {
+				logging.Warn(ctx, "[expiry.verify] product %d %s %v differs from its %s candles, keep them", e.productID, v.Name(), a.Start, e.interval.Name())
+				e.report.Inconsistent++
+				for i := range rows {
+					if anchor.Truncate(v, rows[i].Start).Equal(a.Start) {
+						kept[rows[i].Start.Unix()] = true
+						e.drop.block(rows[i].Start)
+					}
+				}
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+
+		e.report.Downsampled += len(missing)
+		if e.dryRun {
+			continue
+		}
+		// a generator storing the candle meanwhile wins
+		result, err := e.Store.Upserts(missing, candleDao.ConflictMode_Skip)
+		if err != nil {
+			logging.Error(ctx, "[expiry.verify] upserts %s error: %v", v.Name(), err)
+			return nil, err
+		}
+		seriesCache.GetCache().Stored(ctx, missing, candleDao.ConflictMode_Skip, result)
+	}
+
+	expired := []*dbModels.CandleModel{}
+	for i := range rows {
+		if !kept[rows[i].Start.Unix()] {
+			expired = append(expired, &rows[i])
+		}
+	}
+	return expired, nil
+}
+
+func (e *expiry) delete(ctx context.Context, expired []*dbModels.CandleModel) error {
+
+	deletes := []*dbModels.CandleModel{}
+	for _, m := range expired {
+		if e.drop.holds(m.Start) {
+			e.drop.products[m.ProductID] = true
+			continue
+		}
+		deletes = append(deletes, m)
+	}
+	expired = deletes
+
+	if len(expired) == 0 {
+		return nil
+	}
+	if e.dryRun {
+		e.report.Deleted += int64(len(expired))
+		return nil
+	}
+
+	deleted, err := e.Store.DeletesByKeys(expired)
+	e.report.Deleted += deleted
+	if err != nil {
+		logging.Error(ctx, "[expiry.delete] DeletesByKeys %s error: %v", e.interval.Name(), err)
+		return err
+	}
+	seriesCache.GetCache().Invalidate(ctx, expired)
+	return nil
+}
+
+func sameValues(m, other *dbModels.CandleModel) bool {
+	return m.Open.Equal(other.Open) &&
+		m.Close.Equal(other.Close) &&
+		m.High.Equal(other.High) &&
+		m.Low.Equal(other.Low) &&
+		m.Volume.Equal(other.Volume)
+}
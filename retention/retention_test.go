@@ -0,0 +1,346 @@
+package retention
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-candle/aggregation"
+	"github.com/paper-trade-chatbot/be-candle/dao/candleDao"
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	"github.com/paper-trade-chatbot/be-candle/seriesCache"
+	"github.com/paper-trade-chatbot/be-candle/service"
+	productService "github.com/paper-trade-chatbot/be-candle/service/product"
+	"github.com/paper-trade-chatbot/be-common/cache"
+	"github.com/paper-trade-chatbot/be-proto/product"
+	"github.com/shopspring/decimal"
+)
+
+// products of no exchange trade all day on UTC days
+type noExchanges struct {
+	productService.ProductIntf
+}
+
+func (noExchanges) GetExchanges(ctx context.Context, in *product.GetExchangesReq) (*product.GetExchangesRes, error) {
+	return &product.GetExchangesRes{}, nil
+}
+
+func (noExchanges) GetProducts(ctx context.Context, in *product.GetProductsReq) (*product.GetProductsRes, error) {
+	return &product.GetProductsRes{}, nil
+}
+
+// partitionedStore keeps the 1MI candles in the given partitions. It checks
+// that no candle is deleted before every candle built from it was verified.
+type partitionedStore struct {
+	*candleDao.MemoryStore
+	t          *testing.T
+	partitions []*dbModels.PartitionModel
+	dropped    []string
+	verified   map[string]bool
+}
+
+func newPartitionedStore(t *testing.T, befores ...time.Time) *partitionedStore {
+	s := &partitionedStore{
+		MemoryStore: candleDao.NewMemoryStore(),
+		t:           t,
+		verified:    map[string]bool{},
+	}
+	for _, before := range befores {
+		s.partitions = append(s.partitions, &dbModels.PartitionModel{
+			Name:        dbModels.PartitionName(before.AddDate(0, 0, -1)),
+			Description: strconv.FormatInt(before.Unix(), 10),
+		})
+	}
+	s.partitions = append(s.partitions, &dbModels.PartitionModel{Name: "p_future", Description: "MAXVALUE"})
+	return s
+}
+
+func candleKey(m *dbModels.CandleModel) string {
+	return strconv.FormatUint(m.ProductID, 10) + "/" + m.IntervalType.Name() + "/" + m.Start.UTC().String()
+}
+
+func (s *partitionedStore) GetsByKeys(m []*dbModels.CandleModel) ([]*dbModels.CandleModel, error) {
+	for _, c := range m {
+		s.verified[candleKey(c)] = true
+	}
+	return s.MemoryStore.GetsByKeys(m)
+}
+
+func (s *partitionedStore) DeletesByKeys(m []*dbModels.CandleModel) (int64, error) {
+	for _, c := range m {
+		for _, v := range policy.verifiers(c.IntervalType) {
+			parent := &dbModels.CandleModel{ProductID: c.ProductID, IntervalType: v, Start: dbModels.UTCAnchor.Truncate(v, c.Start)}
+			if !s.verified[candleKey(parent)] {
+				s.t.Errorf("%s deleted before %s was verified", candleKey(c), candleKey(parent))
+			}
+		}
+	}
+	return s.MemoryStore.DeletesByKeys(m)
+}
+
+func (s *partitionedStore) GetPartitions(table string) ([]*dbModels.PartitionModel, error) {
+	if table != candleDao.TableOf(dbModels.IntervalType_1MI) {
+		return []*dbModels.PartitionModel{}, nil
+	}
+	return s.partitions, nil
+}
+
+func (s *partitionedStore) DropPartitions(table string, names []string) error {
+	epoch := time.Unix(0, 0)
+	from := epoch
+	for _, p := range s.partitions {
+		before, ok := p.Before()
+		if !ok {
+			break
+		}
+		for _, name := range names {
+			if name != p.Name {
+				continue
+			}
+			to := before.Add(-time.Second)
+			rows, err := s.MemoryStore.Gets(&candleDao.QueryModel{IntervalType: dbModels.IntervalType_1MI, StartFrom: &from, StartTo: &to})
+			if err != nil {
+				return err
+			}
+			deletes := []*dbModels.CandleModel{}
+			for i := range rows {
+				deletes = append(deletes, &rows[i])
+			}
+			if _, err := s.MemoryStore.DeletesByKeys(deletes); err != nil {
+				return err
+			}
+			s.dropped = append(s.dropped, name)
+		}
+		from = before
+	}
+	return nil
+}
+
+func setUp(t *testing.T) {
+	t.Helper()
+	t.Setenv("CANDLE_CACHE_SIZE", "0")
+	t.Setenv("CANDLE_ANCHORS", "")
+
+	_, closeRedis := cache.SetRedisMock()
+	t.Cleanup(closeRedis)
+
+	service.Impl.ProductIntf = noExchanges{}
+	seriesCache.Initialize(context.Background())
+}
+
+func at(value string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", value, time.UTC)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// addMinutes stores n 1MI candles of productID from start on.
+func addMinutes(t *testing.T, store candleDao.CandleStore, productID uint64, start time.Time, n int) []dbModels.CandleModel {
+	t.Helper()
+	models := []*dbModels.CandleModel{}
+	candles := []dbModels.CandleModel{}
+	for i := 0; i < n; i++ {
+		price := decimal.NewFromInt(int64(100 + i))
+		m := &dbModels.CandleModel{
+			ProductID:    productID,
+			IntervalType: dbModels.IntervalType_1MI,
+			Start:        start.Add(time.Duration(i) * time.Minute),
+			Open:         price,
+			Close:        price.Add(decimal.NewFromInt(1)),
+			High:         price.Add(decimal.NewFromInt(2)),
+			Low:          price.Sub(decimal.NewFromInt(1)),
+			Volume:       decimal.NewFromInt(int64(i + 1)),
+		}
+		models = append(models, m)
+		candles = append(candles, *m)
+	}
+	if _, err := store.News(models); err != nil {
+		t.Fatal(err)
+	}
+	return candles
+}
+
+// addAggregated stores the candles of interval built from children, the one
+// starting at wrong with a different close.
+func addAggregated(t *testing.T, store candleDao.CandleStore, interval dbModels.IntervalType, children []dbModels.CandleModel, wrong *time.Time) {
+	t.Helper()
+	models := aggregation.Aggregate(interval, children, dbModels.UTCAnchor)
+	for _, m := range models {
+		if wrong != nil && m.Start.Equal(*wrong) {
+			m.Close = m.Close.Add(decimal.NewFromInt(1))
+		}
+	}
+	if _, err := store.News(models); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func count(t *testing.T, store candleDao.CandleStore, productID uint64, interval dbModels.IntervalType, from, to time.Time) int {
+	t.Helper()
+	to = to.Add(-time.Second)
+	rows, err := store.Gets(&candleDao.QueryModel{ProductID: productID, IntervalType: interval, StartFrom: &from, StartTo: &to})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(rows)
+}
+
+func intervalReport(t *testing.T, report *Report, interval dbModels.IntervalType) *IntervalReport {
+	t.Helper()
+	for _, ir := range report.Intervals {
+		if ir.IntervalType == interval {
+			return ir
+		}
+	}
+	t.Fatalf("no report of %s", interval.Name())
+	return nil
+}
+
+// 1MI candles are kept 30 days and verified by 2MI and 5MI, kept forever
+var policy = Policy{dbModels.IntervalType_1MI: 30 * 24 * time.Hour}
+
+func TestApplyDeletesVerified(t *testing.T) {
+	setUp(t)
+
+	now := at("2026-10-18 00:00:00")
+	store := newPartitionedStore(t, at("2026-09-01 00:00:00"), at("2026-10-01 00:00:00"))
+
+	august := addMinutes(t, store, 1, at("2026-08-10 00:00:00"), 10)
+	addAggregated(t, store, dbModels.IntervalType_5MI, august, nil)
+	addAggregated(t, store, dbModels.IntervalType_2MI, august, nil)
+	addMinutes(t, store, 1, at("2026-09-10 00:00:00"), 10)
+	addMinutes(t, store, 1, at("2026-09-20 00:00:00"), 10) // not expired
+
+	report, err := New(store, policy, false, 1000, 0).Apply(context.Background(), now, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ir := intervalReport(t, report, dbModels.IntervalType_1MI)
+	if !report.Complete || ir.Deleted != 10 || ir.Downsampled != 7 || ir.Inconsistent != 0 {
+		t.Fatalf("report %+v, 1MI %+v", report, ir)
+	}
+	if len(store.dropped) != 1 || store.dropped[0] != "p202608" {
+		t.Fatalf("dropped %v, want [p202608]", store.dropped)
+	}
+	if n := count(t, store, 1, dbModels.IntervalType_1MI, at("2026-08-01 00:00:00"), now); n != 10 {
+		t.Fatalf("%d 1MI candles left, want the 10 not expired", n)
+	}
+	// the expired September candles are kept aggregated
+	if n := count(t, store, 1, dbModels.IntervalType_5MI, at("2026-09-10 00:00:00"), at("2026-09-11 00:00:00")); n != 2 {
+		t.Fatalf("%d 5MI candles downsampled, want 2", n)
+	}
+}
+
+// TestApplyKeepsInconsistent keeps the children of a 5MI candle which differs
+// from them. The children are read in chunks smaller than the bucket.
+func TestApplyKeepsInconsistent(t *testing.T) {
+	setUp(t)
+
+	now := at("2026-10-18 00:00:00")
+	store := newPartitionedStore(t, at("2026-09-01 00:00:00"), at("2026-10-01 00:00:00"))
+
+	// the 5MI candle of 00:05 differs in the partition to drop and out of it
+	wrong := at("2026-08-10 00:05:00")
+	august := addMinutes(t, store, 1, at("2026-08-10 00:00:00"), 10)
+	addAggregated(t, store, dbModels.IntervalType_5MI, august, &wrong)
+	addAggregated(t, store, dbModels.IntervalType_2MI, august, nil)
+
+	wrongSeptember := at("2026-09-10 00:05:00")
+	september := addMinutes(t, store, 1, at("2026-09-10 00:00:00"), 15)
+	addAggregated(t, store, dbModels.IntervalType_5MI, september, &wrongSeptember)
+	addAggregated(t, store, dbModels.IntervalType_2MI, september, nil)
+
+	report, err := New(store, policy, false, 3, 0).Apply(context.Background(), now, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ir := intervalReport(t, report, dbModels.IntervalType_1MI)
+	if !report.Complete || ir.Inconsistent != 2 || ir.Deleted != 10 {
+		t.Fatalf("report %+v, 1MI %+v", report, ir)
+	}
+	// the partition holding the children of the inconsistent candle is kept whole
+	if len(store.dropped) != 0 || len(report.Partitions) != 1 || report.Partitions[0].Dropped {
+		t.Fatalf("dropped %v, partitions %+v", store.dropped, report.Partitions)
+	}
+	if n := count(t, store, 1, dbModels.IntervalType_1MI, at("2026-08-10 00:00:00"), at("2026-08-11 00:00:00")); n != 10 {
+		t.Fatalf("%d August 1MI candles left, want 10", n)
+	}
+	// out of it only the children of the inconsistent candle are kept
+	if n := count(t, store, 1, dbModels.IntervalType_1MI, at("2026-09-10 00:00:00"), at("2026-09-11 00:00:00")); n != 5 {
+		t.Fatalf("%d September 1MI candles left, want 5", n)
+	}
+	if n := count(t, store, 1, dbModels.IntervalType_1MI, wrongSeptember, wrongSeptember.Add(5*time.Minute)); n != 5 {
+		t.Fatalf("%d children of the inconsistent candle left, want 5", n)
+	}
+}
+
+// TestApplyBlocksUnverified expires the candles before 00:03 while the 5MI
+// bucket of 00:00 is still open: the candles from 00:00 on are not verified,
+// so the partition holding them is kept.
+func TestApplyBlocksUnverified(t *testing.T) {
+	setUp(t)
+
+	now := at("2026-10-18 00:03:00")
+	// the partition ends within the bucket
+	store := newPartitionedStore(t, at("2026-09-18 00:02:00"))
+
+	addMinutes(t, store, 1, at("2026-09-17 23:50:00"), 12)
+
+	report, err := New(store, policy, false, 1000, 0).Apply(context.Background(), now, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ir := intervalReport(t, report, dbModels.IntervalType_1MI)
+	if !report.Complete || ir.Deleted != 0 || ir.Downsampled != 7 {
+		t.Fatalf("report %+v, 1MI %+v", report, ir)
+	}
+	if len(store.dropped) != 0 || len(report.Partitions) != 1 || report.Partitions[0].Dropped {
+		t.Fatalf("dropped %v, partitions %+v", store.dropped, report.Partitions)
+	}
+	if n := count(t, store, 1, dbModels.IntervalType_1MI, at("2026-09-17 00:00:00"), now); n != 12 {
+		t.Fatalf("%d 1MI candles left, want 12", n)
+	}
+}
+
+func TestApplyDryRun(t *testing.T) {
+	setUp(t)
+
+	now := at("2026-10-18 00:00:00")
+	store := newPartitionedStore(t, at("2026-09-01 00:00:00"), at("2026-10-01 00:00:00"))
+
+	addMinutes(t, store, 1, at("2026-08-10 00:00:00"), 10)
+	addMinutes(t, store, 1, at("2026-09-10 00:00:00"), 10)
+
+	for _, r := range []*Retainer{New(store, policy, false, 3, 0), New(store, policy, true, 3, 0)} {
+		report, err := r.Apply(context.Background(), now, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ir := intervalReport(t, report, dbModels.IntervalType_1MI)
+		if !report.DryRun || !report.Complete || ir.Deleted != 10 || ir.Downsampled != 14 {
+			t.Fatalf("report %+v, 1MI %+v", report, ir)
+		}
+		if len(report.Partitions) != 1 || !report.Partitions[0].Dropped {
+			t.Fatalf("partitions %+v", report.Partitions)
+		}
+	}
+
+	if len(store.dropped) != 0 {
+		t.Fatalf("dry run dropped %v", store.dropped)
+	}
+	if n := count(t, store, 1, dbModels.IntervalType_1MI, at("2026-08-01 00:00:00"), now); n != 20 {
+		t.Fatalf("dry run left %d 1MI candles, want 20", n)
+	}
+	for _, interval := range []dbModels.IntervalType{dbModels.IntervalType_2MI, dbModels.IntervalType_5MI} {
+		if n := count(t, store, 1, interval, at("2026-08-01 00:00:00"), now); n != 0 {
+			t.Fatalf("dry run stored %d %s candles", n, interval.Name())
+		}
+	}
+}
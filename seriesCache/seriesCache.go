@@ -0,0 +1,399 @@
+package seriesCache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/paper-trade-chatbot/be-candle/dao/candleDao"
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	"github.com/paper-trade-chatbot/be-common/cache"
+	"github.com/paper-trade-chatbot/be-common/config"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/shopspring/decimal"
+)
+
+// series expire unless written, bounding how long a missed write can linger
+const ttl = time.Hour
+
+// errWritten means the series was written while it was being loaded
+var errWritten = errors.New("series written while loading")
+
+// writeScript adds candles to a loaded series and trims it to ARGV[1] candles.
+// Candles older than the window are ignored, the series would have holes otherwise.
+// The version is bumped even if the series is not loaded, see load.
+var writeScript = redis.NewScript(`
+redis.call('INCR', KEYS[3])
+redis.call('EXPIRE', KEYS[3], ARGV[2])
+local from = redis.call('GET', KEYS[2])
+if not from then
+	return 0
+end
+from = tonumber(from)
+for i = 3, #ARGV, 2 do
+	if tonumber(ARGV[i]) >= from then
+		redis.call('ZREMRANGEBYSCORE', KEYS[1], ARGV[i], ARGV[i])
+		redis.call('ZADD', KEYS[1], ARGV[i], ARGV[i + 1])
+	end
+end
+local size = tonumber(ARGV[1])
+if redis.call('ZCARD', KEYS[1]) > size then
+	redis.call('ZREMRANGEBYRANK', KEYS[1], 0, -size - 1)
+	local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+	redis.call('SET', KEYS[2], oldest[2])
+end
+redis.call('EXPIRE', KEYS[1], ARGV[2])
+redis.call('EXPIRE', KEYS[2], ARGV[2])
+return 1
+`)
+
+// Stats counts cache usage since start.
+type Stats struct {
+	Hits          uint64 `json:"hits"`
+	Misses        uint64 `json:"misses"`
+	Loads         uint64 `json:"loads"`
+	Writes        uint64 `json:"writes"`
+	Invalidations uint64 `json:"invalidations"`
+}
+
+// SeriesCache keeps the latest Size candles of each (product, interval) in a
+// Redis sorted set scored by start, together with the start of the oldest
+// candle from which on the set is complete. Series are loaded on the first
+// read and kept up to date by the writers; a Size of 0 disables the cache.
+type SeriesCache struct {
+	Size int
+
+	hits          uint64
+	misses        uint64
+	loads         uint64
+	writes        uint64
+	invalidations uint64
+}
+
+var cacheInstance *SeriesCache
+
+// Initialize creates the global cache holding CANDLE_CACHE_SIZE candles per series.
+func Initialize(ctx context.Context) {
+	cacheInstance = New(config.GetInt("CANDLE_CACHE_SIZE"))
+	logging.Info(ctx, "candle cache size: %d", cacheInstance.Size)
+}
+
+// GetCache returns the global cache.
+func GetCache() *SeriesCache {
+	return cacheInstance
+}
+
+func New(size int) *SeriesCache {
+	return &SeriesCache{
+		Size: size,
+	}
+}
+
+// Gets returns the candles of the series starting within [from, to] in
+// ascending start order, loading the series on first use. ok is false if the
+// window is not entirely cached.
+func (c *SeriesCache) Gets(ctx context.Context, store candleDao.CandleStore, productID uint64, intervalType dbModels.IntervalType, from, to time.Time) (models []dbModels.CandleModel, ok bool, err error) {
+
+	if c.Size <= 0 {
+		return nil, false, nil
+	}
+
+	r, _ := cache.GetRedis()
+	zsetKey, fromKey, _ := seriesKeys(productID, intervalType)
+
+	cachedFrom, err := r.Get(ctx, fromKey).Int64()
+	if errors.Is(err, redis.Nil) {
+		loaded, err := c.load(ctx, store, productID, intervalType)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(loaded) == c.Size && from.Before(loaded[0].Start) {
+			atomic.AddUint64(&c.misses, 1)
+			return nil, false, nil
+		}
+		atomic.AddUint64(&c.hits, 1)
+		return between(loaded, from, to), true, nil
+	}
+	if err != nil {
+		logging.Error(ctx, "[SeriesCache.Gets] redis error: %v", err)
+		return nil, false, err
+	}
+
+	if from.Unix() < cachedFrom {
+		atomic.AddUint64(&c.misses, 1)
+		return nil, false, nil
+	}
+
+	members, err := r.ZRangeByScore(ctx, zsetKey, &redis.ZRangeBy{
+		Min: strconv.FormatInt(from.Unix(), 10),
+		Max: strconv.FormatInt(to.Unix(), 10),
+	}).Result()
+	if err != nil {
+		logging.Error(ctx, "[SeriesCache.Gets] redis error: %v", err)
+		return nil, false, err
+	}
+
+	models = make([]dbModels.CandleModel, 0, len(members))
+	for _, m := range members {
+		model, err := decode(productID, intervalType, m)
+		if err != nil {
+			// a corrupt member makes the series unusable
+			logging.Error(ctx, "[SeriesCache.Gets] decode %s error: %v", m, err)
+			c.Invalidate(ctx, []*dbModels.CandleModel{{ProductID: productID, IntervalType: intervalType}})
+			atomic.AddUint64(&c.misses, 1)
+			return nil, false, nil
+		}
+		models = append(models, *model)
+	}
+
+	atomic.AddUint64(&c.hits, 1)
+	return models, true, nil
+}
+
+// load reads the latest Size candles of the series from store into the cache.
+// Every write bumps the version of the series, if it changed since before the
+// database read the candles read may miss the write and are not cached.
+func (c *SeriesCache) load(ctx context.Context, store candleDao.CandleStore, productID uint64, intervalType dbModels.IntervalType) ([]dbModels.CandleModel, error) {
+
+	r, _ := cache.GetRedis()
+	zsetKey, fromKey, versionKey := seriesKeys(productID, intervalType)
+
+	version, err := r.Get(ctx, versionKey).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		logging.Error(ctx, "[SeriesCache.load] redis error: %v", err)
+		return nil, err
+	}
+
+	models, err := store.GetLatest(productID, intervalType, c.Size)
+	if err != nil {
+		logging.Error(ctx, "[SeriesCache.load] GetLatest error: %v", err)
+		return nil, err
+	}
+
+	// a series shorter than Size holds every candle
+	var from int64 = 0
+	if len(models) == c.Size {
+		from = models[0].Start.Unix()
+	}
+
+	err = r.Watch(ctx, func(tx *redis.Tx) error {
+		current, err := tx.Get(ctx, versionKey).Int64()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		if current != version {
+			return errWritten
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, zsetKey)
+			if len(models) > 0 {
+				members := []*redis.Z{}
+				for i := range models {
+					members = append(members, &redis.Z{
+						Score:  float64(models[i].Start.Unix()),
+						Member: encode(&models[i]),
+					})
+				}
+				pipe.ZAdd(ctx, zsetKey, members...)
+				pipe.Expire(ctx, zsetKey, ttl)
+			}
+			pipe.Set(ctx, fromKey, from, ttl)
+			return nil
+		})
+		return err
+	}, versionKey)
+
+	// the candles read are as recent as a read from the store, only the cache is left empty
+	if errors.Is(err, errWritten) || errors.Is(err, redis.TxFailedErr) {
+		logging.Info(ctx, "[SeriesCache.load] series %s written while loading", zsetKey)
+		return models, nil
+	}
+	if err != nil {
+		logging.Error(ctx, "[SeriesCache.load] redis error: %v", err)
+		return nil, err
+	}
+
+	atomic.AddUint64(&c.loads, 1)
+	return models, nil
+}
+
+// Write stores candles exactly as they are now in the database into the
+// series already loaded, series not loaded yet are left alone.
+func (c *SeriesCache) Write(ctx context.Context, models []*dbModels.CandleModel) {
+
+	if c.Size <= 0 || len(models) == 0 {
+		return
+	}
+
+	r, _ := cache.GetRedis()
+	pipe := r.Pipeline()
+
+	for key, series := range groupBySeries(models) {
+		zsetKey, fromKey, versionKey := seriesKeys(key.productID, key.intervalType)
+		args := []interface{}{c.Size, int(ttl / time.Second)}
+		for _, m := range series {
+			args = append(args, m.Start.Unix(), encode(m))
+		}
+		// EVALSHA cannot fall back to EVAL within a pipeline
+		writeScript.Eval(ctx, pipe, []string{zsetKey, fromKey, versionKey}, args...)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		// the next write cannot repair a series which missed this one
+		logging.Error(ctx, "[SeriesCache.Write] redis error: %v", err)
+		c.Invalidate(ctx, models)
+		return
+	}
+	atomic.AddUint64(&c.writes, 1)
+}
+
+// Invalidate drops the series of models, to be reloaded on the next read.
+func (c *SeriesCache) Invalidate(ctx context.Context, models []*dbModels.CandleModel) {
+
+	if c.Size <= 0 || len(models) == 0 {
+		return
+	}
+
+	r, _ := cache.GetRedis()
+	pipe := r.TxPipeline()
+	for key := range groupBySeries(models) {
+		zsetKey, fromKey, versionKey := seriesKeys(key.productID, key.intervalType)
+		pipe.Del(ctx, zsetKey, fromKey)
+		// a load in progress must not cache what it read before the invalidation
+		pipe.Incr(ctx, versionKey)
+		pipe.Expire(ctx, versionKey, ttl)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		logging.Error(ctx, "[SeriesCache.Invalidate] redis error: %v", err)
+		return
+	}
+	atomic.AddUint64(&c.invalidations, 1)
+}
+
+// Stored updates the cache after candleDao.Upserts wrote models with mode.
+// Inserted rows are stored as given at revision 0 and changed rows are known
+// from result.Revised. If some rows were skipped, or updated without a known
+// outcome, e.g. repeated within models, their series are invalidated instead.
+func (c *SeriesCache) Stored(ctx context.Context, models []*dbModels.CandleModel, mode candleDao.ConflictMode, result *candleDao.UpsertResult) {
+	switch {
+	case result == nil:
+		c.Invalidate(ctx, models)
+	case result.Skipped > 0 || result.Updated > len(result.Revised):
+		c.Invalidate(ctx, models)
+	default:
+		revised := map[seriesKey]map[int64]*dbModels.CandleModel{}
+		for _, r := range result.Revised {
+			key := seriesKey{productID: r.ProductID, intervalType: r.IntervalType}
+			if revised[key] == nil {
+				revised[key] = map[int64]*dbModels.CandleModel{}
+			}
+			revised[key][r.Start.Unix()] = r
+		}
+
+		stored := make([]*dbModels.CandleModel, 0, len(models))
+		for _, m := range models {
+			if r, ok := revised[seriesKey{productID: m.ProductID, intervalType: m.IntervalType}][m.Start.Unix()]; ok {
+				stored = append(stored, r)
+				continue
+			}
+			inserted := *m
+			inserted.Revision = 0
+			stored = append(stored, &inserted)
+		}
+		c.Write(ctx, stored)
+	}
+}
+
+func (c *SeriesCache) Stats() *Stats {
+	return &Stats{
+		Hits:          atomic.LoadUint64(&c.hits),
+		Misses:        atomic.LoadUint64(&c.misses),
+		Loads:         atomic.LoadUint64(&c.loads),
+		Writes:        atomic.LoadUint64(&c.writes),
+		Invalidations: atomic.LoadUint64(&c.invalidations),
+	}
+}
+
+type seriesKey struct {
+	productID    uint64
+	intervalType dbModels.IntervalType
+}
+
+func groupBySeries(models []*dbModels.CandleModel) map[seriesKey][]*dbModels.CandleModel {
+	series := map[seriesKey][]*dbModels.CandleModel{}
+	for _, m := range models {
+		key := seriesKey{productID: m.ProductID, intervalType: m.IntervalType}
+		series[key] = append(series[key], m)
+	}
+	return series
+}
+
+func seriesKeys(productID uint64, intervalType dbModels.IntervalType) (zsetKey, fromKey, versionKey string) {
+	zsetKey = "candle:series:" + strconv.FormatUint(productID, 10) + ":" + strconv.Itoa(int(intervalType))
+	return zsetKey, zsetKey + ":from", zsetKey + ":version"
+}
+
+func between(models []dbModels.CandleModel, from, to time.Time) []dbModels.CandleModel {
+	result := []dbModels.CandleModel{}
+	for _, m := range models {
+		if !m.Start.Before(from) && !m.Start.After(to) {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+// encode stores start:open:close:high:low:volume:revision, decimals as strings
+// to stay exact
+func encode(m *dbModels.CandleModel) string {
+	return strings.Join([]string{
+		strconv.FormatInt(m.Start.Unix(), 10),
+		m.Open.String(),
+		m.Close.String(),
+		m.High.String(),
+		m.Low.String(),
+		m.Volume.String(),
+		strconv.FormatUint(uint64(m.Revision), 10),
+	}, ":")
+}
+
+func decode(productID uint64, intervalType dbModels.IntervalType, member string) (*dbModels.CandleModel, error) {
+
+	parts := strings.Split(member, ":")
+	if len(parts) != 7 {
+		return nil, errors.New("invalid member")
+	}
+
+	start, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]decimal.Decimal, 5)
+	for i := range values {
+		if values[i], err = decimal.NewFromString(parts[i+1]); err != nil {
+			return nil, err
+		}
+	}
+	revision, err := strconv.ParseUint(parts[6], 10, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dbModels.CandleModel{
+		ProductID:    productID,
+		IntervalType: intervalType,
+		Start:        time.Unix(start, 0),
+		Open:         values[0],
+		Close:        values[1],
+		High:         values[2],
+		Low:          values[3],
+		Volume:       values[4],
+		Revision:     uint32(revision),
+	}, nil
+}
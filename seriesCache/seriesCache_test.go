@@ -0,0 +1,188 @@
+package seriesCache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/paper-trade-chatbot/be-candle/dao/candleDao"
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	"github.com/paper-trade-chatbot/be-common/cache"
+	"github.com/shopspring/decimal"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	m := &dbModels.CandleModel{
+		ProductID:    7,
+		IntervalType: dbModels.IntervalType_5MI,
+		Start:        time.Unix(1_800_000_000, 0),
+		Open:         decimal.RequireFromString("1.000000000000000001"),
+		Close:        decimal.RequireFromString("2"),
+		High:         decimal.RequireFromString("3.5"),
+		Low:          decimal.RequireFromString("0.25"),
+		Volume:       decimal.RequireFromString("100"),
+		Revision:     3,
+	}
+
+	got, err := decode(m.ProductID, m.IntervalType, encode(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Start.Equal(m.Start) || !got.Open.Equal(m.Open) || !got.Close.Equal(m.Close) || !got.High.Equal(m.High) ||
+		!got.Low.Equal(m.Low) || !got.Volume.Equal(m.Volume) || got.Revision != m.Revision {
+		t.Fatalf("decode = %+v, want %+v", got, m)
+	}
+}
+
+func TestDecodeRejectsMalformedMembers(t *testing.T) {
+	for _, member := range []string{
+		"1800000000:1:2:3:0:100",   // no revision
+		"1800000000:1:2:3:0:100:x", // invalid revision
+		"x:1:2:3:0:100:0",
+		"1800000000:1:2:y:0:100:0",
+	} {
+		if _, err := decode(1, dbModels.IntervalType_1MI, member); err == nil {
+			t.Errorf("decode %s succeeded", member)
+		}
+	}
+}
+
+// startRedis points the cache at an in-process Redis.
+func startRedis(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	_, closeRedis := cache.SetRedisMock()
+	r, _ := cache.GetRedis()
+	r.Client = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(closeRedis)
+	return mr
+}
+
+// racingStore runs during before the first GetLatest returns, like a writer
+// storing candles while the series loads.
+type racingStore struct {
+	*candleDao.MemoryStore
+	during func()
+}
+
+func (s *racingStore) GetLatest(productID uint64, intervalType dbModels.IntervalType, n int) ([]dbModels.CandleModel, error) {
+	models, err := s.MemoryStore.GetLatest(productID, intervalType, n)
+	if s.during != nil {
+		s.during()
+		s.during = nil
+	}
+	return models, err
+}
+
+func minute(start time.Time, price int64) *dbModels.CandleModel {
+	p := decimal.NewFromInt(price)
+	return &dbModels.CandleModel{
+		ProductID:    1,
+		IntervalType: dbModels.IntervalType_1MI,
+		Start:        start,
+		Open:         p,
+		Close:        p,
+		High:         p,
+		Low:          p,
+		Volume:       decimal.NewFromInt(1),
+	}
+}
+
+func TestLoadLosesToNewerVersion(t *testing.T) {
+	base := time.Unix(1_800_000_000, 0)
+
+	for name, write := range map[string]func(c *SeriesCache, m *dbModels.CandleModel){
+		"Write": func(c *SeriesCache, m *dbModels.CandleModel) {
+			c.Write(context.Background(), []*dbModels.CandleModel{m})
+		},
+		"Invalidate": func(c *SeriesCache, m *dbModels.CandleModel) {
+			c.Invalidate(context.Background(), []*dbModels.CandleModel{m})
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			mr := startRedis(t)
+			c := New(10)
+			zsetKey, fromKey, _ := seriesKeys(1, dbModels.IntervalType_1MI)
+
+			store := &racingStore{MemoryStore: candleDao.NewMemoryStore()}
+			if _, err := store.News([]*dbModels.CandleModel{minute(base, 10)}); err != nil {
+				t.Fatal(err)
+			}
+			// a candle is stored after the load read the store
+			stored := minute(base.Add(time.Minute), 11)
+			store.during = func() {
+				if _, err := store.MemoryStore.News([]*dbModels.CandleModel{stored}); err != nil {
+					t.Fatal(err)
+				}
+				write(c, stored)
+			}
+
+			models, ok, err := c.Gets(ctx, store, 1, dbModels.IntervalType_1MI, base, base.Add(time.Hour))
+			if err != nil || !ok || len(models) != 1 {
+				t.Fatalf("Gets = %d candles, %v, %v, want what the store returned", len(models), ok, err)
+			}
+			// the stale candles are not cached, the next read loads again
+			if mr.Exists(fromKey) || mr.Exists(zsetKey) {
+				t.Fatal("stale load cached")
+			}
+
+			models, ok, err = c.Gets(ctx, store, 1, dbModels.IntervalType_1MI, base, base.Add(time.Hour))
+			if err != nil || !ok || len(models) != 2 {
+				t.Fatalf("Gets = %d candles, %v, %v, want 2", len(models), ok, err)
+			}
+			if !mr.Exists(fromKey) {
+				t.Fatal("series not cached")
+			}
+			if stats := c.Stats(); stats.Loads != 1 {
+				t.Fatalf("%d loads cached, want 1", stats.Loads)
+			}
+		})
+	}
+}
+
+func TestInvalidateBumpsVersion(t *testing.T) {
+	ctx := context.Background()
+	mr := startRedis(t)
+	c := New(10)
+	zsetKey, fromKey, versionKey := seriesKeys(1, dbModels.IntervalType_1MI)
+
+	base := time.Unix(1_800_000_000, 0)
+	store := candleDao.NewMemoryStore()
+	if _, err := store.News([]*dbModels.CandleModel{minute(base, 10)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := c.Gets(ctx, store, 1, dbModels.IntervalType_1MI, base, base); err != nil || !ok {
+		t.Fatalf("Gets = %v, %v", ok, err)
+	}
+	version, _ := mr.Get(versionKey)
+
+	c.Invalidate(ctx, []*dbModels.CandleModel{minute(base, 10)})
+
+	if mr.Exists(zsetKey) || mr.Exists(fromKey) {
+		t.Fatal("series kept")
+	}
+	bumped, err := mr.Get(versionKey)
+	if err != nil || bumped == version {
+		t.Fatalf("version %q after invalidate, was %q", bumped, version)
+	}
+	if ttl := mr.TTL(versionKey); ttl <= 0 {
+		t.Fatalf("version kept forever, ttl %v", ttl)
+	}
+}
+
+func TestGetsReportsRedisErrors(t *testing.T) {
+	ctx := context.Background()
+	mr := startRedis(t)
+	c := New(10)
+
+	base := time.Unix(1_800_000_000, 0)
+	store := candleDao.NewMemoryStore()
+	mr.SetError("LOADING Redis is loading the dataset in memory")
+
+	if _, ok, err := c.Gets(ctx, store, 1, dbModels.IntervalType_1MI, base, base); err == nil || ok {
+		t.Fatalf("Gets = %v, %v, want the redis error", ok, err)
+	}
+}
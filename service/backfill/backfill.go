@@ -0,0 +1,420 @@
+package backfill
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/paper-trade-chatbot/be-candle/aggregation"
+	"github.com/paper-trade-chatbot/be-candle/calendar"
+	"github.com/paper-trade-chatbot/be-candle/correction"
+	"github.com/paper-trade-chatbot/be-candle/dao/candleDao"
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	"github.com/paper-trade-chatbot/be-candle/seriesCache"
+	"github.com/paper-trade-chatbot/be-candle/service"
+	"github.com/paper-trade-chatbot/be-candle/service/volume"
+	common "github.com/paper-trade-chatbot/be-common"
+	"github.com/paper-trade-chatbot/be-common/cache"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/paper-trade-chatbot/be-common/pagination"
+	"github.com/paper-trade-chatbot/be-proto/product"
+	"github.com/paper-trade-chatbot/be-proto/quote"
+)
+
+// quotes are keyed by HHMMSS, so the quote service can only answer one day back
+const maxWindow = time.Hour * 24
+
+const (
+	// progressKey keeps the Progress of every product as JSON, by product id,
+	// so that every replica reports the backfills any of them runs
+	progressKey = "candle:backfill:progress"
+	progressTTL = time.Hour * 24 * 7
+	// a product pending or running without update for staleAfter was left by
+	// a replica which stopped, it may be backfilled again
+	staleAfter   = time.Minute * 5
+	claimRetries = 3
+)
+
+type State int
+
+const (
+	State_None State = iota
+	State_Pending
+	State_Running
+	State_Done
+	State_Failed
+)
+
+// Progress is the backfill report of one product.
+type Progress struct {
+	ProductID  uint64    `json:"productID"`
+	State      State     `json:"state"`
+	From       int64     `json:"from"`
+	To         int64     `json:"to"`
+	Missing    int       `json:"missing"`
+	Filled     int       `json:"filled"`
+	NoQuote    int       `json:"noQuote"`
+	Recomputed int       `json:"recomputed"` // aggregated candles stored or changed from the filled ones
+	Error      string    `json:"error,omitempty"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+type BackfillIntf interface {
+	Backfill(ctx context.Context, productIDs []uint64, from, to time.Time) error
+	GetProgress(ctx context.Context, productIDs []uint64) ([]*Progress, error)
+}
+
+type BackfillImpl struct {
+	store candleDao.CandleStore
+}
+
+func New(store candleDao.CandleStore) BackfillIntf {
+	return &BackfillImpl{
+		store: store,
+	}
+}
+
+// ValidateWindow checks that [from, to) can still be rebuilt from quote history.
+func ValidateWindow(from, to time.Time) error {
+	if !from.Before(to) {
+		return common.ErrInvalidParam
+	}
+	if to.After(time.Now().Truncate(time.Minute)) {
+		return common.ErrInvalidParam
+	}
+	if to.Sub(from) >= maxWindow {
+		return common.ErrInvalidParam
+	}
+	return nil
+}
+
+// Backfill rebuilds the missing in-session 1MI candles starting in [from, to) for the
+// given products, or for every enabled product when productIDs is empty.
+// Products already being backfilled are skipped, and rows that appeared in
+// the meantime are left untouched, so triggering it twice is harmless.
+// The closed aggregated candles built from the filled ones are recomputed.
+func (impl *BackfillImpl) Backfill(ctx context.Context, productIDs []uint64, from, to time.Time) error {
+
+	from = from.Truncate(time.Minute)
+	to = to.Truncate(time.Minute)
+	if err := ValidateWindow(from, to); err != nil {
+		logging.Error(ctx, "[Backfill] invalid window %v ~ %v", from, to)
+		return err
+	}
+
+	if len(productIDs) == 0 {
+		enabled, err := getEnabledProductIDs(ctx)
+		if err != nil {
+			return err
+		}
+		productIDs = enabled
+	}
+
+	queued, err := claim(ctx, productIDs, from, to)
+	if err != nil {
+		logging.Error(ctx, "[Backfill] claim error: %v", err)
+		return err
+	}
+
+	for _, id := range queued {
+		if err := impl.backfillProduct(ctx, id, from, to); err != nil {
+			logging.Error(ctx, "[Backfill] product [%d] error: %v", id, err)
+			update(ctx, id, func(p *Progress) {
+				p.State = State_Failed
+				p.Error = err.Error()
+			})
+			continue
+		}
+		update(ctx, id, func(p *Progress) {
+			p.State = State_Done
+		})
+	}
+
+	return nil
+}
+
+// GetProgress reports the given products, or every product ever backfilled
+// within progressTTL when productIDs is empty.
+func (impl *BackfillImpl) GetProgress(ctx context.Context, productIDs []uint64) ([]*Progress, error) {
+
+	r, _ := cache.GetRedis()
+
+	values := []interface{}{}
+	if len(productIDs) == 0 {
+		all, err := r.HGetAll(ctx, progressKey).Result()
+		if err != nil {
+			logging.Error(ctx, "[GetProgress] HGetAll err: %v", err)
+			return nil, err
+		}
+		for _, v := range all {
+			values = append(values, v)
+		}
+	} else {
+		fields := []string{}
+		for _, id := range productIDs {
+			fields = append(fields, strconv.FormatUint(id, 10))
+		}
+		var err error
+		if values, err = r.HMGet(ctx, progressKey, fields...).Result(); err != nil {
+			logging.Error(ctx, "[GetProgress] HMGet err: %v", err)
+			return nil, err
+		}
+	}
+
+	result := []*Progress{}
+	for _, v := range values {
+		if p := decodeProgress(v); p != nil {
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+// claim marks the products which are not pending or running elsewhere as
+// pending, returning them.
+func claim(ctx context.Context, productIDs []uint64, from, to time.Time) ([]uint64, error) {
+
+	r, _ := cache.GetRedis()
+
+	fields := []string{}
+	for _, id := range productIDs {
+		fields = append(fields, strconv.FormatUint(id, 10))
+	}
+
+	var queued []uint64
+	claimOnce := func(tx *redis.Tx) error {
+		values, err := tx.HMGet(ctx, progressKey, fields...).Result()
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		queued = []uint64{}
+		pending := map[string]interface{}{}
+		for i, id := range productIDs {
+			if p := decodeProgress(values[i]); p != nil && p.active(now) {
+				continue
+			}
+			encoded, _ := json.Marshal(&Progress{
+				ProductID: id,
+				State:     State_Pending,
+				From:      from.Unix(),
+				To:        to.Unix(),
+				UpdatedAt: now,
+			})
+			pending[fields[i]] = string(encoded)
+			queued = append(queued, id)
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, progressKey, pending)
+			pipe.Expire(ctx, progressKey, progressTTL)
+			return nil
+		})
+		return err
+	}
+
+	// another replica claiming meanwhile makes the transaction fail, retry against its claims
+	var err error
+	for attempt := 0; attempt < claimRetries; attempt++ {
+		if err = r.Watch(ctx, claimOnce, progressKey); !errors.Is(err, redis.TxFailedErr) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return queued, nil
+}
+
+// active reports whether p is being backfilled by some replica at now.
+func (p *Progress) active(now time.Time) bool {
+	return (p.State == State_Pending || p.State == State_Running) && now.Sub(p.UpdatedAt) < staleAfter
+}
+
+func decodeProgress(value interface{}) *Progress {
+	raw, ok := value.(string)
+	if !ok {
+		return nil
+	}
+	p := &Progress{}
+	if err := json.Unmarshal([]byte(raw), p); err != nil {
+		return nil
+	}
+	return p
+}
+
+func (impl *BackfillImpl) backfillProduct(ctx context.Context, productID uint64, from, to time.Time) error {
+
+	update(ctx, productID, func(p *Progress) {
+		p.State = State_Running
+	})
+
+	startTo := to.Add(-time.Second)
+	starts, err := impl.store.GetStarts(&candleDao.QueryModel{
+		ProductID:    productID,
+		IntervalType: dbModels.IntervalType_1MI,
+		StartFrom:    &from,
+		StartTo:      &startTo,
+	})
+	if err != nil {
+		return err
+	}
+
+	existing := map[int64]bool{}
+	for _, s := range starts {
+		existing[s.Unix()] = true
+	}
+
+	calendars, err := calendar.GetProductCalendars(ctx)
+	if err != nil {
+		return err
+	}
+	c := calendar.Of(calendars, productID)
+
+	missing := []time.Time{}
+	for m := from; m.Before(to); m = m.Add(time.Minute) {
+		if !existing[m.Unix()] && c.IsOpen(m) {
+			missing = append(missing, m)
+		}
+	}
+
+	update(ctx, productID, func(p *Progress) {
+		p.Missing = len(missing)
+	})
+	if len(missing) == 0 {
+		return nil
+	}
+
+	getFrom := from.Format("150405")
+	getTo := to.Format("150405")
+	quoteData, err := service.Impl.QuoteIntf.GetQuotes(ctx, &quote.GetQuotesReq{
+		ProductIDs: []int64{int64(productID)},
+		Flag:       quote.GetQuotesReq_GetFlag_Quote,
+		GetFrom:    &getFrom,
+		GetTo:      &getTo,
+	})
+	if err != nil {
+		return err
+	}
+
+	ticks := []aggregation.Tick{}
+	for _, q := range quoteData.GetQuotes() {
+		if uint64(q.GetProductID()) != productID {
+			continue
+		}
+		parsed, invalid := aggregation.ParseQuoteTicks(q.GetQuotes(), to)
+		if len(invalid) > 0 {
+			logging.Warn(ctx, "[Backfill] product [%d] parse quote error: %v", productID, invalid)
+		}
+		ticks = append(ticks, parsed...)
+	}
+
+	models := []*dbModels.CandleModel{}
+	noQuote := 0
+	for _, m := range missing {
+		model := aggregation.FromTicks(productID, m, ticks, nil)
+		if model == nil {
+			noQuote++
+			continue
+		}
+		volumes, err := volume.GetVolume().GetVolumes(ctx, m)
+		if err != nil {
+			return err
+		}
+		model.Volume = volumes[productID]
+		models = append(models, model)
+	}
+
+	if len(models) == 0 {
+		update(ctx, productID, func(p *Progress) {
+			p.NoQuote = noQuote
+		})
+		return nil
+	}
+
+	result, err := impl.store.Upserts(models, candleDao.ConflictMode_Skip)
+	if err != nil {
+		return err
+	}
+	seriesCache.GetCache().Stored(ctx, models, candleDao.ConflictMode_Skip, result)
+
+	update(ctx, productID, func(p *Progress) {
+		p.Filled = result.Inserted
+		p.NoQuote = noQuote
+	})
+
+	// rows stored meanwhile by the generator were skipped, recomputing them is harmless
+	recomputed, err := correction.Recompute(ctx, impl.store, models, time.Now())
+	if err != nil {
+		return err
+	}
+
+	update(ctx, productID, func(p *Progress) {
+		p.Recomputed = len(recomputed)
+	})
+
+	return nil
+}
+
+// update applies f to the stored progress of a product. Progress is only
+// reported, a failure to store it does not stop the backfill.
+func update(ctx context.Context, productID uint64, f func(p *Progress)) {
+
+	r, _ := cache.GetRedis()
+	field := strconv.FormatUint(productID, 10)
+
+	raw, err := r.HGet(ctx, progressKey, field).Result()
+	if err != nil {
+		logging.Warn(ctx, "[Backfill] get progress of [%d] err: %v", productID, err)
+		return
+	}
+	p := decodeProgress(raw)
+	if p == nil {
+		return
+	}
+
+	f(p)
+	p.UpdatedAt = time.Now()
+	encoded, _ := json.Marshal(p)
+	if err := r.HSet(ctx, progressKey, field, string(encoded)).Err(); err != nil {
+		logging.Warn(ctx, "[Backfill] set progress of [%d] err: %v", productID, err)
+	}
+}
+
+func getEnabledProductIDs(ctx context.Context) ([]uint64, error) {
+
+	enabled := product.Status_Status_Enabled
+	productRes, err := pagination.IteratePageGRPC[*product.GetProductsReq, *product.GetProductsRes](
+		&product.GetProductsReq{
+			Status:     &enabled,
+			Pagination: pagination.NewPagination(3000),
+		},
+		func(req *product.GetProductsReq) (*product.GetProductsRes, error) {
+			productData, err := service.Impl.ProductIntf.GetProducts(ctx, req)
+			if err != nil {
+				logging.Error(ctx, "[Backfill] GetProducts err: %v", err)
+				return nil, err
+			}
+			return productData, nil
+		},
+	)
+	if err != nil {
+		logging.Error(ctx, "[Backfill] IteratePage err: %v", err)
+		return nil, err
+	}
+
+	productIDs := []uint64{}
+	for _, r := range productRes {
+		for _, p := range r.Product {
+			productIDs = append(productIDs, uint64(p.Id))
+		}
+	}
+	return productIDs, nil
+}
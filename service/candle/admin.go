@@ -0,0 +1,272 @@
+package candle
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-candle/correction"
+	"github.com/paper-trade-chatbot/be-candle/dao/candleDao"
+	"github.com/paper-trade-chatbot/be-candle/hub"
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	"github.com/paper-trade-chatbot/be-candle/seriesCache"
+	common "github.com/paper-trade-chatbot/be-common"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/paper-trade-chatbot/be-proto/candle"
+	"google.golang.org/grpc"
+)
+
+// be-proto has no rpc to change stored candles yet, so CandleAdminService is
+// described here by hand on top of the existing candle messages:
+//
+//	rpc ModifyCandles(CreateCandlesReq) returns (CreateCandlesRes);
+//	rpc DeleteCandles(GetCandlesReq) returns (CreateCandlesRes);
+type CandleAdminServiceServer interface {
+	ModifyCandles(context.Context, *candle.CreateCandlesReq) (*candle.CreateCandlesRes, error)
+	DeleteCandles(context.Context, *candle.GetCandlesReq) (*candle.CreateCandlesRes, error)
+}
+
+func _CandleAdminService_ModifyCandles_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(candle.CreateCandlesReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CandleAdminServiceServer).ModifyCandles(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/candle.CandleAdminService/ModifyCandles",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CandleAdminServiceServer).ModifyCandles(ctx, req.(*candle.CreateCandlesReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CandleAdminService_DeleteCandles_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(candle.GetCandlesReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CandleAdminServiceServer).DeleteCandles(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/candle.CandleAdminService/DeleteCandles",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CandleAdminServiceServer).DeleteCandles(ctx, req.(*candle.GetCandlesReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var CandleAdminService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "candle.CandleAdminService",
+	HandlerType: (*CandleAdminServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ModifyCandles",
+			Handler:    _CandleAdminService_ModifyCandles_Handler,
+		},
+		{
+			MethodName: "DeleteCandles",
+			Handler:    _CandleAdminService_DeleteCandles_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "candle/candle.proto",
+}
+
+func RegisterCandleAdminServiceServer(s grpc.ServiceRegistrar, srv CandleAdminServiceServer) {
+	s.RegisterService(&CandleAdminService_ServiceDesc, srv)
+}
+
+// ModifyCandles replaces the values of stored candles, addressed by product,
+// interval and start, and recomputes the closed aggregated candles built from
+// them. Candles are validated like in CreateCandles, x-candle-validation
+// applies to candles not stored as well. Every change is audited.
+func (impl *CandleImpl) ModifyCandles(ctx context.Context, in *candle.CreateCandlesReq) (*candle.CreateCandlesRes, error) {
+
+	validation := getMetadata(ctx, MetadataKeyValidation)
+	if validation != "" && validation != validationStrict && validation != validationPartial {
+		logging.Error(ctx, "[ModifyCandles] invalid validation: %s", validation)
+		return nil, common.ErrInvalidParam
+	}
+	partial := validation == validationPartial
+
+	v := &violations{}
+	rows, err := validateCandleCharts(ctx, in.GetCandleCharts(), nil, v)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPrecision(ctx, impl.store, rows, v); err != nil {
+		return nil, err
+	}
+	if v.count > 0 && !partial {
+		logging.Warn(ctx, "[ModifyCandles] %d invalid candle fields", v.count)
+		return nil, v.err()
+	}
+
+	models := []*dbModels.CandleModel{}
+	paths := map[*dbModels.CandleModel]string{}
+	for _, r := range rows {
+		if !r.invalid {
+			models = append(models, r.model)
+			paths[r.model] = r.path
+		}
+	}
+
+	requestID, account := auditIdentity(ctx)
+	var recomputed []*candleDao.Change
+	modified := []*dbModels.CandleModel{}
+	rejected := len(rows) - len(models)
+
+	if len(models) > 0 {
+		err = impl.store.Transaction(func(tx candleDao.CandleStore) error {
+
+			changes, missing, err := tx.Modifies(models)
+			if err != nil {
+				logging.Error(ctx, "[ModifyCandles] Modifies error: %v", err)
+				return err
+			}
+			for _, m := range missing {
+				v.add(paths[m]+".start", "no such candle")
+			}
+			if len(missing) > 0 && !partial {
+				return v.err()
+			}
+			rejected += len(missing)
+
+			if err := audit(ctx, tx, dbModels.AuditAction_Modify, changes, requestID, account); err != nil {
+				return err
+			}
+
+			for _, c := range changes {
+				modified = append(modified, c.New)
+			}
+			recomputed, err = recomputeDependents(ctx, tx, modified, requestID, account)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if v.count > 0 {
+		logging.Warn(ctx, "[ModifyCandles] %d invalid candle fields, %d rows rejected", v.count, rejected)
+		setViolationsHeader(ctx, v, rejected)
+	}
+
+	seriesCache.GetCache().Invalidate(ctx, modified)
+	if len(modified) > 0 {
+		hub.GetHub().Publish(modified, true)
+	}
+	correction.Recomputed(ctx, recomputed)
+	setHeader(ctx, MetadataKeyRecomputed, strconv.Itoa(len(recomputed)))
+
+	return &candle.CreateCandlesRes{
+		TotalSuccess: int32(len(modified)),
+	}, nil
+}
+
+// DeleteCandles removes the candles of the products and interval type of in
+// starting within [StartTime, EndTime], and recomputes the closed aggregated
+// candles built from them. Every deleted candle is audited.
+func (impl *CandleImpl) DeleteCandles(ctx context.Context, in *candle.GetCandlesReq) (*candle.CreateCandlesRes, error) {
+
+	intervalType := dbModels.IntervalType(in.GetIntervalType())
+	if !intervalType.Valid() || len(in.GetProductID()) == 0 || in.GetStartTime() > in.GetEndTime() {
+		logging.Error(ctx, "[DeleteCandles] invalid param: %v", in)
+		return nil, common.ErrInvalidParam
+	}
+
+	productIDIn := []uint64{}
+	for _, p := range in.GetProductID() {
+		productIDIn = append(productIDIn, uint64(p))
+	}
+	startFrom := time.Unix(in.GetStartTime(), 0)
+	startTo := time.Unix(in.GetEndTime(), 0)
+
+	requestID, account := auditIdentity(ctx)
+
+	var deleted []*dbModels.CandleModel
+	var recomputed []*candleDao.Change
+	err := impl.store.Transaction(func(tx candleDao.CandleStore) error {
+
+		var err error
+		deleted, err = tx.Deletes(&candleDao.QueryModel{
+			IntervalType: intervalType,
+			ProductIDIn:  productIDIn,
+			StartFrom:    &startFrom,
+			StartTo:      &startTo,
+		})
+		if err != nil {
+			logging.Error(ctx, "[DeleteCandles] Deletes error: %v", err)
+			return err
+		}
+
+		changes := []*candleDao.Change{}
+		for _, d := range deleted {
+			changes = append(changes, &candleDao.Change{Old: d})
+		}
+		if err := audit(ctx, tx, dbModels.AuditAction_Delete, changes, requestID, account); err != nil {
+			return err
+		}
+
+		recomputed, err = recomputeDependents(ctx, tx, deleted, requestID, account)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	seriesCache.GetCache().Invalidate(ctx, deleted)
+	correction.Recomputed(ctx, recomputed)
+	setHeader(ctx, MetadataKeyRecomputed, strconv.Itoa(len(recomputed)))
+
+	return &candle.CreateCandlesRes{
+		TotalSuccess: int32(len(deleted)),
+	}, nil
+}
+
+// recomputeDependents recomputes through tx the aggregated candles built from
+// changed and audits their changes, so that both commit or roll back with the
+// edit. The caller passes the changes to correction.Recomputed once committed.
+func recomputeDependents(ctx context.Context, tx candleDao.CandleStore, changed []*dbModels.CandleModel, requestID, account string) ([]*candleDao.Change, error) {
+
+	changes, err := correction.RecomputeInTransaction(ctx, tx, changed, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err := audit(ctx, tx, dbModels.AuditAction_Recompute, changes, requestID, account); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+func audit(ctx context.Context, store candleDao.CandleStore, action dbModels.AuditAction, changes []*candleDao.Change, requestID, account string) error {
+
+	audits := []*dbModels.CandleAuditModel{}
+	for _, c := range changes {
+		audits = append(audits, dbModels.NewCandleAuditModel(action, c.Old, c.New, requestID, account))
+	}
+	if err := store.NewAudits(audits); err != nil {
+		logging.Error(ctx, "[audit] NewAudits error: %v", err)
+		return err
+	}
+	return nil
+}
+
+// auditIdentity returns the request id and account of the caller, from the
+// context as set by the HTTP middleware or else from the request metadata.
+func auditIdentity(ctx context.Context) (requestID, account string) {
+	requestID, _ = ctx.Value(logging.ContextKeyRequestId).(string)
+	if requestID == "" {
+		requestID = getRawMetadata(ctx, logging.ContextKeyRequestId)
+	}
+	account, _ = ctx.Value(logging.ContextKeyAccount).(string)
+	if account == "" {
+		account = getRawMetadata(ctx, logging.ContextKeyAccount)
+	}
+	return requestID, account
+}
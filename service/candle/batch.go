@@ -0,0 +1,151 @@
+package candle
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-candle/dao/candleDao"
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	common "github.com/paper-trade-chatbot/be-common"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/paper-trade-chatbot/be-proto/candle"
+)
+
+const (
+	maxBatchEntries = 100
+	batchWorkers    = 8
+)
+
+// GetCandlesBatchReqEntry asks for either the latest Count candles, or the
+// first Limit candles starting within [StartTime, EndTime].
+type GetCandlesBatchReqEntry struct {
+	ProductID    int64                 `json:"productID"`
+	IntervalType dbModels.IntervalType `json:"intervalType"`
+	StartTime    int64                 `json:"startTime"`
+	EndTime      int64                 `json:"endTime"`
+	Limit        int                   `json:"limit"`
+	Count        int                   `json:"count"`
+}
+
+type GetCandlesBatchReq struct {
+	Entries []*GetCandlesBatchReqEntry `json:"entries"`
+}
+
+// GetCandlesBatchResElement holds the candles of one entry in ascending start
+// order, Truncated if the window had more than Limit candles.
+type GetCandlesBatchResElement struct {
+	ProductID    int64                          `json:"productID"`
+	IntervalType dbModels.IntervalType          `json:"intervalType"`
+	Candles      []*candle.GetCandlesResElement `json:"candles"`
+	Truncated    bool                           `json:"truncated"`
+}
+
+// GetCandlesBatchRes holds one element per entry, in request order.
+type GetCandlesBatchRes struct {
+	Results []*GetCandlesBatchResElement `json:"results"`
+}
+
+// GetCandlesBatch runs every entry on its own, batchWorkers at a time.
+func (impl *CandleImpl) GetCandlesBatch(ctx context.Context, in *GetCandlesBatchReq) (*GetCandlesBatchRes, error) {
+
+	if len(in.Entries) == 0 || len(in.Entries) > maxBatchEntries {
+		logging.Error(ctx, "[GetCandlesBatch] invalid entry count: %d", len(in.Entries))
+		return nil, common.ErrInvalidParam
+	}
+	for _, e := range in.Entries {
+		if !validBatchEntry(e) {
+			logging.Error(ctx, "[GetCandlesBatch] invalid entry: %#v", e)
+			return nil, common.ErrInvalidParam
+		}
+	}
+
+	results := make([]*GetCandlesBatchResElement, len(in.Entries))
+	errs := make([]error, len(in.Entries))
+
+	workers := batchWorkers
+	if len(in.Entries) < workers {
+		workers = len(in.Entries)
+	}
+
+	jobs := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i], errs[i] = getBatchEntry(impl.store, in.Entries[i])
+			}
+		}()
+	}
+	for i := range in.Entries {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			logging.Error(ctx, "[GetCandlesBatch] entry %d error: %v", i, err)
+			return nil, err
+		}
+	}
+
+	return &GetCandlesBatchRes{
+		Results: results,
+	}, nil
+}
+
+func validBatchEntry(e *GetCandlesBatchReqEntry) bool {
+	if e == nil || e.ProductID <= 0 || !e.IntervalType.Valid() {
+		return false
+	}
+	if e.Count > 0 {
+		return e.Count <= maxLatestCount && e.Limit == 0 && e.StartTime == 0 && e.EndTime == 0
+	}
+	return e.Limit > 0 && e.Limit <= maxLatestCount && e.StartTime <= e.EndTime
+}
+
+func getBatchEntry(store candleDao.CandleStore, e *GetCandlesBatchReqEntry) (*GetCandlesBatchResElement, error) {
+
+	var models []dbModels.CandleModel
+	var err error
+	truncated := false
+
+	if e.Count > 0 {
+		models, err = store.GetLatest(uint64(e.ProductID), e.IntervalType, e.Count)
+	} else {
+		startTime := time.Unix(e.StartTime, 0)
+		endTime := time.Unix(e.EndTime, 0)
+		models, err = store.Gets(&candleDao.QueryModel{
+			ProductID:    uint64(e.ProductID),
+			IntervalType: e.IntervalType,
+			StartFrom:    &startTime,
+			StartTo:      &endTime,
+			OrderBy: []*candleDao.Order{
+				{Column: candleDao.OrderColumn_Start, Direction: candleDao.OrderDirection_ASC},
+			},
+			Limit: e.Limit + 1,
+		})
+		if len(models) > e.Limit {
+			models = models[:e.Limit]
+			truncated = true
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	candles := []*candle.GetCandlesResElement{}
+	for i := range models {
+		candles = append(candles, newCandlesResElement(&models[i]))
+	}
+
+	return &GetCandlesBatchResElement{
+		ProductID:    e.ProductID,
+		IntervalType: e.IntervalType,
+		Candles:      candles,
+		Truncated:    truncated,
+	}, nil
+}
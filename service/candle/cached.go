@@ -0,0 +1,59 @@
+package candle
+
+import (
+	"context"
+	"sort"
+
+	"github.com/paper-trade-chatbot/be-candle/dao/candleDao"
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	"github.com/paper-trade-chatbot/be-candle/seriesCache"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/paper-trade-chatbot/be-common/pagination"
+	"github.com/paper-trade-chatbot/be-proto/general"
+)
+
+// getCachedCandles serves the page from the series cache if the window of every
+// product is cached, in the order candleDao.GetsWithPagination would return it.
+// Cache errors are misses, so the caller falls back to the store.
+func getCachedCandles(ctx context.Context, store candleDao.CandleStore, query *candleDao.QueryModel, paginate *general.Pagination) ([]dbModels.CandleModel, *general.PaginationInfo, bool, error) {
+
+	if len(query.ProductIDIn) == 0 || !query.IntervalType.Valid() || paginate == nil || paginate.PageSize <= 0 {
+		return nil, nil, false, nil
+	}
+
+	rows := []dbModels.CandleModel{}
+	seen := map[uint64]bool{}
+	for _, productID := range query.ProductIDIn {
+		if seen[productID] {
+			continue
+		}
+		seen[productID] = true
+
+		models, ok, err := seriesCache.GetCache().Gets(ctx, store, productID, query.IntervalType, *query.StartFrom, *query.StartTo)
+		if err != nil {
+			// the store still answers when Redis does not
+			logging.Warn(ctx, "[getCachedCandles] series cache err, reading the store: %v", err)
+			return nil, nil, false, nil
+		}
+		if !ok {
+			return nil, nil, false, nil
+		}
+		rows = append(rows, models...)
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		return lessByOrders(&rows[i], &rows[j], query.OrderBy)
+	})
+
+	offset, limit := pagination.GetOffsetAndLimit(paginate)
+	paginationInfo := pagination.SetPaginationDto(paginate.Page, paginate.PageSize, int32(len(rows)), int32(offset))
+
+	if offset >= len(rows) {
+		return []dbModels.CandleModel{}, paginationInfo, true, nil
+	}
+	end := offset + limit
+	if end > len(rows) {
+		end = len(rows)
+	}
+	return rows[offset:end], paginationInfo, true, nil
+}
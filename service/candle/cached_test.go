@@ -0,0 +1,65 @@
+package candle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/paper-trade-chatbot/be-candle/dao/candleDao"
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	"github.com/paper-trade-chatbot/be-candle/seriesCache"
+	"github.com/paper-trade-chatbot/be-common/cache"
+	"github.com/paper-trade-chatbot/be-proto/general"
+	"github.com/shopspring/decimal"
+)
+
+// TestCacheErrorFallsBackToStore takes Redis down: the cache reports a miss
+// instead of failing the request, which the store then answers.
+func TestCacheErrorFallsBackToStore(t *testing.T) {
+	t.Setenv("CANDLE_CACHE_SIZE", "10")
+	ctx := context.Background()
+
+	mr := miniredis.RunT(t)
+	_, closeRedis := cache.SetRedisMock()
+	t.Cleanup(closeRedis)
+	r, _ := cache.GetRedis()
+	r.Client = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	seriesCache.Initialize(ctx)
+
+	base := time.Unix(1_800_000_000, 0)
+	price := decimal.NewFromInt(10)
+	store := candleDao.NewMemoryStore()
+	if _, err := store.News([]*dbModels.CandleModel{{
+		ProductID: 1, IntervalType: dbModels.IntervalType_1MI, Start: base,
+		Open: price, Close: price, High: price, Low: price, Volume: price,
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	to := base.Add(time.Hour)
+	query := &candleDao.QueryModel{
+		IntervalType: dbModels.IntervalType_1MI,
+		ProductIDIn:  []uint64{1},
+		StartFrom:    &base,
+		StartTo:      &to,
+	}
+	page := &general.Pagination{Page: 1, PageSize: 10}
+
+	mr.SetError("LOADING Redis is loading the dataset in memory")
+	if models, _, cached, err := getCachedCandles(ctx, store, query, page); err != nil || cached || models != nil {
+		t.Fatalf("getCachedCandles = %v, %v, %v while Redis fails, want a miss", models, cached, err)
+	}
+	models, _, err := store.GetsWithPagination(query, page)
+	if err != nil || len(models) != 1 {
+		t.Fatalf("store = %v, %v", models, err)
+	}
+
+	// once Redis is back the series is loaded and served from the cache
+	mr.SetError("")
+	models, info, cached, err := getCachedCandles(ctx, store, query, page)
+	if err != nil || !cached || len(models) != 1 || info.TotalRows != 1 {
+		t.Fatalf("getCachedCandles = %v, %v, %v, %v", models, info, cached, err)
+	}
+}
@@ -2,36 +2,65 @@ package candle
 
 import (
 	"context"
+	"strconv"
+	"strings"
 	"time"
 
 	mapset "github.com/deckarep/golang-set/v2"
 	"github.com/paper-trade-chatbot/be-candle/dao/candleDao"
 	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	"github.com/paper-trade-chatbot/be-candle/seriesCache"
 	"github.com/paper-trade-chatbot/be-candle/service"
 	common "github.com/paper-trade-chatbot/be-common"
-	"github.com/paper-trade-chatbot/be-common/database"
 	"github.com/paper-trade-chatbot/be-common/logging"
 	"github.com/paper-trade-chatbot/be-common/pagination"
 	"github.com/paper-trade-chatbot/be-proto/candle"
+	"github.com/paper-trade-chatbot/be-proto/general"
 	"github.com/paper-trade-chatbot/be-proto/product"
-	"github.com/shopspring/decimal"
 )
 
 type CandleIntf interface {
 	CreateCandles(ctx context.Context, in *candle.CreateCandlesReq) (*candle.CreateCandlesRes, error)
 	GetCandles(ctx context.Context, in *candle.GetCandlesReq) (*candle.GetCandlesRes, error)
+	StreamCandles(in *candle.GetCandlesReq, stream CandleStreamService_StreamCandlesServer) error
+	GetLatestCandles(ctx context.Context, in *GetLatestCandlesReq) (*GetLatestCandlesRes, error)
+	GetCandlesBatch(ctx context.Context, in *GetCandlesBatchReq) (*GetCandlesBatchRes, error)
+	ModifyCandles(ctx context.Context, in *candle.CreateCandlesReq) (*candle.CreateCandlesRes, error)
+	DeleteCandles(ctx context.Context, in *candle.GetCandlesReq) (*candle.CreateCandlesRes, error)
 }
 
 type CandleImpl struct {
 	CandleClient candle.CandleServiceClient
+	store        candleDao.CandleStore
 }
 
-func New() CandleIntf {
-	return &CandleImpl{}
+func New(store candleDao.CandleStore) CandleIntf {
+	return &CandleImpl{
+		store: store,
+	}
 }
 
+// CreateCandles fails on an existing (product, interval, start) unless another
+// conflict mode is given in the x-candle-conflict-mode metadata.
+// Every candle stick is validated first. By default an invalid one rejects
+// the batch with InvalidArgument and a BadRequest detail per violation; with
+// x-candle-validation: partial the valid rows are stored and the violations
+// are returned in the x-candle-violations-bin header instead.
 func (impl *CandleImpl) CreateCandles(ctx context.Context, in *candle.CreateCandlesReq) (*candle.CreateCandlesRes, error) {
 
+	mode, err := conflictModeFromContext(ctx)
+	if err != nil {
+		logging.Error(ctx, "[CreateCandles] invalid conflict mode: %s", getMetadata(ctx, MetadataKeyConflictMode))
+		return nil, err
+	}
+
+	validation := getMetadata(ctx, MetadataKeyValidation)
+	if validation != "" && validation != validationStrict && validation != validationPartial {
+		logging.Error(ctx, "[CreateCandles] invalid validation: %s", validation)
+		return nil, common.ErrInvalidParam
+	}
+	partial := validation == validationPartial
+
 	productIDSet := mapset.NewSet[int64]()
 
 	for _, c := range in.GetCandleCharts() {
@@ -62,50 +91,65 @@ func (impl *CandleImpl) CreateCandles(ctx context.Context, in *candle.CreateCand
 			productIDSet.Remove(p.Id)
 		}
 	}
-	if productIDSet.Cardinality() > 0 {
+	if productIDSet.Cardinality() > 0 && !partial {
 		logging.Error(ctx, "[CreateCandles] no such product: %#q", productIDSet.ToSlice())
 		return nil, common.ErrNoSuchProduct
 	}
+	unknown := map[int64]bool{}
+	for _, id := range productIDSet.ToSlice() {
+		unknown[id] = true
+	}
+
+	v := &violations{}
+	rows, err := validateCandleCharts(ctx, in.GetCandleCharts(), unknown, v)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPrecision(ctx, impl.store, rows, v); err != nil {
+		return nil, err
+	}
+
+	if v.count > 0 && !partial {
+		logging.Warn(ctx, "[CreateCandles] %d invalid candle fields", v.count)
+		return nil, v.err()
+	}
 
 	models := []*dbModels.CandleModel{}
-	for _, cc := range in.GetCandleCharts() {
-		for _, s := range cc.GetCandleSticks() {
-
-			open, _ := decimal.NewFromString(s.GetOpen())
-			close, _ := decimal.NewFromString(s.GetClose())
-			high, _ := decimal.NewFromString(s.GetHigh())
-			low, _ := decimal.NewFromString(s.GetLow())
-			volume, _ := decimal.NewFromString(s.GetVolume())
-
-			model := &dbModels.CandleModel{
-				ProductID:    uint64(cc.GetProductID()),
-				IntervalType: dbModels.IntervalType(cc.GetIntervalType()),
-				Start:        time.Unix(s.GetStart(), 0),
-				Open:         open,
-				Close:        close,
-				High:         high,
-				Low:          low,
-				Volume:       volume,
-			}
-			models = append(models, model)
+	for _, r := range rows {
+		if !r.invalid {
+			models = append(models, r.model)
 		}
-
+	}
+	if v.count > 0 {
+		logging.Warn(ctx, "[CreateCandles] %d invalid candle fields, %d rows rejected", v.count, len(rows)-len(models))
+		setViolationsHeader(ctx, v, len(rows)-len(models))
+	}
+	if len(models) == 0 {
+		setUpsertHeader(ctx, &candleDao.UpsertResult{})
+		return &candle.CreateCandlesRes{}, nil
 	}
 
-	db := database.GetDB()
-	count, err := candleDao.News(db, models)
+	result, err := impl.store.Upserts(models, mode)
 	if err != nil {
-		logging.Error(ctx, "[CreateCandles] candleDao.News error: %v", err)
+		logging.Error(ctx, "[CreateCandles] Upserts error: %v", err)
 		return nil, err
 	}
+	setUpsertHeader(ctx, result)
+	seriesCache.GetCache().Stored(ctx, models, mode, result)
 
 	return &candle.CreateCandlesRes{
-		TotalSuccess: int32(count),
+		TotalSuccess: int32(result.Inserted + result.Updated),
 	}, nil
 }
 
+// GetCandles can append the forming candle (x-candle-include-partial) and fill
+// gaps (x-candle-fill-mode: carry-forward or null), see metadata.go. Day and
+// longer candles report their alignment in x-candle-anchor.
+// With x-candle-pagination: keyset pages follow x-candle-cursor instead of the
+// page number, the cursor of the next page is returned in x-candle-next-cursor.
+// Candles amended after they were finalized are listed with their revision in
+// x-candle-revisions.
 func (impl *CandleImpl) GetCandles(ctx context.Context, in *candle.GetCandlesReq) (*candle.GetCandlesRes, error) {
-	db := database.GetDB()
 
 	startTime := time.Unix(in.StartTime, 0)
 	endTime := time.Unix(in.EndTime, 0)
@@ -130,35 +174,106 @@ func (impl *CandleImpl) GetCandles(ctx context.Context, in *candle.GetCandlesReq
 		OrderBy:      orders,
 	}
 
-	models, paginationInfo, err := candleDao.GetsWithPagination(db, queryModel, in.Pagination)
-	if err != nil {
+	fillMode, ok := fillModes[getMetadata(ctx, MetadataKeyFillMode)]
+	if !ok || (fillMode != FillMode_None && !queryModel.IntervalType.Valid()) {
+		logging.Error(ctx, "[GetCandles] invalid fill mode: %s", getMetadata(ctx, MetadataKeyFillMode))
+		return nil, common.ErrInvalidParam
+	}
+
+	if err := setAnchorHeader(ctx, queryModel.IntervalType, productIDIn); err != nil {
 		return nil, err
 	}
 
+	var models []dbModels.CandleModel
+	var paginationInfo *general.PaginationInfo
+	var isFirstPage, isLastPage bool
+	var err error
+
+	switch getMetadata(ctx, MetadataKeyPagination) {
+	case "", paginationOffset:
+		var cached bool
+		models, paginationInfo, cached, err = getCachedCandles(ctx, impl.store, queryModel, in.Pagination)
+		if err != nil {
+			return nil, err
+		}
+		if !cached {
+			models, paginationInfo, err = impl.store.GetsWithPagination(queryModel, in.Pagination)
+			if err != nil {
+				return nil, err
+			}
+		}
+		isFirstPage = paginationInfo == nil || paginationInfo.CurrentPage <= 1
+		isLastPage = paginationInfo == nil || paginationInfo.CurrentPage >= paginationInfo.TotalPages
+
+	case paginationKeyset:
+		pageSize := in.GetPagination().GetPageSize()
+		if pageSize <= 0 {
+			logging.Error(ctx, "[GetCandles] invalid page size: %d", pageSize)
+			return nil, common.ErrInvalidParam
+		}
+		cursor, err := cursorFromContext(ctx)
+		if err != nil {
+			logging.Error(ctx, "[GetCandles] invalid cursor: %s", getRawMetadata(ctx, MetadataKeyCursor))
+			return nil, err
+		}
+		var next *candleDao.Cursor
+		models, next, err = impl.store.GetsByKeyset(queryModel, cursor, int(pageSize))
+		if err != nil {
+			return nil, err
+		}
+		setNextCursorHeader(ctx, next)
+		paginationInfo = &general.PaginationInfo{PageSize: pageSize}
+		isFirstPage = cursor == nil
+		isLastPage = next == nil
+
+	default:
+		logging.Error(ctx, "[GetCandles] invalid pagination: %s", getMetadata(ctx, MetadataKeyPagination))
+		return nil, common.ErrInvalidParam
+	}
+
 	candles := []*candle.GetCandlesResElement{}
+	revisions := map[int]uint32{}
+	if fillMode == FillMode_None {
+		for i := range models {
+			if models[i].Revision > 0 {
+				revisions[len(candles)] = models[i].Revision
+			}
+			candles = append(candles, newCandlesResElement(&models[i]))
+		}
+	} else {
+		filled, err := fillGaps(ctx, impl.store, models, fillMode, queryModel.IntervalType, startTime, endTime, productIDIn, isFirstPage, orders)
+		if err != nil {
+			return nil, err
+		}
 
-	if len(models) == 0 {
-		return &candle.GetCandlesRes{
-			Candles:        candles,
-			PaginationInfo: paginationInfo,
-		}, nil
-	}
-
-	for _, m := range models {
-
-		c := &candle.GetCandlesResElement{
-			ProductID:    int64(m.ProductID),
-			IntervalType: candle.IntervalType(m.IntervalType),
-			CandleStick: &candle.CandleStick{
-				Start:  m.Start.Unix(),
-				Open:   m.Open.String(),
-				Close:  m.Close.String(),
-				High:   m.High.String(),
-				Low:    m.Low.String(),
-				Volume: m.Volume.String(),
-			},
+		synthetic := []string{}
+		for i, f := range filled {
+			element := newCandlesResElement(&f.Model)
+			if f.Null {
+				element.CandleStick = &candle.CandleStick{Start: f.Model.Start.Unix()}
+			}
+			if f.Synthetic {
+				synthetic = append(synthetic, strconv.Itoa(i))
+			}
+			if f.Model.Revision > 0 && !f.Synthetic {
+				revisions[len(candles)] = f.Model.Revision
+			}
+			candles = append(candles, element)
 		}
-		candles = append(candles, c)
+		setHeader(ctx, MetadataKeySynthetic, strings.Join(synthetic, ","))
+	}
+	setRevisionsHeader(ctx, revisions)
+
+	// the forming candle is appended after the last page, flagged by its count in the header
+	if getMetadata(ctx, MetadataKeyIncludePartial) == "true" && isLastPage {
+		partials, err := getPartialCandles(ctx, impl.store, productIDIn, queryModel.IntervalType, time.Now().UTC(), startTime, endTime)
+		if err != nil {
+			return nil, err
+		}
+		for i := range partials {
+			candles = append(candles, newCandlesResElement(&partials[i]))
+		}
+		setHeader(ctx, MetadataKeyPartialCount, strconv.Itoa(len(partials)))
 	}
 
 	return &candle.GetCandlesRes{
@@ -166,3 +281,18 @@ func (impl *CandleImpl) GetCandles(ctx context.Context, in *candle.GetCandlesReq
 		PaginationInfo: paginationInfo,
 	}, nil
 }
+
+func newCandlesResElement(m *dbModels.CandleModel) *candle.GetCandlesResElement {
+	return &candle.GetCandlesResElement{
+		ProductID:    int64(m.ProductID),
+		IntervalType: candle.IntervalType(m.IntervalType),
+		CandleStick: &candle.CandleStick{
+			Start:  m.Start.Unix(),
+			Open:   m.Open.String(),
+			Close:  m.Close.String(),
+			High:   m.High.String(),
+			Low:    m.Low.String(),
+			Volume: m.Volume.String(),
+		},
+	}
+}
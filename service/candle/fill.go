@@ -0,0 +1,260 @@
+package candle
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-candle/calendar"
+	"github.com/paper-trade-chatbot/be-candle/dao/candleDao"
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	common "github.com/paper-trade-chatbot/be-common"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/shopspring/decimal"
+)
+
+type FillMode int
+
+const (
+	FillMode_None         FillMode = iota
+	FillMode_CarryForward          // flat candle at the previous close, zero volume
+	FillMode_Null                  // candle with only its start set
+)
+
+// maxFilledCandles bounds the synthetic candles of one response
+const maxFilledCandles = 50000
+
+var fillModes = map[string]FillMode{
+	"":              FillMode_None,
+	"none":          FillMode_None,
+	"carry-forward": FillMode_CarryForward,
+	"null":          FillMode_Null,
+}
+
+// filledCandle is a stored candle or a candle generated for a gap.
+type filledCandle struct {
+	Model     dbModels.CandleModel
+	Synthetic bool
+	Null      bool
+}
+
+type gapFiller struct {
+	store        candleDao.CandleStore
+	mode         FillMode
+	intervalType dbModels.IntervalType
+	startTime    time.Time
+	endTime      time.Time
+	now          time.Time
+	calendars    map[uint64]*calendar.Calendar
+	result       []*filledCandle
+}
+
+// fillGaps returns the page rows with the missing starts of StartTime..EndTime
+// generated around them. Every page fills the gap before each of its rows, the
+// page with a product's newest row also fills up to EndTime, so paging never
+// fills a gap twice whatever the order. Only finished intervals are filled.
+func fillGaps(ctx context.Context, store candleDao.CandleStore, models []dbModels.CandleModel, mode FillMode, intervalType dbModels.IntervalType,
+	startTime, endTime time.Time, productIDs []uint64, isFirstPage bool, orders []*candleDao.Order) ([]*filledCandle, error) {
+
+	calendars, err := calendar.GetProductCalendars(ctx)
+	if err != nil {
+		logging.Error(ctx, "[fillGaps] GetProductCalendars err: %v", err)
+		return nil, err
+	}
+
+	f := &gapFiller{
+		store:        store,
+		mode:         mode,
+		intervalType: intervalType,
+		startTime:    startTime,
+		endTime:      endTime,
+		now:          time.Now(),
+		calendars:    calendars,
+		result:       []*filledCandle{},
+	}
+
+	byProduct := map[uint64][]dbModels.CandleModel{}
+	for _, m := range models {
+		byProduct[m.ProductID] = append(byProduct[m.ProductID], m)
+	}
+	if isFirstPage {
+		for _, id := range productIDs {
+			if _, ok := byProduct[id]; !ok {
+				byProduct[id] = []dbModels.CandleModel{}
+			}
+		}
+	}
+
+	for productID, rows := range byProduct {
+		sort.Slice(rows, func(i, j int) bool {
+			return rows[i].Start.Before(rows[j].Start)
+		})
+		if err := f.fillProduct(productID, rows); err != nil {
+			logging.Error(ctx, "[fillGaps] product [%d] error: %v", productID, err)
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(f.result, func(i, j int) bool {
+		return lessByOrders(&f.result[i].Model, &f.result[j].Model, orders)
+	})
+
+	return f.result, nil
+}
+
+func (f *gapFiller) fillProduct(productID uint64, rows []dbModels.CandleModel) error {
+
+	c := calendar.Of(f.calendars, productID)
+	first := c.Anchor.Truncate(f.intervalType, f.startTime)
+	if first.Before(f.startTime) {
+		first = c.Anchor.Next(f.intervalType, first)
+	}
+
+	if len(rows) == 0 {
+		// the product has no rows on this page, fill the window only if it has none at all
+		latest, err := f.latest(productID, f.startTime, f.endTime)
+		if err != nil || latest != nil {
+			return err
+		}
+	}
+
+	gapStart := first
+	var price *decimal.Decimal
+
+	before := first
+	if len(rows) > 0 {
+		before = rows[0].Start
+	}
+	prev, err := f.latest(productID, time.Unix(0, 0), before.Add(-time.Second))
+	if err != nil {
+		return err
+	}
+	if prev != nil {
+		price = &prev.Close
+		if next := c.Anchor.Next(f.intervalType, prev.Start); next.After(gapStart) {
+			gapStart = next
+		}
+	}
+
+	for i := range rows {
+		if err := f.fill(c, productID, gapStart, rows[i].Start, price); err != nil {
+			return err
+		}
+		f.result = append(f.result, &filledCandle{Model: rows[i]})
+		gapStart = c.Anchor.Next(f.intervalType, rows[i].Start)
+		price = &rows[i].Close
+	}
+
+	if len(rows) > 0 {
+		latest, err := f.latest(productID, f.startTime, f.endTime)
+		if err != nil {
+			return err
+		}
+		if latest == nil || !latest.Start.Equal(rows[len(rows)-1].Start) {
+			return nil
+		}
+	}
+
+	return f.fill(c, productID, gapStart, f.endTime.Add(time.Second), price)
+}
+
+// fill generates the finished starts in [from, to)
+func (f *gapFiller) fill(c *calendar.Calendar, productID uint64, from, to time.Time, price *decimal.Decimal) error {
+	for s := from.In(c.Anchor.Location); s.Before(to) && !c.Anchor.Next(f.intervalType, s).After(f.now); s = c.Anchor.Next(f.intervalType, s) {
+		if len(f.result) >= maxFilledCandles {
+			return common.ErrInvalidParam
+		}
+		if !isTradingBucket(c, f.intervalType, s) {
+			continue
+		}
+
+		c := &filledCandle{
+			Model: dbModels.CandleModel{
+				ProductID:    productID,
+				IntervalType: f.intervalType,
+				Start:        s,
+			},
+			Synthetic: true,
+		}
+		switch {
+		case f.mode == FillMode_Null:
+			c.Null = true
+		case price != nil:
+			c.Model.Open = *price
+			c.Model.Close = *price
+			c.Model.High = *price
+			c.Model.Low = *price
+		default:
+			// nothing to carry forward before the first candle
+			continue
+		}
+		f.result = append(f.result, c)
+	}
+	return nil
+}
+
+// isTradingBucket is false for intraday buckets outside sessions and for non-trading days
+func isTradingBucket(c *calendar.Calendar, intervalType dbModels.IntervalType, start time.Time) bool {
+	switch {
+	case intervalType.Duration() > 0:
+		return c.IsOpen(start) || c.IsOpen(intervalType.Next(start).Add(-time.Minute))
+	case intervalType == dbModels.IntervalType_1DY:
+		return c.IsTradingDay(start)
+	}
+	return true
+}
+
+func (f *gapFiller) latest(productID uint64, from, to time.Time) (*dbModels.CandleModel, error) {
+	return f.store.Get(&candleDao.QueryModel{
+		ProductID:    productID,
+		IntervalType: f.intervalType,
+		StartFrom:    &from,
+		StartTo:      &to,
+		OrderBy: []*candleDao.Order{
+			{Column: candleDao.OrderColumn_Start, Direction: candleDao.OrderDirection_DESC},
+		},
+	})
+}
+
+// lessByOrders compares like the requested order, falling back to product then start
+func lessByOrders(a, b *dbModels.CandleModel, orders []*candleDao.Order) bool {
+	for _, o := range orders {
+		var cmp int
+		switch o.Column {
+		case candleDao.OrderColumn_Start:
+			cmp = compareTime(a.Start, b.Start)
+		case candleDao.OrderColumn_ProductID:
+			cmp = compareUint64(a.ProductID, b.ProductID)
+		}
+		if o.Direction == candleDao.OrderDirection_DESC {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp < 0
+		}
+	}
+	if a.ProductID != b.ProductID {
+		return a.ProductID < b.ProductID
+	}
+	return a.Start.Before(b.Start)
+}
+
+func compareTime(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+func compareUint64(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
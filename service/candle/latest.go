@@ -0,0 +1,63 @@
+package candle
+
+import (
+	"context"
+
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	common "github.com/paper-trade-chatbot/be-common"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/paper-trade-chatbot/be-proto/candle"
+)
+
+const (
+	maxLatestCount    = 5000
+	maxLatestProducts = 100
+)
+
+type GetLatestCandlesReq struct {
+	ProductIDs   []int64               `json:"productIDs" form:"productID"`
+	IntervalType dbModels.IntervalType `json:"intervalType" form:"intervalType"`
+	Count        int                   `json:"count" form:"count"`
+}
+
+// GetLatestCandlesRes holds the candles of each product in ascending start order,
+// products in request order.
+type GetLatestCandlesRes struct {
+	Candles []*candle.GetCandlesResElement `json:"candles"`
+}
+
+// GetLatestCandles returns the latest Count stored candles of every product,
+// with one Count-limited query per product.
+func (impl *CandleImpl) GetLatestCandles(ctx context.Context, in *GetLatestCandlesReq) (*GetLatestCandlesRes, error) {
+
+	if len(in.ProductIDs) == 0 || len(in.ProductIDs) > maxLatestProducts ||
+		!in.IntervalType.Valid() || in.Count <= 0 || in.Count > maxLatestCount {
+		logging.Error(ctx, "[GetLatestCandles] invalid request: %#v", in)
+		return nil, common.ErrInvalidParam
+	}
+
+	candles := []*candle.GetCandlesResElement{}
+	seen := map[int64]bool{}
+	for _, productID := range in.ProductIDs {
+		if productID <= 0 {
+			return nil, common.ErrInvalidParam
+		}
+		if seen[productID] {
+			continue
+		}
+		seen[productID] = true
+
+		models, err := impl.store.GetLatest(uint64(productID), in.IntervalType, in.Count)
+		if err != nil {
+			logging.Error(ctx, "[GetLatestCandles] GetLatest %d error: %v", productID, err)
+			return nil, err
+		}
+		for i := range models {
+			candles = append(candles, newCandlesResElement(&models[i]))
+		}
+	}
+
+	return &GetLatestCandlesRes{
+		Candles: candles,
+	}, nil
+}
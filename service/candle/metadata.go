@@ -0,0 +1,199 @@
+package candle
+
+import (
+	"context"
+	"encoding/base64"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-candle/calendar"
+	"github.com/paper-trade-chatbot/be-candle/dao/candleDao"
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	common "github.com/paper-trade-chatbot/be-common"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// Options not (yet) carried by the be-proto messages are passed as gRPC
+// metadata: request options as incoming metadata, extra results as headers.
+const (
+	MetadataKeyConflictMode = "x-candle-conflict-mode"
+	MetadataKeyInserted     = "x-candle-inserted"
+	MetadataKeyUpdated      = "x-candle-updated"
+	MetadataKeySkipped      = "x-candle-skipped"
+
+	MetadataKeyValidation = "x-candle-validation"
+	MetadataKeyRejected   = "x-candle-rejected"
+	MetadataKeyViolations = "x-candle-violations-bin"
+	MetadataKeyRecomputed = "x-candle-recomputed"
+
+	MetadataKeyIntervalTypes  = "x-candle-interval-types"
+	MetadataKeyIncludePartial = "x-candle-include-partial"
+	MetadataKeyPartialCount   = "x-candle-partial-count"
+
+	MetadataKeyFillMode  = "x-candle-fill-mode"
+	MetadataKeySynthetic = "x-candle-synthetic"
+
+	MetadataKeyAnchor = "x-candle-anchor"
+
+	MetadataKeyRevisions = "x-candle-revisions"
+
+	MetadataKeyPagination = "x-candle-pagination"
+	MetadataKeyCursor     = "x-candle-cursor"
+	MetadataKeyNextCursor = "x-candle-next-cursor"
+)
+
+const (
+	paginationOffset = "offset"
+	paginationKeyset = "keyset"
+)
+
+var conflictModes = map[string]candleDao.ConflictMode{
+	"":          candleDao.ConflictMode_None,
+	"none":      candleDao.ConflictMode_None,
+	"skip":      candleDao.ConflictMode_Skip,
+	"overwrite": candleDao.ConflictMode_Overwrite,
+	"merge":     candleDao.ConflictMode_Merge,
+}
+
+func getMetadata(ctx context.Context, key string) string {
+	return strings.ToLower(getRawMetadata(ctx, key))
+}
+
+// getRawMetadata keeps the case, for opaque values like cursors
+func getRawMetadata(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(values[0])
+}
+
+// setHeader is a no-op outside of a gRPC call, e.g. when called from the HTTP api
+func setHeader(ctx context.Context, kv ...string) {
+	if grpc.ServerTransportStreamFromContext(ctx) == nil {
+		return
+	}
+	_ = grpc.SetHeader(ctx, metadata.Pairs(kv...))
+}
+
+func conflictModeFromContext(ctx context.Context) (candleDao.ConflictMode, error) {
+	mode, ok := conflictModes[getMetadata(ctx, MetadataKeyConflictMode)]
+	if !ok {
+		return candleDao.ConflictMode_None, common.ErrInvalidParam
+	}
+	return mode, nil
+}
+
+// setAnchorHeader reports the bucket alignment of day and longer candles as
+// productID=Location±HH:MM, comma separated.
+func setAnchorHeader(ctx context.Context, intervalType dbModels.IntervalType, productIDs []uint64) error {
+	if !intervalType.Valid() || intervalType.Duration() > 0 || len(productIDs) == 0 {
+		return nil
+	}
+
+	calendars, err := calendar.GetProductCalendars(ctx)
+	if err != nil {
+		logging.Error(ctx, "[setAnchorHeader] GetProductCalendars err: %v", err)
+		return err
+	}
+
+	anchors := []string{}
+	for _, id := range productIDs {
+		anchors = append(anchors, strconv.FormatUint(id, 10)+"="+calendar.Of(calendars, id).Anchor.String())
+	}
+	setHeader(ctx, MetadataKeyAnchor, strings.Join(anchors, ","))
+	return nil
+}
+
+// cursorFromContext decodes x-candle-cursor, nil for the first page.
+func cursorFromContext(ctx context.Context) (*candleDao.Cursor, error) {
+	raw := getRawMetadata(ctx, MetadataKeyCursor)
+	if raw == "" {
+		return nil, nil
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, common.ErrInvalidParam
+	}
+	parts := strings.Split(string(decoded), ":")
+	if len(parts) != 3 {
+		return nil, common.ErrInvalidParam
+	}
+	productID, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return nil, common.ErrInvalidParam
+	}
+	intervalType, err := strconv.ParseInt(parts[1], 10, 32)
+	if err != nil {
+		return nil, common.ErrInvalidParam
+	}
+	start, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return nil, common.ErrInvalidParam
+	}
+
+	return &candleDao.Cursor{
+		ProductID:    productID,
+		IntervalType: dbModels.IntervalType(intervalType),
+		Start:        time.Unix(start, 0),
+	}, nil
+}
+
+// setNextCursorHeader sets x-candle-next-cursor, empty on the last page.
+func setNextCursorHeader(ctx context.Context, cursor *candleDao.Cursor) {
+	encoded := ""
+	if cursor != nil {
+		raw := strconv.FormatUint(cursor.ProductID, 10) + ":" +
+			strconv.FormatInt(int64(cursor.IntervalType), 10) + ":" +
+			strconv.FormatInt(cursor.Start.Unix(), 10)
+		encoded = base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+	setHeader(ctx, MetadataKeyNextCursor, encoded)
+}
+
+// setRevisionsHeader reports the amended candles as index=revision, comma separated.
+func setRevisionsHeader(ctx context.Context, revisions map[int]uint32) {
+	indexes := []int{}
+	for i := range revisions {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	pairs := []string{}
+	for _, i := range indexes {
+		pairs = append(pairs, strconv.Itoa(i)+"="+strconv.FormatUint(uint64(revisions[i]), 10))
+	}
+	setHeader(ctx, MetadataKeyRevisions, strings.Join(pairs, ","))
+}
+
+// setViolationsHeader reports the rows left out by a partial CreateCandles and
+// the reported violations as a binary BadRequest.
+func setViolationsHeader(ctx context.Context, v *violations, rejected int) {
+	encoded, err := proto.Marshal(v.badRequest())
+	if err != nil {
+		logging.Error(ctx, "[setViolationsHeader] marshal error: %v", err)
+		encoded = nil
+	}
+	setHeader(ctx,
+		MetadataKeyRejected, strconv.Itoa(rejected),
+		MetadataKeyViolations, string(encoded),
+	)
+}
+
+func setUpsertHeader(ctx context.Context, result *candleDao.UpsertResult) {
+	setHeader(ctx,
+		MetadataKeyInserted, strconv.Itoa(result.Inserted),
+		MetadataKeyUpdated, strconv.Itoa(result.Updated),
+		MetadataKeySkipped, strconv.Itoa(result.Skipped),
+	)
+}
@@ -0,0 +1,138 @@
+package candle
+
+import (
+	"context"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-candle/aggregation"
+	"github.com/paper-trade-chatbot/be-candle/calendar"
+	"github.com/paper-trade-chatbot/be-candle/dao/candleDao"
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	"github.com/paper-trade-chatbot/be-candle/service"
+	"github.com/paper-trade-chatbot/be-candle/service/volume"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/paper-trade-chatbot/be-proto/quote"
+	"github.com/shopspring/decimal"
+)
+
+// getPartialCandles computes the forming candle of intervalType containing now
+// for each product whose forming bucket starts within [startTime, endTime],
+// from the quotes of the current minute and the finished child candles of the
+// bucket. The current minute only counts while the exchange is trading.
+func getPartialCandles(ctx context.Context, store candleDao.CandleStore, productIDs []uint64, intervalType dbModels.IntervalType, now, startTime, endTime time.Time) ([]dbModels.CandleModel, error) {
+
+	if len(productIDs) == 0 || !intervalType.Valid() {
+		return []dbModels.CandleModel{}, nil
+	}
+
+	calendars, err := calendar.GetProductCalendars(ctx)
+	if err != nil {
+		logging.Error(ctx, "[getPartialCandles] GetProductCalendars err: %v", err)
+		return nil, err
+	}
+
+	minute := now.Truncate(time.Minute)
+	groups := map[*calendar.Calendar][]uint64{}
+	open := []int64{}
+	for _, id := range productIDs {
+		c := calendar.Of(calendars, id)
+		bucket := c.Anchor.Truncate(intervalType, now)
+		if bucket.Before(startTime) || bucket.After(endTime) {
+			continue
+		}
+		groups[c] = append(groups[c], id)
+		if c.IsOpen(minute) {
+			open = append(open, int64(id))
+		}
+	}
+
+	forming, err := getForming1MICandles(ctx, open, minute, now)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []dbModels.CandleModel{}
+	for c, ids := range groups {
+		groupForming := []dbModels.CandleModel{}
+		for _, f := range forming {
+			if calendar.Of(calendars, f.ProductID) == c {
+				groupForming = append(groupForming, f)
+			}
+		}
+
+		productIDIn := ids
+		partials, err := aggregation.Partials(now, c.Anchor, []dbModels.IntervalType{intervalType}, groupForming,
+			func(source dbModels.IntervalType, from, to time.Time) ([]dbModels.CandleModel, error) {
+				startTo := to.Add(-time.Second)
+				return store.Gets(&candleDao.QueryModel{
+					ProductIDIn:  productIDIn,
+					IntervalType: source,
+					StartFrom:    &from,
+					StartTo:      &startTo,
+				})
+			},
+		)
+		if err != nil {
+			logging.Error(ctx, "[getPartialCandles] partials err: %v", err)
+			return nil, err
+		}
+		result = append(result, partials[intervalType]...)
+	}
+
+	return result, nil
+}
+
+// getForming1MICandles builds the 1MI candles of the current minute from quotes.
+func getForming1MICandles(ctx context.Context, productIDs []int64, minute, now time.Time) ([]dbModels.CandleModel, error) {
+
+	forming := []dbModels.CandleModel{}
+	if len(productIDs) == 0 {
+		return forming, nil
+	}
+
+	getFrom := minute.Format("150405")
+	getTo := now.Format("150405")
+	quoteData, err := service.Impl.QuoteIntf.GetQuotes(ctx, &quote.GetQuotesReq{
+		ProductIDs: productIDs,
+		Flag:       quote.GetQuotesReq_GetFlag_Quote | quote.GetQuotesReq_GetFlag_Latest,
+		GetFrom:    &getFrom,
+		GetTo:      &getTo,
+	})
+	if err != nil {
+		logging.Error(ctx, "[getForming1MICandles] GetQuotes err: %v", err)
+		return nil, err
+	}
+
+	volumes, err := volume.GetVolume().GetVolumes(ctx, minute)
+	if err != nil {
+		logging.Error(ctx, "[getForming1MICandles] GetVolumes err: %v", err)
+		return nil, err
+	}
+
+	for _, q := range quoteData.GetQuotes() {
+		quotes := map[string]string{}
+		for k, v := range q.GetQuotes() {
+			quotes[k] = v
+		}
+
+		var seed *decimal.Decimal
+		if latest, ok := quotes["latest"]; ok {
+			if price, err := decimal.NewFromString(latest); err == nil {
+				seed = &price
+			}
+			delete(quotes, "latest")
+		}
+
+		ticks, invalid := aggregation.ParseQuoteTicks(quotes, now)
+		if len(invalid) > 0 {
+			logging.Warn(ctx, "[getForming1MICandles] parse quote error: %v", invalid)
+		}
+
+		if m := aggregation.FromTicks(uint64(q.GetProductID()), minute, ticks, seed); m != nil {
+			m.Volume = volumes[m.ProductID]
+			forming = append(forming, *m)
+		}
+	}
+
+	return forming, nil
+}
@@ -0,0 +1,63 @@
+package candle
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/paper-trade-chatbot/be-candle/dao/candleDao"
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/shopspring/decimal"
+)
+
+// checkPrecision marks the valid rows with values that would be rounded when
+// stored, by the precision of their product in candle_precision or else by
+// the candle columns, as invalid.
+func checkPrecision(ctx context.Context, store candleDao.CandleStore, rows []*candleRow, v *violations) error {
+
+	productIDs := []uint64{}
+	seen := map[uint64]bool{}
+	for _, r := range rows {
+		if !r.invalid && !seen[r.model.ProductID] {
+			seen[r.model.ProductID] = true
+			productIDs = append(productIDs, r.model.ProductID)
+		}
+	}
+
+	precisions, err := store.GetPrecisions(productIDs)
+	if err != nil {
+		logging.Error(ctx, "[checkPrecision] GetPrecisions error: %v", err)
+		return err
+	}
+
+	for _, r := range rows {
+		if r.invalid {
+			continue
+		}
+		m := r.model
+		p, ok := precisions[m.ProductID]
+		if !ok {
+			p = dbModels.DefaultPrecision(m.ProductID)
+		}
+
+		fields := []struct {
+			name             string
+			value            decimal.Decimal
+			precision, scale int32
+		}{
+			{"open", m.Open, p.PricePrecision, p.PriceScale},
+			{"close", m.Close, p.PricePrecision, p.PriceScale},
+			{"high", m.High, p.PricePrecision, p.PriceScale},
+			{"low", m.Low, p.PricePrecision, p.PriceScale},
+			{"volume", m.Volume, p.VolumePrecision, p.VolumeScale},
+		}
+		for _, f := range fields {
+			if !dbModels.Fits(f.value, f.precision, f.scale) {
+				v.add(r.path+"."+f.name, fmt.Sprintf("%s would lose precision, exceeds DECIMAL(%d,%d)", f.value.String(), f.precision, f.scale))
+				r.invalid = true
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package candle
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/paper-trade-chatbot/be-candle/hub"
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	common "github.com/paper-trade-chatbot/be-common"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/paper-trade-chatbot/be-proto/candle"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var ErrStreamTooSlow = status.Error(codes.ResourceExhausted, "subscriber too slow, stream dropped")
+
+// be-proto has no streaming rpc yet, so CandleStreamService is described here
+// by hand on top of the existing candle messages:
+//
+//	rpc StreamCandles(GetCandlesReq) returns (stream GetCandlesResElement);
+//
+// Only productID and intervalType of the request are used. More interval types
+// can be given in the x-candle-interval-types metadata (comma separated), and
+// x-candle-include-partial: true also pushes in-progress candles, which are the
+// ones whose interval has not ended yet.
+//
+// Each streamed element carries whether its candle is complete as the extra
+// field
+//
+//	bool complete = 4;
+//
+// of GetCandlesResElement, which clients on the current be-proto read with
+// IsComplete.
+type CandleStreamServiceServer interface {
+	StreamCandles(*candle.GetCandlesReq, CandleStreamService_StreamCandlesServer) error
+}
+
+type CandleStreamService_StreamCandlesServer interface {
+	Send(*candle.GetCandlesResElement) error
+	grpc.ServerStream
+}
+
+type candleStreamServiceStreamCandlesServer struct {
+	grpc.ServerStream
+}
+
+func (x *candleStreamServiceStreamCandlesServer) Send(m *candle.GetCandlesResElement) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _CandleStreamService_StreamCandles_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(candle.GetCandlesReq)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CandleStreamServiceServer).StreamCandles(m, &candleStreamServiceStreamCandlesServer{stream})
+}
+
+var CandleStreamService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "candle.CandleStreamService",
+	HandlerType: (*CandleStreamServiceServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamCandles",
+			Handler:       _CandleStreamService_StreamCandles_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "candle/candle.proto",
+}
+
+func RegisterCandleStreamServiceServer(s grpc.ServiceRegistrar, srv CandleStreamServiceServer) {
+	s.RegisterService(&CandleStreamService_ServiceDesc, srv)
+}
+
+// StreamCandles pushes newly generated candles until the client leaves or
+// falls behind by more than the hub buffer.
+func (impl *CandleImpl) StreamCandles(in *candle.GetCandlesReq, stream CandleStreamService_StreamCandlesServer) error {
+
+	ctx := stream.Context()
+
+	intervalTypes, err := intervalTypesFromContext(ctx, in.GetIntervalType())
+	if err != nil {
+		logging.Error(ctx, "[StreamCandles] invalid interval types: %s", getMetadata(ctx, MetadataKeyIntervalTypes))
+		return err
+	}
+
+	productIDs := []uint64{}
+	for _, p := range in.GetProductID() {
+		productIDs = append(productIDs, uint64(p))
+	}
+
+	h := hub.GetHub()
+	subscription := h.Subscribe(productIDs, intervalTypes, getMetadata(ctx, MetadataKeyIncludePartial) == "true")
+	defer h.Unsubscribe(subscription)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-subscription.Dropped:
+			logging.Warn(ctx, "[StreamCandles] subscriber dropped")
+			return ErrStreamTooSlow
+		case e := <-subscription.Events:
+			element := newCandlesResElement(e.Candle)
+			setComplete(element, e.Complete)
+			if err := stream.Send(element); err != nil {
+				logging.Error(ctx, "[StreamCandles] send error: %v", err)
+				return err
+			}
+		}
+	}
+}
+
+func intervalTypesFromContext(ctx context.Context, intervalType candle.IntervalType) ([]dbModels.IntervalType, error) {
+
+	intervalTypes := []dbModels.IntervalType{}
+	if intervalType != candle.IntervalType_IntervalType_None {
+		intervalTypes = append(intervalTypes, dbModels.IntervalType(intervalType))
+	}
+
+	raw := getMetadata(ctx, MetadataKeyIntervalTypes)
+	if raw == "" {
+		return intervalTypes, nil
+	}
+	for _, v := range strings.Split(raw, ",") {
+		i, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || !dbModels.IntervalType(i).Valid() {
+			return nil, common.ErrInvalidParam
+		}
+		intervalTypes = append(intervalTypes, dbModels.IntervalType(i))
+	}
+	return intervalTypes, nil
+}
+
+// elementFieldComplete is the field number of complete in GetCandlesResElement
+const elementFieldComplete protowire.Number = 4
+
+// setComplete stores complete as an unknown field until be-proto declares it,
+// false is the proto default and is left out.
+func setComplete(element *candle.GetCandlesResElement, complete bool) {
+	if !complete {
+		return
+	}
+	raw := protowire.AppendTag(nil, elementFieldComplete, protowire.VarintType)
+	raw = protowire.AppendVarint(raw, protowire.EncodeBool(true))
+	element.ProtoReflect().SetUnknown(raw)
+}
+
+// IsComplete reports whether a streamed element holds a complete candle.
+func IsComplete(element *candle.GetCandlesResElement) bool {
+	raw := element.ProtoReflect().GetUnknown()
+	complete := false
+	for len(raw) > 0 {
+		number, wireType, n := protowire.ConsumeTag(raw)
+		if n < 0 {
+			return false
+		}
+		raw = raw[n:]
+		if number == elementFieldComplete && wireType == protowire.VarintType {
+			v, n := protowire.ConsumeVarint(raw)
+			if n < 0 {
+				return false
+			}
+			complete = protowire.DecodeBool(v)
+			raw = raw[n:]
+			continue
+		}
+		if n = protowire.ConsumeFieldValue(number, wireType, raw); n < 0 {
+			return false
+		}
+		raw = raw[n:]
+	}
+	return complete
+}
@@ -0,0 +1,31 @@
+package candle
+
+import (
+	"testing"
+
+	"github.com/paper-trade-chatbot/be-proto/candle"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestCompleteSurvivesTheWire(t *testing.T) {
+	for _, complete := range []bool{true, false} {
+		element := &candle.GetCandlesResElement{ProductID: 1, CandleStick: &candle.CandleStick{Start: 60, Open: "1"}}
+		setComplete(element, complete)
+
+		raw, err := proto.Marshal(element)
+		if err != nil {
+			t.Fatal(err)
+		}
+		received := &candle.GetCandlesResElement{}
+		if err := proto.Unmarshal(raw, received); err != nil {
+			t.Fatal(err)
+		}
+
+		if IsComplete(received) != complete {
+			t.Errorf("IsComplete = %v, want %v", IsComplete(received), complete)
+		}
+		if received.GetProductID() != 1 || received.GetCandleStick().GetOpen() != "1" {
+			t.Errorf("element changed: %v", received)
+		}
+	}
+}
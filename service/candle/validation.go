@@ -0,0 +1,170 @@
+package candle
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-candle/calendar"
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/paper-trade-chatbot/be-proto/candle"
+	"github.com/shopspring/decimal"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	validationStrict  = "strict"  // reject the whole batch
+	validationPartial = "partial" // store the valid rows
+)
+
+// at most this many violations are reported, the count covers all of them
+const maxViolationsReported = 100
+
+// candleRow is a candle stick of CreateCandlesReq, path is its field path,
+// e.g. candleCharts[0].candleSticks[3].
+type candleRow struct {
+	path    string
+	model   *dbModels.CandleModel
+	invalid bool
+}
+
+type violations struct {
+	count    int
+	reported []*errdetails.BadRequest_FieldViolation
+}
+
+func (v *violations) add(field, reason string) {
+	v.count++
+	if len(v.reported) < maxViolationsReported {
+		v.reported = append(v.reported, &errdetails.BadRequest_FieldViolation{
+			Field:       field,
+			Description: reason,
+		})
+	}
+}
+
+// err is InvalidArgument with the reported violations as BadRequest details.
+func (v *violations) err() error {
+	s := status.New(codes.InvalidArgument, fmt.Sprintf("%d invalid candle fields", v.count))
+	detailed, err := s.WithDetails(&errdetails.BadRequest{FieldViolations: v.reported})
+	if err != nil {
+		return s.Err()
+	}
+	return detailed.Err()
+}
+
+func (v *violations) badRequest() *errdetails.BadRequest {
+	return &errdetails.BadRequest{FieldViolations: v.reported}
+}
+
+func chartPath(i int) string {
+	return "candleCharts[" + strconv.Itoa(i) + "]"
+}
+
+// validateCandleCharts converts every candle stick of charts, recording why a
+// row is invalid in v. Rows of products in unknown are invalid, day and longer
+// candles must start at the anchor of their product's calendar.
+func validateCandleCharts(ctx context.Context, charts []*candle.CandleChart, unknown map[int64]bool, v *violations) ([]*candleRow, error) {
+
+	calendars, err := calendar.GetProductCalendars(ctx)
+	if err != nil {
+		logging.Error(ctx, "[validateCandleCharts] GetProductCalendars err: %v", err)
+		return nil, err
+	}
+
+	rows := []*candleRow{}
+	for i, cc := range charts {
+		path := chartPath(i)
+
+		chartValid := true
+		if cc.GetProductID() <= 0 {
+			v.add(path+".productID", "must be positive")
+			chartValid = false
+		} else if unknown[cc.GetProductID()] {
+			v.add(path+".productID", "no such product")
+			chartValid = false
+		}
+		intervalType := dbModels.IntervalType(cc.GetIntervalType())
+		if !intervalType.Valid() {
+			v.add(path+".intervalType", "invalid interval type")
+			chartValid = false
+		}
+
+		anchor := dbModels.UTCAnchor
+		if chartValid && intervalType.Duration() == 0 {
+			anchor = calendar.Of(calendars, uint64(cc.GetProductID())).Anchor
+		}
+
+		for j, s := range cc.GetCandleSticks() {
+			row := &candleRow{
+				path: path + ".candleSticks[" + strconv.Itoa(j) + "]",
+				model: &dbModels.CandleModel{
+					ProductID:    uint64(cc.GetProductID()),
+					IntervalType: intervalType,
+					Start:        time.Unix(s.GetStart(), 0),
+				},
+				invalid: !chartValid,
+			}
+			rows = append(rows, row)
+
+			row.validate(s, v)
+			if chartValid && !row.invalid && !anchor.Truncate(intervalType, row.model.Start).Equal(row.model.Start) {
+				v.add(row.path+".start", "not aligned to the interval")
+				row.invalid = true
+			}
+		}
+	}
+
+	return rows, nil
+}
+
+// validate parses s into the row's model and checks the values are consistent.
+func (r *candleRow) validate(s *candle.CandleStick, v *violations) {
+
+	invalid := func(field, reason string) {
+		v.add(r.path+"."+field, reason)
+		r.invalid = true
+	}
+
+	if s.GetStart() <= 0 {
+		invalid("start", "must be positive")
+	}
+
+	parse := func(field, value string, target *decimal.Decimal) bool {
+		d, err := decimal.NewFromString(value)
+		if err != nil {
+			invalid(field, "not a decimal: "+strconv.Quote(value))
+			return false
+		}
+		*target = d
+		return true
+	}
+
+	m := r.model
+	parsed := parse("open", s.GetOpen(), &m.Open)
+	parsed = parse("close", s.GetClose(), &m.Close) && parsed
+	parsed = parse("high", s.GetHigh(), &m.High) && parsed
+	parsed = parse("low", s.GetLow(), &m.Low) && parsed
+	// volume is optional
+	if s.GetVolume() != "" && parse("volume", s.GetVolume(), &m.Volume) && m.Volume.IsNegative() {
+		invalid("volume", "must not be negative")
+	}
+	if !parsed {
+		return
+	}
+
+	if m.High.LessThan(m.Low) {
+		invalid("high", "below low")
+		return
+	}
+	if m.Open.LessThan(m.Low) || m.Open.GreaterThan(m.High) {
+		invalid("open", "outside [low, high]")
+	}
+	if m.Close.LessThan(m.Low) || m.Close.GreaterThan(m.High) {
+		invalid("close", "outside [low, high]")
+	}
+}
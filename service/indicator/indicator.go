@@ -0,0 +1,152 @@
+package indicator
+
+import (
+	"context"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-candle/dao/candleDao"
+	"github.com/paper-trade-chatbot/be-candle/indicator"
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	common "github.com/paper-trade-chatbot/be-common"
+	"github.com/paper-trade-chatbot/be-common/logging"
+)
+
+// maxCandles bounds the candles of the window one request may compute over,
+// the warm-up read before it is bounded by indicator.MaxPeriod
+const maxCandles = 10000
+
+type GetIndicatorsReq struct {
+	ProductID    int64                 `json:"productID"`
+	IntervalType dbModels.IntervalType `json:"intervalType"`
+	StartTime    int64                 `json:"startTime"`
+	EndTime      int64                 `json:"endTime"`
+	Indicators   []indicator.Spec      `json:"indicators"`
+}
+
+type GetIndicatorsResElement struct {
+	Spec   indicator.Spec       `json:"spec"`
+	Series map[string][]*string `json:"series"`
+}
+
+// GetIndicatorsRes holds every series aligned with Starts, null where undefined.
+type GetIndicatorsRes struct {
+	Starts     []int64                    `json:"starts"`
+	Indicators []*GetIndicatorsResElement `json:"indicators"`
+}
+
+type IndicatorIntf interface {
+	GetIndicators(ctx context.Context, in *GetIndicatorsReq) (*GetIndicatorsRes, error)
+}
+
+type IndicatorImpl struct {
+	store candleDao.CandleStore
+}
+
+func New(store candleDao.CandleStore) IndicatorIntf {
+	return &IndicatorImpl{
+		store: store,
+	}
+}
+
+// GetIndicators computes the indicators over the stored candles of the window,
+// reading as many candles before StartTime as the indicators need to warm up.
+func (impl *IndicatorImpl) GetIndicators(ctx context.Context, in *GetIndicatorsReq) (*GetIndicatorsRes, error) {
+
+	if in.ProductID <= 0 || !in.IntervalType.Valid() || in.StartTime > in.EndTime || len(in.Indicators) == 0 {
+		return nil, common.ErrInvalidParam
+	}
+
+	warmUp := 0
+	for _, s := range in.Indicators {
+		if err := s.Validate(); err != nil {
+			logging.Error(ctx, "[GetIndicators] invalid spec: %#v", s)
+			return nil, common.ErrInvalidParam
+		}
+		if s.WarmUp() > warmUp {
+			warmUp = s.WarmUp()
+		}
+	}
+
+	startTime := time.Unix(in.StartTime, 0)
+	endTime := time.Unix(in.EndTime, 0)
+
+	candles, err := impl.store.Gets(&candleDao.QueryModel{
+		ProductID:    uint64(in.ProductID),
+		IntervalType: in.IntervalType,
+		StartFrom:    &startTime,
+		StartTo:      &endTime,
+		OrderBy: []*candleDao.Order{
+			{Column: candleDao.OrderColumn_Start, Direction: candleDao.OrderDirection_ASC},
+		},
+		Limit: maxCandles + 1,
+	})
+	if err != nil {
+		logging.Error(ctx, "[GetIndicators] gets error: %v", err)
+		return nil, err
+	}
+	if len(candles) > maxCandles {
+		logging.Error(ctx, "[GetIndicators] window exceeds %d candles", maxCandles)
+		return nil, common.ErrInvalidParam
+	}
+
+	history := []dbModels.CandleModel{}
+	if warmUp > 0 {
+		epoch := time.Unix(0, 0)
+		beforeStart := startTime.Add(-time.Second)
+		history, err = impl.store.Gets(&candleDao.QueryModel{
+			ProductID:    uint64(in.ProductID),
+			IntervalType: in.IntervalType,
+			StartFrom:    &epoch,
+			StartTo:      &beforeStart,
+			OrderBy: []*candleDao.Order{
+				{Column: candleDao.OrderColumn_Start, Direction: candleDao.OrderDirection_DESC},
+			},
+			Limit: warmUp,
+		})
+		if err != nil {
+			logging.Error(ctx, "[GetIndicators] gets warm-up error: %v", err)
+			return nil, err
+		}
+		for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+			history[i], history[j] = history[j], history[i]
+		}
+	}
+
+	series := append(history, candles...)
+	offset := len(history)
+
+	res := &GetIndicatorsRes{
+		Starts:     []int64{},
+		Indicators: []*GetIndicatorsResElement{},
+	}
+	for _, c := range candles {
+		res.Starts = append(res.Starts, c.Start.Unix())
+	}
+
+	for _, s := range in.Indicators {
+		computed, err := indicator.Compute(s, series)
+		if err != nil {
+			return nil, common.ErrInvalidParam
+		}
+
+		element := &GetIndicatorsResElement{
+			Spec:   s,
+			Series: map[string][]*string{},
+		}
+		for name, values := range computed {
+			line := make([]*string, 0, len(candles))
+			for _, v := range values[offset:] {
+				if v == nil {
+					line = append(line, nil)
+					continue
+				}
+				str := v.String()
+				line = append(line, &str)
+			}
+			element.Series[name] = line
+		}
+		res.Indicators = append(res.Indicators, element)
+	}
+
+	return res, nil
+}
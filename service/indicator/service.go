@@ -0,0 +1,77 @@
+package indicator
+
+import (
+	"context"
+	"encoding/json"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+// be-proto has no indicator messages yet, so CandleIndicatorService is
+// described here by hand and carries GetIndicatorsReq and GetIndicatorsRes as
+// the JSON of the HTTP API:
+//
+//	rpc GetIndicators(GetIndicatorsReq) returns (GetIndicatorsRes);
+//
+// Clients call it with the json content subtype (application/grpc+json), in Go
+// with grpc.CallContentSubtype(JSONCodecName).
+type CandleIndicatorServiceServer interface {
+	GetIndicators(context.Context, *GetIndicatorsReq) (*GetIndicatorsRes, error)
+}
+
+// JSONCodecName is the content subtype CandleIndicatorService is called with.
+const JSONCodecName = "json"
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return JSONCodecName
+}
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+func _CandleIndicatorService_GetIndicators_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetIndicatorsReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CandleIndicatorServiceServer).GetIndicators(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/candle.CandleIndicatorService/GetIndicators",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CandleIndicatorServiceServer).GetIndicators(ctx, req.(*GetIndicatorsReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var CandleIndicatorService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "candle.CandleIndicatorService",
+	HandlerType: (*CandleIndicatorServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetIndicators",
+			Handler:    _CandleIndicatorService_GetIndicators_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "candle/candle.proto",
+}
+
+func RegisterCandleIndicatorServiceServer(s grpc.ServiceRegistrar, srv CandleIndicatorServiceServer) {
+	s.RegisterService(&CandleIndicatorService_ServiceDesc, srv)
+}
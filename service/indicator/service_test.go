@@ -0,0 +1,78 @@
+package indicator
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-candle/dao/candleDao"
+	"github.com/paper-trade-chatbot/be-candle/indicator"
+	"github.com/paper-trade-chatbot/be-candle/models/dbModels"
+	"github.com/shopspring/decimal"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// TestGetIndicatorsOverGrpc calls CandleIndicatorService through a gRPC server
+// with the json content subtype.
+func TestGetIndicatorsOverGrpc(t *testing.T) {
+	ctx := context.Background()
+
+	base := time.Unix(1_800_000_000, 0).Truncate(time.Minute)
+	store := candleDao.NewMemoryStore()
+	models := []*dbModels.CandleModel{}
+	for i := 0; i < 3; i++ {
+		price := decimal.NewFromInt(int64(10 + i))
+		models = append(models, &dbModels.CandleModel{
+			ProductID: 1, IntervalType: dbModels.IntervalType_1MI, Start: base.Add(time.Duration(i) * time.Minute),
+			Open: price, Close: price, High: price, Low: price, Volume: price,
+		})
+	}
+	if _, err := store.News(models); err != nil {
+		t.Fatal(err)
+	}
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	RegisterCandleIndicatorServiceServer(server, New(store))
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.DialContext(ctx, "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	in := &GetIndicatorsReq{
+		ProductID:    1,
+		IntervalType: dbModels.IntervalType_1MI,
+		StartTime:    base.Unix(),
+		EndTime:      base.Add(2 * time.Minute).Unix(),
+		Indicators:   []indicator.Spec{{Type: indicator.Type_SMA, Period: 2}},
+	}
+	res := &GetIndicatorsRes{}
+	if err := conn.Invoke(ctx, "/candle.CandleIndicatorService/GetIndicators", in, res, grpc.CallContentSubtype(JSONCodecName)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Starts) != 3 || len(res.Indicators) != 1 {
+		t.Fatalf("res %+v", res)
+	}
+	for _, line := range res.Indicators[0].Series {
+		if len(line) != 3 || line[0] != nil || line[1] == nil || *line[1] != "10.5" || line[2] == nil || *line[2] != "11.5" {
+			t.Fatalf("SMA %v", line)
+		}
+	}
+
+	// invalid requests keep the error of the HTTP API
+	in.Indicators = nil
+	if err := conn.Invoke(ctx, "/candle.CandleIndicatorService/GetIndicators", in, res, grpc.CallContentSubtype(JSONCodecName)); err == nil {
+		t.Fatal("no error without indicators")
+	}
+}
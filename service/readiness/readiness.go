@@ -0,0 +1,160 @@
+package readiness
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/paper-trade-chatbot/be-common/cache"
+	"github.com/paper-trade-chatbot/be-common/config"
+	"github.com/paper-trade-chatbot/be-common/logging"
+)
+
+// The quote service marks minute M (quotes within (M, M+1m]) complete by adding
+// the product IDs, or "*" for every product, to the set quote:ready:<M unix>
+// and then publishing <M unix> on quote:ready to wake waiters up.
+const (
+	readyChannel   = "quote:ready"
+	readyKeyPrefix = "quote:ready:"
+	allProducts    = "*"
+
+	lagKey = "candle:lag:1MI"
+	// a day of minutes
+	lagHistory = 1440
+)
+
+// Lag is how long after the quotes of Minute were complete its candles were stored.
+type Lag struct {
+	Minute      int64 `json:"minute"`
+	ReadyAt     int64 `json:"readyAtMS"`
+	PersistedAt int64 `json:"persistedAtMS"`
+	LagMS       int64 `json:"lagMS"`
+	Complete    bool  `json:"complete"` // false if the wait hit the deadline
+}
+
+type ReadinessIntf interface {
+	WaitReady(ctx context.Context, minute time.Time, productIDs []int64) (readyAt time.Time, complete bool, err error)
+	RecordLag(ctx context.Context, minute, readyAt, persistedAt time.Time, complete bool) error
+}
+
+// ReadinessImpl waits on the quote:ready notifications, polling the ready set
+// every PollInterval in case a notification is missed, for at most Timeout.
+type ReadinessImpl struct {
+	Timeout      time.Duration
+	PollInterval time.Duration
+}
+
+var readinessInstance ReadinessIntf
+
+// Initialize creates the global waiter from CANDLE_QUOTE_READY_TIMEOUT_MS and CANDLE_QUOTE_READY_POLL_MS.
+func Initialize(ctx context.Context) {
+	readinessInstance = New(
+		config.GetMilliseconds("CANDLE_QUOTE_READY_TIMEOUT_MS"),
+		config.GetMilliseconds("CANDLE_QUOTE_READY_POLL_MS"),
+	)
+	logging.Info(ctx, "quote readiness initialized")
+}
+
+// GetReadiness returns the global waiter.
+func GetReadiness() ReadinessIntf {
+	return readinessInstance
+}
+
+func New(timeout, pollInterval time.Duration) ReadinessIntf {
+	if pollInterval <= 0 {
+		pollInterval = time.Millisecond * 100
+	}
+	return &ReadinessImpl{
+		Timeout:      timeout,
+		PollInterval: pollInterval,
+	}
+}
+
+// WaitReady blocks until the quotes of minute are complete for every product,
+// or until the deadline, returning when the wait ended.
+func (impl *ReadinessImpl) WaitReady(ctx context.Context, minute time.Time, productIDs []int64) (time.Time, bool, error) {
+
+	r, _ := cache.GetRedis()
+
+	// subscribe before the first check so that no notification falls in between
+	sub := r.Subscribe(ctx, readyChannel)
+	defer sub.Close()
+
+	deadline := time.NewTimer(impl.Timeout)
+	defer deadline.Stop()
+	poll := time.NewTicker(impl.PollInterval)
+	defer poll.Stop()
+
+	key := readyKeyPrefix + strconv.FormatInt(minute.Unix(), 10)
+	for {
+		ready, err := isReady(ctx, r.Client, key, productIDs)
+		if err != nil {
+			logging.Error(ctx, "[WaitReady] redis error: %v", err)
+			return time.Now(), false, err
+		}
+		if ready {
+			return time.Now(), true, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return time.Now(), false, ctx.Err()
+		case <-deadline.C:
+			return time.Now(), false, nil
+		case <-poll.C:
+		case <-sub.Channel():
+		}
+	}
+}
+
+func isReady(ctx context.Context, r *redis.Client, key string, productIDs []int64) (bool, error) {
+
+	members, err := r.SMembers(ctx, key).Result()
+	if err != nil {
+		return false, err
+	}
+
+	ready := map[string]bool{}
+	for _, m := range members {
+		if m == allProducts {
+			return true, nil
+		}
+		ready[m] = true
+	}
+	for _, id := range productIDs {
+		if !ready[strconv.FormatInt(id, 10)] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// RecordLag keeps the lag of the last lagHistory minutes, newest first.
+func (impl *ReadinessImpl) RecordLag(ctx context.Context, minute, readyAt, persistedAt time.Time, complete bool) error {
+
+	lag := &Lag{
+		Minute:      minute.Unix(),
+		ReadyAt:     readyAt.UnixMilli(),
+		PersistedAt: persistedAt.UnixMilli(),
+		LagMS:       persistedAt.Sub(readyAt).Milliseconds(),
+		Complete:    complete,
+	}
+	logging.Info(ctx, "[RecordLag] minute %d lag %dms complete: %t", lag.Minute, lag.LagMS, lag.Complete)
+
+	value, err := json.Marshal(lag)
+	if err != nil {
+		return err
+	}
+
+	r, _ := cache.GetRedis()
+	pipe := r.Pipeline()
+	pipe.LPush(ctx, lagKey, value)
+	pipe.LTrim(ctx, lagKey, 0, lagHistory-1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logging.Error(ctx, "[RecordLag] redis error: %v", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package volume
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/paper-trade-chatbot/be-common/cache"
+	"github.com/paper-trade-chatbot/be-common/config"
+	"github.com/paper-trade-chatbot/be-common/logging"
+	"github.com/shopspring/decimal"
+)
+
+// ticks are kept as long as quotes can still be backfilled
+const retention = time.Hour * 25
+
+type Source string
+
+const (
+	Source_Quote Source = "quote" // trade sizes reported by the quote service
+	Source_Fill  Source = "fill"  // paper-trading fills of our own platform
+)
+
+var sources = map[Source]bool{
+	Source_Quote: true,
+	Source_Fill:  true,
+}
+
+type Tick struct {
+	ProductID uint64          `json:"productID"`
+	Source    Source          `json:"source"`
+	At        int64           `json:"at"`
+	Size      decimal.Decimal `json:"size"`
+}
+
+type VolumeIntf interface {
+	AddTicks(ctx context.Context, ticks []*Tick) error
+	GetVolumes(ctx context.Context, minute time.Time) (map[uint64]decimal.Decimal, error)
+}
+
+// VolumeImpl keeps the tick sizes of each minute in Redis lists, one per
+// source, as "productID:size" entries so sums stay exact.
+type VolumeImpl struct {
+	Sources []Source
+}
+
+var volumeInstance VolumeIntf
+
+// Initialize creates the global accumulator with the sources listed in CANDLE_VOLUME_SOURCES.
+func Initialize(ctx context.Context) {
+	enabled := []Source{}
+	for _, s := range strings.Split(config.GetString("CANDLE_VOLUME_SOURCES"), ",") {
+		source := Source(strings.TrimSpace(s))
+		if sources[source] {
+			enabled = append(enabled, source)
+		}
+	}
+	volumeInstance = New(enabled)
+	logging.Info(ctx, "volume sources: %v", enabled)
+}
+
+// GetVolume returns the global accumulator.
+func GetVolume() VolumeIntf {
+	return volumeInstance
+}
+
+func New(enabled []Source) VolumeIntf {
+	return &VolumeImpl{
+		Sources: enabled,
+	}
+}
+
+func (impl *VolumeImpl) AddTicks(ctx context.Context, ticks []*Tick) error {
+
+	r, _ := cache.GetRedis()
+	pipe := r.Pipeline()
+
+	keys := map[string]bool{}
+	for _, t := range ticks {
+		key := volumeKey(t.Source, candleStart(t.At))
+		pipe.RPush(ctx, key, strconv.FormatUint(t.ProductID, 10)+":"+t.Size.String())
+		keys[key] = true
+	}
+	for key := range keys {
+		pipe.Expire(ctx, key, retention)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		logging.Error(ctx, "[AddTicks] redis error: %v", err)
+		return err
+	}
+	return nil
+}
+
+// GetVolumes sums the enabled sources of the minute per product.
+func (impl *VolumeImpl) GetVolumes(ctx context.Context, minute time.Time) (map[uint64]decimal.Decimal, error) {
+
+	volumes := map[uint64]decimal.Decimal{}
+	r, _ := cache.GetRedis()
+
+	for _, source := range impl.Sources {
+		entries, err := r.LRange(ctx, volumeKey(source, minute), 0, -1).Result()
+		if err != nil {
+			logging.Error(ctx, "[GetVolumes] redis error: %v", err)
+			return nil, err
+		}
+
+		for _, e := range entries {
+			parts := strings.SplitN(e, ":", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			productID, err := strconv.ParseUint(parts[0], 10, 64)
+			if err != nil {
+				continue
+			}
+			size, err := decimal.NewFromString(parts[1])
+			if err != nil {
+				continue
+			}
+			volumes[productID] = volumes[productID].Add(size)
+		}
+	}
+
+	return volumes, nil
+}
+
+// ValidateTick checks that the tick can still be counted in a candle.
+func ValidateTick(t *Tick) bool {
+	if t.ProductID == 0 || !sources[t.Source] || t.Size.IsNegative() {
+		return false
+	}
+	at := time.Unix(t.At, 0)
+	return at.After(time.Now().Add(-retention)) && !at.After(time.Now().Add(time.Minute))
+}
+
+// candleStart returns the 1MI candle of a tick, which like quotes covers (start, start+1m]
+func candleStart(at int64) time.Time {
+	return time.Unix(at-1, 0).Truncate(time.Minute)
+}
+
+func volumeKey(source Source, minute time.Time) string {
+	return "candle:volume:" + string(source) + ":" + strconv.FormatInt(minute.Unix(), 10)
+}